@@ -0,0 +1,270 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// Instructions is a stream of opcodes, each followed by its operands in
+// big endian
+type Instructions []byte
+
+// Opcode is the first byte of an instruction
+type Opcode byte
+
+const (
+	OpConstant Opcode = iota // push a constant
+	OpNull                   // push null
+	OpTrue                   // push true
+	OpFalse                  // push false
+	OpNil                    // push the absence of a value, what statements evaluate to
+	OpPop                    // drop the top of the stack
+
+	OpGetLocal         // push the local in slot, depth scopes up
+	OpSetLocal         // pop into the local in slot, depth scopes up
+	OpDefineLocal      // pop into a slot of the current scope
+	OpGetGlobal        // push the global called by a name constant
+	OpSetGlobal        // pop into an existing global
+	OpDefine           // pop into a name of the current scope
+	OpDefineConst      // pop into a name of the current scope that can't be assigned again
+	OpDefineConstLocal // pop into a slot of the current scope that can't be assigned again
+	OpPushScope        // enter a block scope
+	OpPopScope         // leave a block scope
+
+	OpJump      // jump to an absolute offset
+	OpJumpFalse // pop the condition and jump if it is falsy
+
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+	OpMod
+	OpBitOr
+	OpBitAnd
+	OpLess
+	OpGreater
+	OpLessEqual
+	OpGreaterEqual
+	OpEqual
+	OpNotEqual
+	OpAnd
+	OpOr
+	OpIn
+	OpNotIn
+	OpImplements
+	OpMinus
+	OpBang
+
+	OpCall     // call the function below argc arguments
+	OpTailCall // call the function below argc arguments in place of the current call
+	OpPipe     // call the function on top with the argc arguments below it
+	OpReturn   // return the top of the stack from the function
+	OpClosure  // push a function of a Function constant closing over the current scope
+	OpYield    // hand the top of the stack to whoever resumed the generator
+
+	OpList        // collect n elements into a list
+	OpTuple       // collect n elements into a tuple
+	OpMap         // collect n key/value pairs into a map
+	OpIndex       // index the object below with the top of the stack
+	OpGetProperty // read the attribute called by a name constant, through an inline cache
+	OpSetProperty // assign the top of the stack to an attribute of the object below, through an inline cache
+
+	OpLoop // start iterating the top of the stack for n targets
+	OpNext // step the loop on top into a new scope, or drop it and jump when it's over
+
+	OpEvaluate // push what a Node constant evaluates to in the tree walker
+	OpExecute  // run a Node constant statement in the tree walker, push its result
+	OpFail     // raise an error with a message constant
+	OpResult   // pop the result of a top level statement
+)
+
+// Definition describes an opcode for the disassembler and for Make
+type Definition struct {
+	Name          string
+	OperandWidths []int
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant: {"OpConstant", []int{2}},
+	OpNull:     {"OpNull", []int{}},
+	OpTrue:     {"OpTrue", []int{}},
+	OpFalse:    {"OpFalse", []int{}},
+	OpNil:      {"OpNil", []int{}},
+	OpPop:      {"OpPop", []int{}},
+
+	OpGetLocal:         {"OpGetLocal", []int{1, 2}},
+	OpSetLocal:         {"OpSetLocal", []int{1, 2}},
+	OpDefineLocal:      {"OpDefineLocal", []int{2}},
+	OpGetGlobal:        {"OpGetGlobal", []int{2}},
+	OpSetGlobal:        {"OpSetGlobal", []int{2}},
+	OpDefine:           {"OpDefine", []int{2}},
+	OpDefineConst:      {"OpDefineConst", []int{2}},
+	OpDefineConstLocal: {"OpDefineConstLocal", []int{2, 2}},
+	OpPushScope:        {"OpPushScope", []int{}},
+	OpPopScope:         {"OpPopScope", []int{}},
+
+	OpJump:      {"OpJump", []int{2}},
+	OpJumpFalse: {"OpJumpFalse", []int{2}},
+
+	OpAdd:          {"OpAdd", []int{}},
+	OpSub:          {"OpSub", []int{}},
+	OpMul:          {"OpMul", []int{}},
+	OpDiv:          {"OpDiv", []int{}},
+	OpMod:          {"OpMod", []int{}},
+	OpBitOr:        {"OpBitOr", []int{}},
+	OpBitAnd:       {"OpBitAnd", []int{}},
+	OpLess:         {"OpLess", []int{}},
+	OpGreater:      {"OpGreater", []int{}},
+	OpLessEqual:    {"OpLessEqual", []int{}},
+	OpGreaterEqual: {"OpGreaterEqual", []int{}},
+	OpEqual:        {"OpEqual", []int{}},
+	OpNotEqual:     {"OpNotEqual", []int{}},
+	OpAnd:          {"OpAnd", []int{}},
+	OpOr:           {"OpOr", []int{}},
+	OpIn:           {"OpIn", []int{}},
+	OpNotIn:        {"OpNotIn", []int{}},
+	OpImplements:   {"OpImplements", []int{}},
+	OpMinus:        {"OpMinus", []int{}},
+	OpBang:         {"OpBang", []int{}},
+
+	OpCall:     {"OpCall", []int{1}},
+	OpTailCall: {"OpTailCall", []int{1}},
+	OpPipe:     {"OpPipe", []int{1}},
+	OpReturn:   {"OpReturn", []int{}},
+	OpClosure:  {"OpClosure", []int{2}},
+	OpYield:    {"OpYield", []int{}},
+
+	OpList:        {"OpList", []int{2}},
+	OpTuple:       {"OpTuple", []int{2}},
+	OpMap:         {"OpMap", []int{2}},
+	OpIndex:       {"OpIndex", []int{}},
+	OpGetProperty: {"OpGetProperty", []int{2, 2}},
+	OpSetProperty: {"OpSetProperty", []int{2, 2}},
+
+	OpLoop: {"OpLoop", []int{1}},
+	OpNext: {"OpNext", []int{2}},
+
+	OpEvaluate: {"OpEvaluate", []int{2}},
+	OpExecute:  {"OpExecute", []int{2}},
+	OpFail:     {"OpFail", []int{2}},
+	OpResult:   {"OpResult", []int{}},
+}
+
+// Operators maps the infix operators to their opcodes
+var Operators = map[string]Opcode{
+	"+":          OpAdd,
+	"-":          OpSub,
+	"*":          OpMul,
+	"/":          OpDiv,
+	"%":          OpMod,
+	"|":          OpBitOr,
+	"&":          OpBitAnd,
+	"<":          OpLess,
+	">":          OpGreater,
+	"<=":         OpLessEqual,
+	">=":         OpGreaterEqual,
+	"==":         OpEqual,
+	"!=":         OpNotEqual,
+	"and":        OpAnd,
+	"or":         OpOr,
+	"in":         OpIn,
+	"not in":     OpNotIn,
+	"implements": OpImplements,
+}
+
+// Lookup returns the definition of op
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+	return def, nil
+}
+
+// Make encodes an instruction
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	length := 1
+	for _, w := range def.OperandWidths {
+		length += w
+	}
+
+	instruction := make([]byte, length)
+	instruction[0] = byte(op)
+
+	offset := 1
+	for i, o := range operands {
+		switch def.OperandWidths[i] {
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 1:
+			instruction[offset] = byte(o)
+		}
+		offset += def.OperandWidths[i]
+	}
+
+	return instruction
+}
+
+// ReadOperands decodes the operands following an opcode and returns them
+// with the number of bytes they take
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ins[offset])
+		}
+		offset += width
+	}
+
+	return operands, offset
+}
+
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+// String disassembles the instructions, one per line
+func (ins Instructions) String() string {
+	var out bytes.Buffer
+
+	i := 0
+	for i < len(ins) {
+		def, err := Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			i++
+			continue
+		}
+
+		operands, read := ReadOperands(def, ins[i+1:])
+		fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstruction(def, operands))
+
+		i += 1 + read
+	}
+
+	return out.String()
+}
+
+func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
+	switch len(def.OperandWidths) {
+	case 0:
+		return def.Name
+	case 1:
+		return fmt.Sprintf("%s %d", def.Name, operands[0])
+	case 2:
+		return fmt.Sprintf("%s %d %d", def.Name, operands[0], operands[1])
+	}
+
+	return fmt.Sprintf("ERROR: unhandled operand count for %s", def.Name)
+}
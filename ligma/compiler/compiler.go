@@ -0,0 +1,505 @@
+package compiler
+
+import (
+	"fmt"
+	"sort"
+
+	"ligma/runtime"
+	"ligma/token"
+)
+
+// Function is the compiled body of a function literal, or the top level
+// of a program
+type Function struct {
+	Instructions Instructions
+	Literal      *runtime.FunctionLiteral // nil for a program
+
+	// Statements are the offsets the top level statements start at. An error
+	// at the top level goes on with the next statement, like Interpret does
+	Statements []int
+
+	// Caches is how many property access sites the function has, each site
+	// has an inline cache of its own in the VM
+	Caches int
+}
+
+func (f *Function) Inspect() string          { return "<compiled function>" }
+func (f *Function) Type() runtime.ObjectType { return "COMPILED_FUNCTION" }
+
+// Node is a statement or expression the compiler doesn't lower, the VM runs
+// it with the tree walker in the current environment
+type Node struct {
+	Statement  runtime.Statement
+	Expression runtime.Expression
+}
+
+func (n *Node) Inspect() string          { return "<node>" }
+func (n *Node) Type() runtime.ObjectType { return "NODE" }
+
+// Bytecode is a compiled program with the constant pool its instructions
+// refer to. Literals are built once and shared, names and messages are
+// plain strings
+type Bytecode struct {
+	Main      *Function
+	Constants []runtime.LigmaObject
+}
+
+// Compiler lowers resolved programs to bytecode. Locals are addressed by the
+// scope depth and slot the Resolver recorded in the interpreter, so the
+// compiler has to be given the interpreter the program was resolved with.
+// One compiler can compile many programs, they share its constant pool
+type Compiler struct {
+	interpreter *runtime.Interpreter
+
+	constants []runtime.LigmaObject
+	literals  map[interface{}]int // constant index of every literal and name
+	functions map[*runtime.FunctionLiteral]int
+
+	instructions Instructions // of the function being compiled
+	caches       int          // property access sites of the function being compiled
+}
+
+// literalKey tells literals of different types with the same Go value apart
+type literalKey struct {
+	kind  string
+	value interface{}
+}
+
+func New(i *runtime.Interpreter) *Compiler {
+	return &Compiler{
+		interpreter: i,
+		literals:    make(map[interface{}]int),
+		functions:   make(map[*runtime.FunctionLiteral]int),
+	}
+}
+
+// Constants returns the constant pool, it grows as more code is compiled
+func (c *Compiler) Constants() []runtime.LigmaObject {
+	return c.constants
+}
+
+// Compile lowers a program that has been resolved
+func (c *Compiler) Compile(program *runtime.Program) *Bytecode {
+	main := &Function{}
+	c.instructions = Instructions{}
+	c.caches = 0
+
+	for _, stmt := range program.Statements {
+		main.Statements = append(main.Statements, len(c.instructions))
+		c.topLevel(stmt)
+	}
+
+	main.Instructions = c.instructions
+	main.Caches = c.caches
+	return &Bytecode{Main: main, Constants: c.constants}
+}
+
+// Function returns the compiled body of fl, it is compiled the first time
+// it is asked for
+func (c *Compiler) Function(fl *runtime.FunctionLiteral) *Function {
+	return c.constants[c.function(fl)].(*Function)
+}
+
+func (c *Compiler) function(fl *runtime.FunctionLiteral) int {
+	if index, ok := c.functions[fl]; ok {
+		return index
+	}
+
+	fn := &Function{Literal: fl}
+	index := c.addConstant(fn)
+	c.functions[fl] = index
+
+	enclosing, caches := c.instructions, c.caches
+	c.instructions, c.caches = Instructions{}, 0
+
+	for _, stmt := range fl.Body.Statements {
+		c.statement(stmt)
+	}
+	// falling off the end returns nothing
+	c.emit(OpNil)
+	c.emit(OpReturn)
+
+	fn.Instructions, fn.Caches = c.instructions, c.caches
+	c.instructions, c.caches = enclosing, caches
+
+	return index
+}
+
+// topLevel compiles a statement of the program, what it evaluates to is
+// kept as the result of the program
+func (c *Compiler) topLevel(stmt runtime.Statement) {
+	if es, ok := stmt.(*runtime.ExpressionStatement); ok {
+		c.expression(es.Expression)
+		c.emit(OpResult)
+		return
+	}
+
+	if !c.lowers(stmt) {
+		c.emit(OpExecute, c.node(&Node{Statement: stmt}))
+		c.emit(OpResult)
+		return
+	}
+
+	c.statement(stmt)
+	c.emit(OpNil)
+	c.emit(OpResult)
+}
+
+// lowers reports whether stmt is compiled to instructions of its own. The
+// declarations of classes, records, enums and interfaces, assert, with and
+// unpacking defs are not lowered: they run with the tree walker through
+// OpExecute, in the environment of the code around them
+func (c *Compiler) lowers(stmt runtime.Statement) bool {
+	switch stmt.(type) {
+	case *runtime.ExpressionStatement, *runtime.DefStatement, *runtime.ReturnStatement,
+		*runtime.BlockStatement, *runtime.WhileStatement, *runtime.ForStatement:
+		return true
+	}
+	return false
+}
+
+func (c *Compiler) statement(stmt runtime.Statement) {
+	switch stmt := stmt.(type) {
+	case *runtime.ExpressionStatement:
+		// an assignment has no value to throw away
+		if ae, ok := stmt.Expression.(*runtime.AssignExpression); ok {
+			c.assign(ae)
+			return
+		}
+		c.expression(stmt.Expression)
+		c.emit(OpPop)
+
+	case *runtime.DefStatement:
+		c.expression(stmt.Value)
+		c.define(stmt.Name, stmt.Constant)
+
+	case *runtime.ReturnStatement:
+		// a call in tail position reuses the frame of the function, the
+		// return after it is only reached when it couldn't
+		if call, ok := stmt.ReturnValue.(*runtime.CallExpression); ok && stmt.Tail {
+			c.expression(call.Function)
+			for _, arg := range call.Arguments {
+				c.expression(arg)
+			}
+			c.emit(OpTailCall, len(call.Arguments))
+			c.emit(OpReturn)
+			break
+		}
+		c.expression(stmt.ReturnValue)
+		c.emit(OpReturn)
+
+	case *runtime.BlockStatement:
+		c.block(stmt)
+
+	case *runtime.WhileStatement:
+		start := len(c.instructions)
+		c.expression(stmt.Condition)
+		exit := c.emit(OpJumpFalse, 0)
+		c.block(stmt.Body)
+		c.emit(OpJump, start)
+		c.patch(exit, len(c.instructions))
+
+	case *runtime.ForStatement:
+		// the targets are the first locals of the scope the body runs in
+		c.expression(stmt.Iterable)
+		c.emit(OpLoop, len(stmt.Targets))
+		next := c.emit(OpNext, 0)
+		for _, s := range stmt.Body.Statements {
+			c.statement(s)
+		}
+		c.emit(OpPopScope)
+		c.emit(OpJump, next)
+		c.patch(next, len(c.instructions))
+
+	default:
+		c.emit(OpExecute, c.node(&Node{Statement: stmt}))
+		c.emit(OpPop)
+	}
+}
+
+func (c *Compiler) block(block *runtime.BlockStatement) {
+	c.emit(OpPushScope)
+	for _, stmt := range block.Statements {
+		c.statement(stmt)
+	}
+	c.emit(OpPopScope)
+}
+
+// define binds the value on top of the stack to a declared name
+func (c *Compiler) define(name *runtime.Identifier, constant bool) {
+	if runtime.IsBuiltin(name.Value) {
+		c.emit(OpPop)
+		c.emit(OpFail, c.name(fmt.Sprintf("Built-in function %s cannot be redefined", name.Value)))
+		return
+	}
+
+	if _, slot, ok := c.interpreter.Local(name); ok && constant {
+		c.emit(OpDefineConstLocal, slot, c.name(name.Value))
+	} else if ok {
+		c.emit(OpDefineLocal, slot)
+	} else if constant {
+		c.emit(OpDefineConst, c.name(name.Value))
+	} else {
+		c.emit(OpDefine, c.name(name.Value))
+	}
+}
+
+// assign stores the value of an assignment, it leaves nothing on the stack
+func (c *Compiler) assign(ae *runtime.AssignExpression) {
+	c.expression(ae.Value)
+
+	if runtime.IsBuiltin(ae.Name.Value) {
+		c.emit(OpPop)
+		c.emit(OpFail, c.name(fmt.Sprintf("identifier %s is reserved", ae.Name.Value)))
+		return
+	}
+
+	if depth, slot, ok := c.interpreter.Local(ae); ok {
+		c.emit(OpSetLocal, depth, slot)
+	} else {
+		c.emit(OpSetGlobal, c.name(ae.Name.Value))
+	}
+}
+
+func (c *Compiler) expression(expr runtime.Expression) {
+	switch expr := expr.(type) {
+	case *runtime.IntegerLiteral:
+		c.emit(OpConstant, c.literal("int", expr.Value, runtime.NewInteger(expr.Value)))
+
+	case *runtime.FloatLiteral:
+		c.emit(OpConstant, c.literal("float", expr.Value, runtime.NewFloat(expr.Value)))
+
+	case *runtime.StringLiteral:
+		c.emit(OpConstant, c.literal("str", expr.Value, c.interpreter.Intern(expr.Value)))
+
+	case *runtime.Boolean:
+		if expr.Value {
+			c.emit(OpTrue)
+		} else {
+			c.emit(OpFalse)
+		}
+
+	case *runtime.Null:
+		c.emit(OpNull)
+
+	case *runtime.Identifier:
+		c.variable(expr, expr.Value)
+
+	case *runtime.Self:
+		c.variable(expr, expr.Token.Literal)
+
+	case *runtime.AssignExpression:
+		// an assignment evaluates to nothing
+		c.assign(expr)
+		c.emit(OpNil)
+
+	case *runtime.PrefixExpression:
+		switch expr.Operator {
+		case "!":
+			c.expression(expr.Right)
+			c.emit(OpBang)
+		case "-":
+			c.expression(expr.Right)
+			c.emit(OpMinus)
+		default:
+			c.evaluate(expr)
+		}
+
+	case *runtime.InfixExpression:
+		op, ok := Operators[expr.Operator]
+		if !ok {
+			c.evaluate(expr)
+			return
+		}
+		c.expression(expr.Left)
+		c.expression(expr.Right)
+		c.emit(op)
+
+	case *runtime.IfExpression:
+		// a branch that ran evaluates to nothing, a missing one to null
+		c.expression(expr.Condition)
+		alternative := c.emit(OpJumpFalse, 0)
+		c.block(expr.Consequence)
+		c.emit(OpNil)
+		end := c.emit(OpJump, 0)
+		c.patch(alternative, len(c.instructions))
+		if expr.Alternative != nil {
+			c.block(expr.Alternative)
+			c.emit(OpNil)
+		} else {
+			c.emit(OpNull)
+		}
+		c.patch(end, len(c.instructions))
+
+	case *runtime.CallExpression:
+		c.expression(expr.Function)
+		for _, arg := range expr.Arguments {
+			c.expression(arg)
+		}
+		c.emit(OpCall, len(expr.Arguments))
+
+	case *runtime.PipeExpression:
+		// `a |> f(b)` calls f(a, b), the arguments are evaluated before f
+		c.expression(expr.Left)
+		target := expr.Right
+		argc := 1
+		if call, ok := expr.Right.(*runtime.CallExpression); ok {
+			target = call.Function
+			for _, arg := range call.Arguments {
+				c.expression(arg)
+			}
+			argc += len(call.Arguments)
+		}
+		c.expression(target)
+		c.emit(OpPipe, argc)
+
+	case *runtime.FunctionLiteral:
+		c.emit(OpClosure, c.function(expr))
+
+	case *runtime.YieldExpression:
+		if expr.Value != nil {
+			c.expression(expr.Value)
+		} else {
+			c.emit(OpNull)
+		}
+		c.emit(OpYield)
+
+	case *runtime.ListLiteral:
+		for _, element := range expr.Elements {
+			c.expression(element)
+		}
+		c.emit(OpList, len(expr.Elements))
+
+	case *runtime.TupleLiteral:
+		for _, element := range expr.Elements {
+			c.expression(element)
+		}
+		c.emit(OpTuple, len(expr.Elements))
+
+	case *runtime.MapLiteral:
+		// the pairs are kept in a Go map, they are evaluated in source order
+		keys := make([]runtime.Expression, 0, len(expr.Pairs))
+		for key := range expr.Pairs {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(a, b int) bool {
+			ta, tb := keyToken(keys[a]), keyToken(keys[b])
+			if ta.Line != tb.Line {
+				return ta.Line < tb.Line
+			}
+			return ta.Column < tb.Column
+		})
+		for _, key := range keys {
+			c.expression(key)
+			c.expression(expr.Pairs[key])
+		}
+		c.emit(OpMap, len(keys))
+
+	case *runtime.IndexExpression:
+		c.expression(expr.Left)
+		c.expression(expr.Index)
+		c.emit(OpIndex)
+
+	case *runtime.GetExpression:
+		c.expression(expr.Object)
+		c.emit(OpGetProperty, c.name(expr.Property.Value), c.cache())
+
+	case *runtime.SetExpression:
+		c.expression(expr.Object)
+		c.expression(expr.Value)
+		c.emit(OpSetProperty, c.name(expr.Property.Value), c.cache())
+
+	default:
+		c.evaluate(expr)
+	}
+}
+
+// variable reads a local from its slot and anything else from the globals
+func (c *Compiler) variable(expr runtime.Expression, name string) {
+	if depth, slot, ok := c.interpreter.Local(expr); ok {
+		c.emit(OpGetLocal, depth, slot)
+		return
+	}
+	c.emit(OpGetGlobal, c.name(name))
+}
+
+// keyToken returns the token a map key starts at, keys are mostly literals and names
+func keyToken(expr runtime.Expression) token.Token {
+	switch expr := expr.(type) {
+	case *runtime.StringLiteral:
+		return expr.Token
+	case *runtime.IntegerLiteral:
+		return expr.Token
+	case *runtime.FloatLiteral:
+		return expr.Token
+	case *runtime.Boolean:
+		return expr.Token
+	case *runtime.Identifier:
+		return expr.Token
+	case *runtime.TupleLiteral:
+		return expr.Token
+	case *runtime.CallExpression:
+		return keyToken(expr.Function)
+	case *runtime.GetExpression:
+		return keyToken(expr.Object)
+	}
+	return token.Token{}
+}
+
+// evaluate leaves expr to the tree walker
+func (c *Compiler) evaluate(expr runtime.Expression) {
+	c.emit(OpEvaluate, c.node(&Node{Expression: expr}))
+}
+
+// literal returns the constant of a literal, literals of the same value
+// share the immutable instance
+func (c *Compiler) literal(class string, value interface{}, instance *runtime.LigmaInstance) int {
+	key := literalKey{kind: class, value: value}
+	if index, ok := c.literals[key]; ok {
+		return index
+	}
+
+	index := c.addConstant(instance)
+	c.literals[key] = index
+	return index
+}
+
+// name returns the constant of a name or a message
+func (c *Compiler) name(name string) int {
+	key := literalKey{kind: "name", value: name}
+	if index, ok := c.literals[key]; ok {
+		return index
+	}
+
+	index := c.addConstant(&runtime.LigmaString{Value: name})
+	c.literals[key] = index
+	return index
+}
+
+// cache returns the index of a new inline cache of the function being compiled
+func (c *Compiler) cache() int {
+	c.caches++
+	return c.caches - 1
+}
+
+func (c *Compiler) node(node *Node) int {
+	return c.addConstant(node)
+}
+
+func (c *Compiler) addConstant(obj runtime.LigmaObject) int {
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1
+}
+
+// emit appends an instruction and returns where it starts
+func (c *Compiler) emit(op Opcode, operands ...int) int {
+	position := len(c.instructions)
+	c.instructions = append(c.instructions, Make(op, operands...)...)
+	return position
+}
+
+// patch points the jump at position to target
+func (c *Compiler) patch(position int, target int) {
+	op := Opcode(c.instructions[position])
+	copy(c.instructions[position:], Make(op, target))
+}
@@ -9,6 +9,7 @@ type Lexer struct {
 	ch           byte // current char under examination
 
 	line int
+	lineStart int // position of the first character of the current line
 
 	// for error handling
 	errors []string
@@ -36,16 +37,31 @@ func (l *Lexer) readChar() {
 
 // NextToken returns the next token in the input
 func (l *Lexer) NextToken() token.Token {
-	
-	var tok token.Token
-
 	l.skipWhitespace()
 
+	line, column := l.line, l.position - l.lineStart + 1
+
+	tok := l.readToken()
+	tok.Line = line
+	tok.Column = column
+	return tok
+}
+
+// readToken reads the token starting at the current character
+func (l *Lexer) readToken() token.Token {
+	var tok token.Token
+
 	switch l.ch {
 		case '+':
 			tok = newTokenChar(token.PLUS, l.ch)
 		case '-':
-			tok = newTokenChar(token.MINUS, l.ch)
+			if l.peekChar() == '>' {
+				ch := l.ch
+				l.readChar()
+				tok = newTokenStr(token.ARROW, string(ch) + string(l.ch))
+			} else {
+				tok = newTokenChar(token.MINUS, l.ch)
+			}
 		case '*':
 			if l.peekChar() == '*' {
 				ch := l.ch
@@ -58,6 +74,16 @@ func (l *Lexer) NextToken() token.Token {
 			tok = newTokenChar(token.SLASH, l.ch)
 		case '%':
 			tok = newTokenChar(token.MOD, l.ch)
+		case '|':
+			if l.peekChar() == '>' {
+				ch := l.ch
+				l.readChar()
+				tok = newTokenStr(token.PIPE, string(ch) + string(l.ch))
+			} else {
+				tok = newTokenChar(token.BAR, l.ch)
+			}
+		case '&':
+			tok = newTokenChar(token.AMPERSAND, l.ch)
 		case '!':
 			if l.peekChar() == '=' {
 				ch := l.ch
@@ -180,6 +206,10 @@ func (l *Lexer) readString() string {
 	position := l.position + 1
 	for {
 		l.readChar()
+		if l.ch == '\n' {
+			l.line++
+			l.lineStart = l.position + 1
+		}
 		if l.ch == '"' || l.ch == 0 {
 			l.readChar()
 			break
@@ -188,11 +218,19 @@ func (l *Lexer) readString() string {
 	return l.input[position:l.position - 1]
 }
 
-// skipWhitespace skips any whitespace characters in the input
+// skipWhitespace skips blanks and # comments, which run to the end of the line
 func (l *Lexer) skipWhitespace() {
-	for l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r' {
+	for l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r' || l.ch == '#' {
+		if l.ch == '#' {
+			for l.ch != '\n' && l.ch != 0 {
+				l.readChar()
+			}
+			continue
+		}
+
 		if l.ch == '\n' {
 			l.line++
+			l.lineStart = l.position + 1
 		}
 		l.readChar()
 	}
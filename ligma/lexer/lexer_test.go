@@ -6,38 +6,98 @@ import (
 	"ligma/token"
 )
 
-func TestNextToken(t *testing.T) {
-	input := `
-	class Res : Base {}
-
-	`
+// expectedToken is a token the lexer should produce and where it starts
+type expectedToken struct {
+	expectedType    token.TokenType
+	expectedLiteral string
+	expectedLine    int
+	expectedColumn  int
+}
 
+func TestNextToken(t *testing.T) {
 	tests := []struct {
-		expectedType    token.TokenType
-		expectedLiteral string
+		input  string
+		tokens []expectedToken
 	}{
-		{token.CLASS, "class"},
-		{token.IDENT, "Res"},
-		{token.COLON, ":"},
-		{token.IDENT, "Base"},
-		{token.LBRACE, "{"},
-		{token.RBRACE, "}"},
-		{token.EOF, ""},
+		{"\n\tclass Res : Base {}\n\n\t", []expectedToken{
+			{token.CLASS, "class", 2, 2},
+			{token.IDENT, "Res", 2, 8},
+			{token.COLON, ":", 2, 12},
+			{token.IDENT, "Base", 2, 14},
+			{token.LBRACE, "{", 2, 19},
+			{token.RBRACE, "}", 2, 20},
+			{token.EOF, "", 4, 2},
+		}},
+		{"xs |> f(1)", []expectedToken{
+			{token.IDENT, "xs", 1, 1},
+			{token.PIPE, "|>", 1, 4},
+			{token.IDENT, "f", 1, 7},
+			{token.LPAREN, "(", 1, 8},
+			{token.INT, "1", 1, 9},
+			{token.RPAREN, ")", 1, 10},
+			{token.EOF, "", 1, 11},
+		}},
+		{"func(x: int) -> int", []expectedToken{
+			{token.FUNCTION, "func", 1, 1},
+			{token.LPAREN, "(", 1, 5},
+			{token.IDENT, "x", 1, 6},
+			{token.COLON, ":", 1, 7},
+			{token.IDENT, "int", 1, 9},
+			{token.RPAREN, ")", 1, 12},
+			{token.ARROW, "->", 1, 14},
+			{token.IDENT, "int", 1, 17},
+			{token.EOF, "", 1, 20},
+		}},
+		{"def a = 1\n  assert a == \"x\ny\", b", []expectedToken{
+			{token.DEF, "def", 1, 1},
+			{token.IDENT, "a", 1, 5},
+			{token.ASSIGN, "=", 1, 7},
+			{token.INT, "1", 1, 9},
+			{token.ASSERT, "assert", 2, 3},
+			{token.IDENT, "a", 2, 10},
+			{token.EQ, "==", 2, 12},
+			{token.STRING, "x\ny", 2, 15},
+			{token.COMMA, ",", 3, 3},
+			{token.IDENT, "b", 3, 5},
+			{token.EOF, "", 3, 6},
+		}},
+		{"a | b & c", []expectedToken{
+			{token.IDENT, "a", 1, 1},
+			{token.BAR, "|", 1, 3},
+			{token.IDENT, "b", 1, 5},
+			{token.AMPERSAND, "&", 1, 7},
+			{token.IDENT, "c", 1, 9},
+			{token.EOF, "", 1, 10},
+		}},
+		{"# leading comment\ndef a = 1 # trailing comment\n#", []expectedToken{
+			{token.DEF, "def", 2, 1},
+			{token.IDENT, "a", 2, 5},
+			{token.ASSIGN, "=", 2, 7},
+			{token.INT, "1", 2, 9},
+			{token.EOF, "", 3, 2},
+		}},
 	}
 
-	l := New(input)
+	for _, tc := range tests {
+		l := New(tc.input)
 
-	for i, tt := range tests {
-		tok := l.NextToken()
+		for i, tt := range tc.tokens {
+			tok := l.NextToken()
 
-		if tok.Type != tt.expectedType {
-			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
-				i, tt.expectedType, tok.Type)
-		}
+			if tok.Type != tt.expectedType {
+				t.Fatalf("%q: tests[%d] - tokentype wrong. expected=%q, got=%q",
+					tc.input, i, tt.expectedType, tok.Type)
+			}
+
+			if tok.Literal != tt.expectedLiteral {
+				t.Fatalf("%q: tests[%d] - literal wrong. expected=%q, got=%q",
+					tc.input, i, tt.expectedLiteral, tok.Literal)
+			}
 
-		if tok.Literal != tt.expectedLiteral {
-			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
-				i, tt.expectedLiteral, tok.Literal)
+			if tok.Line != tt.expectedLine || tok.Column != tt.expectedColumn {
+				t.Fatalf("%q: tests[%d] - position wrong. expected=%d:%d, got=%d:%d",
+					tc.input, i, tt.expectedLine, tt.expectedColumn, tok.Line, tok.Column)
+			}
 		}
 	}
-}
\ No newline at end of file
+}
@@ -1,20 +1,81 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"ligma/repl"
+	"ligma/runtime"
 	"os"
+	"strings"
 )
 
 func main(){
-	
+	checkTypes := flag.Bool("check-types", false, "check annotated argument and return types at call boundaries")
+	noAssert := flag.Bool("no-assert", false, "skip assert statements")
+	optimize := flag.Bool("O", false, "optimize the program before running it")
+	useVM := flag.Bool("vm", false, "compile the program to bytecode and run it on the VM")
+	flag.Parse()
+
+	opts := repl.Options{CheckTypes: *checkTypes, SkipAssertions: *noAssert, Optimize: *optimize, VM: *useVM}
+
+	// ligma typecheck script.lg
+	if flag.Arg(0) == "typecheck" && flag.NArg() > 1 {
+		if !repl.TypecheckFile(flag.Arg(1), os.Stdout) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	// ligma lint [-disable rules] [-only rules] script.lg
+	if flag.Arg(0) == "lint" {
+		os.Exit(lint(flag.Args()[1:]))
+	}
+
 	// ccheck if a file was passed as an argument
-	if len(os.Args) > 1 {
-		repl.RunFile(os.Args[1])
+	if flag.NArg() > 0 {
+		if !repl.RunFile(flag.Arg(0), opts) {
+			os.Exit(1)
+		}
 		return
 	}
 
 	fmt.Printf("Hello! This is the Ligma programming language!\n")
 	fmt.Printf("Let's get ballin'!\n\n")
-	repl.Start(os.Stdin, os.Stdout)
-}
\ No newline at end of file
+	repl.Start(os.Stdin, os.Stdout, opts)
+}
+
+// lint runs the lint subcommand and returns the exit code
+func lint(args []string) int {
+	flags := flag.NewFlagSet("lint", flag.ExitOnError)
+	disable := flags.String("disable", "", "comma separated lint rules to skip")
+	only := flags.String("only", "", "comma separated lint rules to run, all others are skipped")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		fmt.Println("usage: ligma lint [-disable rules] [-only rules] script.lg")
+		fmt.Println("rules:", strings.Join(runtime.LintRules, ", "))
+		return 2
+	}
+
+	linter := runtime.NewLinter()
+
+	if *only != "" {
+		linter.Disable(runtime.LintRules...)
+		if err := linter.Enable(strings.Split(*only, ",")...); err != nil {
+			fmt.Println(err)
+			return 2
+		}
+	}
+
+	if *disable != "" {
+		if err := linter.Disable(strings.Split(*disable, ",")...); err != nil {
+			fmt.Println(err)
+			return 2
+		}
+	}
+
+	if !repl.LintFile(flags.Arg(0), os.Stdout, linter) {
+		return 1
+	}
+	return 0
+}
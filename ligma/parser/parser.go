@@ -16,8 +16,10 @@ type (
 const (
 	_ int = iota
 	LOWEST
+	PIPELINE
 	EQUALS
 	LESSGREATER
+	BITWISE
 	SUM
 	PRODUCT
 	PREFIX
@@ -35,6 +37,8 @@ var precedences = map[token.TokenType]int{
 	token.GT: LESSGREATER,
 	token.GTE: LESSGREATER,
 	token.LTE: LESSGREATER,
+	token.BAR: BITWISE,
+	token.AMPERSAND: BITWISE,
 	token.PLUS: SUM,
 	token.MINUS: SUM,
 	token.SLASH: PRODUCT,
@@ -47,6 +51,10 @@ var precedences = map[token.TokenType]int{
 	token.LBRACKET: INDEX,
 	token.DOT: CALL, // Might change this later TODO
 	token.ASSIGN: EQUALS,
+	token.PIPE: PIPELINE,
+	token.IMPLEMENTS: LESSGREATER,
+	token.IN: LESSGREATER,
+	token.NOT: LESSGREATER, // only as `not in`
 }
 
 type Parser struct {
@@ -58,6 +66,9 @@ type Parser struct {
 
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns map[token.TokenType]infixParseFn
+
+	// sawYield is set when a yield is parsed, it marks the enclosing function as a generator
+	sawYield bool
 }
 
 func New(l *lexer.Lexer) *Parser {
@@ -84,6 +95,7 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.SELF, p.parseSelf)
 	p.registerPrefix(token.SUPER, p.parseSuper)
 	p.registerPrefix(token.LBRACE, p.parseMapLiteral)
+	p.registerPrefix(token.YIELD, p.parseYieldExpression)
 	
 
 	p.infixParseFns = make(map[token.TokenType]infixParseFn)
@@ -92,6 +104,8 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.SLASH, p.parseInfixExpression)
 	p.registerInfix(token.ASTERISK, p.parseInfixExpression)
 	p.registerInfix(token.MOD, p.parseInfixExpression)
+	p.registerInfix(token.BAR, p.parseInfixExpression)
+	p.registerInfix(token.AMPERSAND, p.parseInfixExpression)
 	p.registerInfix(token.POW, p.parseInfixExpression)
 	p.registerInfix(token.EQ, p.parseInfixExpression)
 	p.registerInfix(token.NOT_EQ, p.parseInfixExpression)
@@ -105,6 +119,10 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
 	p.registerInfix(token.DOT, p.parseGetExpression)
 	p.registerInfix(token.ASSIGN, p.parseAssignmentExpression)
+	p.registerInfix(token.PIPE, p.parsePipeExpression)
+	p.registerInfix(token.IMPLEMENTS, p.parseInfixExpression)
+	p.registerInfix(token.IN, p.parseInfixExpression)
+	p.registerInfix(token.NOT, p.parseNotInExpression)
 	return p
 }
 
@@ -153,21 +171,36 @@ func (p *Parser) parseStatement() runtime.Statement {
 	//}
 
 	switch p.curToken.Type {
-	case token.DEF:
+	case token.DEF, token.CONST:
+		if p.peekTokenIs(token.LPAREN) {
+			return p.parseUnpackStatement()
+		}
 		return p.parseDefStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
 	case token.WHILE:
 		return p.parseWhileStatement()
+	case token.FOR:
+		return p.parseForStatement()
 	case token.CLASS:
 		return p.parseClassStatement()
+	case token.ENUM:
+		return p.parseEnumStatement()
+	case token.RECORD:
+		return p.parseRecordStatement()
+	case token.INTERFACE:
+		return p.parseInterfaceStatement()
+	case token.WITH:
+		return p.parseWithStatement()
+	case token.ASSERT:
+		return p.parseAssertStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
 }
 
 func (p *Parser) parseDefStatement() *runtime.DefStatement {
-	stmt := &runtime.DefStatement{Token: p.curToken}
+	stmt := &runtime.DefStatement{Token: p.curToken, Constant: p.curTokenIs(token.CONST)}
 
 	if !p.expectPeek(token.IDENT) {
 		return nil
@@ -175,6 +208,22 @@ func (p *Parser) parseDefStatement() *runtime.DefStatement {
 
 	stmt.Name = &runtime.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 
+	// optional type annotation, `def x: int = 5`
+	if p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		p.nextToken()
+
+		stmt.Type = p.parseTypeAnnotation()
+		if stmt.Type == nil {
+			return nil
+		}
+	}
+
+	if !p.peekTokenIs(token.ASSIGN) && stmt.Constant {
+		p.errors = append(p.errors, fmt.Sprintf("constant %s needs a value", stmt.Name.Value))
+		return nil
+	}
+
 	if !p.peekTokenIs(token.ASSIGN) {
 		
 		// if there is no assignment initialize the value to null
@@ -200,6 +249,49 @@ func (p *Parser) parseDefStatement() *runtime.DefStatement {
 
 }
 
+// parseUnpackStatement parses `def (q, r) = divmod(7, 2);`, binding the
+// elements of a tuple or list to several names at once
+func (p *Parser) parseUnpackStatement() runtime.Statement {
+	stmt := &runtime.UnpackStatement{Token: p.curToken, Constant: p.curTokenIs(token.CONST)}
+
+	p.nextToken()
+
+	for {
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		stmt.Targets = append(stmt.Targets, &runtime.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
+		p.nextToken()
+
+		// trailing comma
+		if p.peekTokenIs(token.RPAREN) {
+			break
+		}
+	}
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.ASSIGN) {
+		return nil
+	}
+
+	p.nextToken()
+
+	stmt.Value = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
 func (p *Parser) parseClassStatement() *runtime.Class {
 	stmt := &runtime.Class{Token: p.curToken}
 
@@ -216,27 +308,212 @@ func (p *Parser) parseClassStatement() *runtime.Class {
 		stmt.Superclass = &runtime.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 	}
 
+	if p.peekTokenIs(token.IMPLEMENTS) {
+		p.nextToken()
+		stmt.Interfaces = p.parseIdentifierList()
+		if stmt.Interfaces == nil {
+			return nil
+		}
+	}
+
 	if !p.expectPeek(token.LBRACE) {
 		return nil
 	}
 	p.nextToken()
 
 	methods := []*runtime.DefStatement{}
+	fields := []*runtime.DefStatement{}
 
 	for !p.curTokenIs(token.RBRACE) {
-		method := p.parseDefStatement()
-		if method != nil {
-			methods = append(methods, method)
+		// abstract def name, a method without a body
+		if p.curTokenIs(token.ABSTRACT) {
+			if !p.expectPeek(token.DEF) || !p.expectPeek(token.IDENT) {
+				return nil
+			}
+			stmt.Abstract = append(stmt.Abstract, &runtime.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+			if p.peekTokenIs(token.SEMICOLON) {
+				p.nextToken()
+			}
+			p.nextToken()
+			continue
+		}
+
+		// get name = func() {...} and set name = func(value) {...}, get and
+		// set are only keywords here
+		if p.curTokenIs(token.IDENT) && (p.curToken.Literal == "get" || p.curToken.Literal == "set") && p.peekTokenIs(token.IDENT) {
+			accessor := p.parseAccessor()
+			if accessor == nil {
+				return nil
+			}
+
+			if accessor.Token.Literal == "get" {
+				stmt.Getters = append(stmt.Getters, accessor)
+			} else {
+				stmt.Setters = append(stmt.Setters, accessor)
+			}
+			p.nextToken()
+			continue
+		}
+
+		def := p.parseDefStatement()
+		if def != nil {
+			// anything that isn't a function is a field declaration
+			if _, ok := def.Value.(*runtime.FunctionLiteral); ok {
+				methods = append(methods, def)
+			} else {
+				fields = append(fields, def)
+			}
 		}
 		p.nextToken()
 	}
 
 	stmt.Methods = methods
+	stmt.Fields = fields
+
+	return stmt
+}
+
+
+// parseAccessor parses a property getter or setter in a class body
+func (p *Parser) parseAccessor() *runtime.DefStatement {
+	accessor := p.parseDefStatement()
+	if accessor == nil {
+		return nil
+	}
+
+	fn, ok := accessor.Value.(*runtime.FunctionLiteral)
+	if !ok {
+		p.errors = append(p.errors, fmt.Sprintf("%s %s must be a function", accessor.Token.Literal, accessor.Name.Value))
+		return nil
+	}
+
+	if accessor.Token.Literal == "get" && len(fn.Parameters) != 0 {
+		p.errors = append(p.errors, fmt.Sprintf("getter %s takes no parameters", accessor.Name.Value))
+		return nil
+	}
+
+	if accessor.Token.Literal == "set" && len(fn.Parameters) != 1 {
+		p.errors = append(p.errors, fmt.Sprintf("setter %s takes exactly one parameter", accessor.Name.Value))
+		return nil
+	}
+
+	return accessor
+}
+
+// parseIdentifierList parses a comma separated list of names, nil on error
+func (p *Parser) parseIdentifierList() []*runtime.Identifier {
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+
+	identifiers := []*runtime.Identifier{{Token: p.curToken, Value: p.curToken.Literal}}
+
+	for p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+
+		identifiers = append(identifiers, &runtime.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+	}
+
+	return identifiers
+}
+
+// parseRecordStatement parses record Name(field, other: type)
+func (p *Parser) parseRecordStatement() *runtime.RecordStatement {
+	stmt := &runtime.RecordStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+
+	stmt.Name = &runtime.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	stmt.Fields = p.parseFunctionParameters()
+	if stmt.Fields == nil {
+		return nil
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
 
 	return stmt
 }
 
+// parseInterfaceStatement parses interface Name { method; other }
+func (p *Parser) parseInterfaceStatement() *runtime.InterfaceStatement {
+	stmt := &runtime.InterfaceStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+
+	stmt.Name = &runtime.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+
+		stmt.Methods = append(stmt.Methods, &runtime.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+
+		if p.peekTokenIs(token.SEMICOLON) || p.peekTokenIs(token.COMMA) {
+			p.nextToken()
+		}
+	}
+	p.nextToken()
+
+	return stmt
+}
+
+// parseEnumStatement parses enum Name { A, B = expr, C }
+func (p *Parser) parseEnumStatement() *runtime.EnumStatement {
+	stmt := &runtime.EnumStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+
+	stmt.Name = &runtime.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+
+		member := &runtime.EnumMember{Name: &runtime.Identifier{Token: p.curToken, Value: p.curToken.Literal}}
+
+		if p.peekTokenIs(token.ASSIGN) {
+			p.nextToken()
+			p.nextToken()
+			member.Value = p.parseExpression(LOWEST)
+		}
 
+		stmt.Members = append(stmt.Members, member)
+
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+	p.nextToken()
+
+	return stmt
+}
 
 /* func (p *Parser) parseAssignmentStatement() *runtime.AssignmentStatement {
 	stmt := &runtime.AssignmentStatement{Token: p.curToken}
@@ -272,6 +549,26 @@ func (p *Parser) parseReturnStatement() *runtime.ReturnStatement {
 	return stmt
 }
 
+// parseAssertStatement parses assert condition [, message]
+func (p *Parser) parseAssertStatement() *runtime.AssertStatement {
+	stmt := &runtime.AssertStatement{Token: p.curToken}
+
+	p.nextToken()
+	stmt.Condition = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		p.nextToken()
+		stmt.Message = p.parseExpression(LOWEST)
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
 func (p *Parser) parseWhileStatement() *runtime.WhileStatement {
 	stmt := &runtime.WhileStatement{Token: p.curToken}
 
@@ -296,6 +593,67 @@ func (p *Parser) parseWhileStatement() *runtime.WhileStatement {
 	return stmt
 }
 
+// parseForStatement parses for (x, y in iterable) { ... }
+func (p *Parser) parseForStatement() *runtime.ForStatement {
+	stmt := &runtime.ForStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	stmt.Targets, stmt.Iterable = p.parseIterationTargets()
+	if stmt.Targets == nil {
+		return nil
+	}
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	stmt.Body = p.parseBlockStatement()
+
+	return stmt
+}
+
+func (p *Parser) parseWithStatement() *runtime.WithStatement {
+	stmt := &runtime.WithStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+
+	stmt.Manager = p.parseExpression(LOWEST)
+
+	// the 'as' binding is optional
+	if p.peekTokenIs(token.AS) {
+		p.nextToken()
+
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+
+		stmt.Name = &runtime.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	}
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	stmt.Body = p.parseBlockStatement()
+
+	return stmt
+}
+
 func (p *Parser) parseAssignmentExpression(left runtime.Expression) runtime.Expression {
 
 	switch left.(type) {
@@ -383,11 +741,69 @@ func (p *Parser) parseInfixExpression(left runtime.Expression) runtime.Expressio
 	return expression
 }
 
+// parseNotInExpression parses `x not in xs` into an infix expression with the operator "not in"
+func (p *Parser) parseNotInExpression(left runtime.Expression) runtime.Expression {
+	expression := &runtime.InfixExpression{Token: p.curToken, Left: left}
+
+	if !p.expectPeek(token.IN) {
+		return nil
+	}
+	expression.Operator = "not in"
+
+	precedence := p.curPrecedence()
+	p.nextToken()
+
+	expression.Right = p.parseExpression(precedence)
+
+	return expression
+}
+
+func (p *Parser) parsePipeExpression(left runtime.Expression) runtime.Expression {
+	expression := &runtime.PipeExpression{Token: p.curToken, Left: left}
+
+	precedence := p.curPrecedence()
+	p.nextToken()
+
+	expression.Right = p.parseExpression(precedence)
+
+	return expression
+}
+
 func (p *Parser) parseGroupedExpression() runtime.Expression {
+	tok := p.curToken
+
+	// `()` is the empty tuple
+	if p.peekTokenIs(token.RPAREN) {
+		p.nextToken()
+		return &runtime.TupleLiteral{Token: tok, Elements: []runtime.Expression{}}
+	}
+
 	p.nextToken()
 
 	exp := p.parseExpression(LOWEST)
 
+	// a comma turns the parentheses into a tuple, `(a,)` has a single element
+	if p.peekTokenIs(token.COMMA) {
+		tuple := &runtime.TupleLiteral{Token: tok, Elements: []runtime.Expression{exp}}
+
+		for p.peekTokenIs(token.COMMA) {
+			p.nextToken()
+
+			if p.peekTokenIs(token.RPAREN) {
+				break
+			}
+
+			p.nextToken()
+			tuple.Elements = append(tuple.Elements, p.parseExpression(LOWEST))
+		}
+
+		if !p.expectPeek(token.RPAREN) {
+			return nil
+		}
+
+		return tuple
+	}
+
 	if !p.expectPeek(token.RPAREN) {
 		return nil
 	}
@@ -446,7 +862,10 @@ func (p *Parser) parseIndexExpression(left runtime.Expression) runtime.Expressio
 func (p *Parser) parseGetExpression(left runtime.Expression) runtime.Expression {
 	exp := &runtime.GetExpression{Token: p.curToken, Object: left}
 
-	if !p.expectPeek(token.IDENT) {
+	// keywords are fine as property names, `p.with(...)`
+	if p.peekToken.Type != token.IDENT && token.LookupIdent(p.peekToken.Literal) == p.peekToken.Type {
+		p.nextToken()
+	} else if !p.expectPeek(token.IDENT) {
 		return nil
 	}
 
@@ -482,15 +901,48 @@ func (p *Parser) parseFunctionLiteral() runtime.Expression {
 
 	lit.Parameters = p.parseFunctionParameters()
 
+	// optional return type, `func(a) -> int { ... }`
+	if p.peekTokenIs(token.ARROW) {
+		p.nextToken()
+		p.nextToken()
+
+		lit.ReturnType = p.parseTypeAnnotation()
+		if lit.ReturnType == nil {
+			return nil
+		}
+	}
+
 	if !p.expectPeek(token.LBRACE) {
 		return nil
 	}
 
+	enclosingYield := p.sawYield
+	p.sawYield = false
+
 	lit.Body = p.parseBlockStatement()
+	lit.IsGenerator = p.sawYield
+
+	p.sawYield = enclosingYield
 
 	return lit
 }
 
+// parseYieldExpression parses yield [value], the value is left out before a closing token
+func (p *Parser) parseYieldExpression() runtime.Expression {
+	expr := &runtime.YieldExpression{Token: p.curToken}
+	p.sawYield = true
+
+	switch p.peekToken.Type {
+	case token.SEMICOLON, token.RBRACE, token.RPAREN, token.RBRACKET, token.COMMA, token.EOF:
+		return expr
+	}
+
+	p.nextToken()
+	expr.Value = p.parseExpression(LOWEST)
+
+	return expr
+}
+
 func (p *Parser) parseFunctionParameters() []*runtime.Identifier {
 	identifiers := []*runtime.Identifier{}
 
@@ -501,14 +953,12 @@ func (p *Parser) parseFunctionParameters() []*runtime.Identifier {
 
 	p.nextToken()
 
-	ident := &runtime.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-	identifiers = append(identifiers, ident)
+	identifiers = append(identifiers, p.parseParameter())
 
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken()
 		p.nextToken()
-		ident := &runtime.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-		identifiers = append(identifiers, ident)
+		identifiers = append(identifiers, p.parseParameter())
 	}
 
 	if !p.expectPeek(token.RPAREN) {
@@ -518,6 +968,60 @@ func (p *Parser) parseFunctionParameters() []*runtime.Identifier {
 	return identifiers
 }
 
+// parseParameter parses a parameter name and its optional annotation, `a: int`
+func (p *Parser) parseParameter() *runtime.Identifier {
+	ident := &runtime.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		p.nextToken()
+		ident.Type = p.parseTypeAnnotation()
+	}
+
+	return ident
+}
+
+// parseTypeAnnotation parses a type such as `int` or `map[str, list[int]]`,
+// the current token is the first token of the type
+func (p *Parser) parseTypeAnnotation() *runtime.TypeAnnotation {
+	switch p.curToken.Type {
+	case token.IDENT, token.NULL, token.FUNCTION:
+	default:
+		msg := fmt.Sprintf("expected a type, got %s instead", p.curToken.Type)
+		p.errors = append(p.errors, msg)
+		return nil
+	}
+
+	annotation := &runtime.TypeAnnotation{Token: p.curToken, Name: p.curToken.Literal}
+
+	if !p.peekTokenIs(token.LBRACKET) {
+		return annotation
+	}
+
+	p.nextToken()
+
+	for {
+		p.nextToken()
+
+		param := p.parseTypeAnnotation()
+		if param == nil {
+			return nil
+		}
+		annotation.Params = append(annotation.Params, param)
+
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
+		p.nextToken()
+	}
+
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+
+	return annotation
+}
+
 func (p *Parser) parseCallExpression(function runtime.Expression) runtime.Expression {
 	exp := &runtime.CallExpression{Token: p.curToken, Function: function}
 	exp.Arguments = p.parseExpressionList(token.RPAREN)
@@ -587,10 +1091,93 @@ func (p *Parser) parseStringLiteral() runtime.Expression {
 
 func (p *Parser) parseListLiteral() runtime.Expression {
 	list := &runtime.ListLiteral{Token: p.curToken}
-	list.Elements = p.parseExpressionList(token.RBRACKET)
+
+	if p.peekTokenIs(token.RBRACKET) {
+		p.nextToken()
+		list.Elements = []runtime.Expression{}
+		return list
+	}
+
+	p.nextToken()
+	first := p.parseExpression(LOWEST)
+
+	// [element for x in xs if cond]
+	if p.peekTokenIs(token.FOR) {
+		comp := &runtime.ListComprehension{Token: list.Token, Element: first}
+
+		comp.Targets, comp.Iterable, comp.Condition = p.parseComprehensionClause()
+		if comp.Targets == nil {
+			return nil
+		}
+
+		if !p.expectPeek(token.RBRACKET) {
+			return nil
+		}
+
+		return comp
+	}
+
+	list.Elements = []runtime.Expression{first}
+
+	for p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		p.nextToken()
+		list.Elements = append(list.Elements, p.parseExpression(LOWEST))
+	}
+
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+
 	return list
 }
 
+// parseComprehensionClause parses the `for a, b in iterable if condition` tail
+// of a comprehension, the current token is the last token of the element
+func (p *Parser) parseComprehensionClause() ([]*runtime.Identifier, runtime.Expression, runtime.Expression) {
+	p.nextToken()
+
+	targets, iterable := p.parseIterationTargets()
+	if targets == nil {
+		return nil, nil, nil
+	}
+
+	var condition runtime.Expression
+	if p.peekTokenIs(token.IF) {
+		p.nextToken()
+		p.nextToken()
+		condition = p.parseExpression(LOWEST)
+	}
+
+	return targets, iterable, condition
+}
+
+// parseIterationTargets parses `x, y in iterable`, the targets are nil on error
+func (p *Parser) parseIterationTargets() ([]*runtime.Identifier, runtime.Expression) {
+	if !p.expectPeek(token.IDENT) {
+		return nil, nil
+	}
+
+	targets := []*runtime.Identifier{{Token: p.curToken, Value: p.curToken.Literal}}
+
+	for p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+
+		if !p.expectPeek(token.IDENT) {
+			return nil, nil
+		}
+
+		targets = append(targets, &runtime.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+	}
+
+	if !p.expectPeek(token.IN) {
+		return nil, nil
+	}
+
+	p.nextToken()
+	return targets, p.parseExpression(LOWEST)
+}
+
 func (p *Parser) parseMapLiteral() runtime.Expression {
 	map_ := &runtime.MapLiteral{Token: p.curToken}
 
@@ -600,6 +1187,11 @@ func (p *Parser) parseMapLiteral() runtime.Expression {
 		p.nextToken()
 		key := p.parseExpression(LOWEST)
 
+		// {a, b} without colons is a set
+		if len(map_.Pairs) == 0 && (p.peekTokenIs(token.COMMA) || p.peekTokenIs(token.RBRACE)) {
+			return p.parseSetLiteral(map_.Token, key)
+		}
+
 		if (!p.expectPeek(token.COLON)){
 			return nil
 		}
@@ -607,6 +1199,22 @@ func (p *Parser) parseMapLiteral() runtime.Expression {
 		p.nextToken()
 		value := p.parseExpression(LOWEST)
 
+		// {key: value for k, v in m if cond}
+		if len(map_.Pairs) == 0 && p.peekTokenIs(token.FOR) {
+			comp := &runtime.MapComprehension{Token: map_.Token, Key: key, Value: value}
+
+			comp.Targets, comp.Iterable, comp.Condition = p.parseComprehensionClause()
+			if comp.Targets == nil {
+				return nil
+			}
+
+			if !p.expectPeek(token.RBRACE) {
+				return nil
+			}
+
+			return comp
+		}
+
 		map_.Pairs[key] = value
 
 		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
@@ -622,6 +1230,29 @@ func (p *Parser) parseMapLiteral() runtime.Expression {
 	return map_
 }
 
+// parseSetLiteral parses the rest of `{a, b, c}` once the first element is read,
+// `{}` stays an empty map
+func (p *Parser) parseSetLiteral(tok token.Token, first runtime.Expression) runtime.Expression {
+	set := &runtime.SetLiteral{Token: tok, Elements: []runtime.Expression{first}}
+
+	for p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+
+		if p.peekTokenIs(token.RBRACE) {
+			break
+		}
+
+		p.nextToken()
+		set.Elements = append(set.Elements, p.parseExpression(LOWEST))
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+
+	return set
+}
+
 func (p *Parser) parseBoolean() runtime.Expression {
 	return &runtime.Boolean{Token: p.curToken, Value: p.curTokenIs(token.TRUE)}
 }
@@ -4,20 +4,61 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"ligma/compiler"
 	"ligma/lexer"
 	"ligma/parser"
 	"ligma/runtime"
+	"ligma/vm"
 	"os"
 )
 
 const PROMPT = ">> "
 
+// Options configures the interpreter used by Start and RunFile
+type Options struct {
+	// CheckTypes enables checking of annotated parameter and return types
+	CheckTypes bool
+
+	// SkipAssertions disables assert statements
+	SkipAssertions bool
+
+	// Optimize runs the Optimizer over the program before it is resolved
+	Optimize bool
+
+	// VM compiles the program to bytecode and runs it on the VM instead of
+	// walking its AST
+	VM bool
+}
+
+func newInterpreter(opts Options) *runtime.Interpreter {
+	i := runtime.NewInterpreter()
+	i.CheckTypes = opts.CheckTypes
+	i.SkipAssertions = opts.SkipAssertions
+	return i
+}
+
+// engine runs resolved programs with the interpreter or, if the options
+// ask for it, on the VM. The programs of one engine share their globals
+func engine(i *runtime.Interpreter, opts Options) func(*runtime.Program) runtime.LigmaObject {
+	if !opts.VM {
+		return i.Interpret
+	}
+
+	c := compiler.New(i)
+	machine := vm.New(i, c)
+	return func(program *runtime.Program) runtime.LigmaObject {
+		return machine.Run(c.Compile(program))
+	}
+}
+
 // Start starts the REPL
-func Start(in io.Reader, out io.Writer) {
+func Start(in io.Reader, out io.Writer, opts Options) {
 	scanner := bufio.NewScanner(in)
 	//env := runtime.NewEnvironment()
-	i := runtime.NewInterpreter()
+	i := newInterpreter(opts)
 	r := runtime.NewResolver(i)
+	o := runtime.NewOptimizer()
+	run := engine(i, opts)
 
 	for {
 		fmt.Print(PROMPT)
@@ -31,15 +72,30 @@ func Start(in io.Reader, out io.Writer) {
 		p := parser.New(l)
 
 
+		// like a line the resolver rejects, a line that doesn't parse is
+		// reported and skipped
 		program := p.ParseProgram()
 		if len(p.Errors()) != 0 {
 			printParserErrors(out, p.Errors())
-			os.Exit(1)
+			continue
 		}
 
-		r.Resolve(program.Statements)
+		if opts.Optimize {
+			o.Optimize(program)
+		}
 
-		evaluated := i.Interpret(program)
+		// a line the resolver rejects is not run, the session goes on
+		if diagnostics := r.Resolve(program.Statements); len(diagnostics) != 0 {
+			printDiagnostics(out, "", diagnostics)
+			continue
+		}
+
+		// flow problems don't stop the line from running
+		for _, d := range runtime.AnalyzeFlow(program.Statements) {
+			io.WriteString(out, "warning: " + d.String() + "\n")
+		}
+
+		evaluated := run(program)
 
 		if evaluated != nil {
 			switch evaluated.(type) {
@@ -58,38 +114,110 @@ func Start(in io.Reader, out io.Writer) {
 	}
 }
 
+// printParserErrors writes one parser error per line, the caller decides
+// whether to go on
 func printParserErrors(out io.Writer, errors []string) {
 	for _, msg := range errors {
 		io.WriteString(out, "\t" + msg + "\n")
 	}
+}
 
-	os.Exit(69)
+// printDiagnostics writes one diagnostic per line, prefixed with
+// where the code came from
+func printDiagnostics(out io.Writer, source string, diagnostics []runtime.Diagnostic) {
+	for _, d := range diagnostics {
+		if source != "" {
+			io.WriteString(out, source + ":")
+		}
+		io.WriteString(out, d.String() + "\n")
+	}
 }
 
-// run a script file
-func RunFile(path string) {
+// run a script file, it reports whether the script could be run at all
+func RunFile(path string, opts Options) bool {
 	data, err := os.ReadFile(path)
     if err != nil {
         fmt.Println("Error reading file:", err)
-        return
+        return false
     }
     
 	l := lexer.New(string(data))
 	p := parser.New(l)
-	i := runtime.NewInterpreter()
+	i := newInterpreter(opts)
 	r := runtime.NewResolver(i)
 
 	program := p.ParseProgram()
 
 	if len(p.Errors()) != 0 {
 		printParserErrors(os.Stdout, p.Errors())
-		return
+		return false
+	}
+
+	if opts.Optimize {
+		runtime.NewOptimizer().Optimize(program)
+	}
+
+	if diagnostics := r.Resolve(program.Statements); len(diagnostics) != 0 {
+		printDiagnostics(os.Stdout, path, diagnostics)
+		return false
 	}
 
-	r.Resolve(program.Statements)
+	evaluated := engine(i, opts)(program)
 
-	evaluated := i.Interpret(program)
+	// a failed assertion has been reported and ends the script
+	if runtime.IsFatal(evaluated) {
+		return false
+	}
 	if evaluated != nil {
 		fmt.Println(evaluated.Inspect())
 	}
-}
\ No newline at end of file
+	return true
+}
+
+// TypecheckFile runs the static type checker over a script without executing
+// it, every mismatch is printed to out. It reports whether the script is clean
+func TypecheckFile(path string, out io.Writer) bool {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(out, "Error reading file:", err)
+		return false
+	}
+
+	p := parser.New(lexer.New(string(data)))
+	program := p.ParseProgram()
+
+	if len(p.Errors()) != 0 {
+		printParserErrors(out, p.Errors())
+		return false
+	}
+
+	tc := runtime.NewTypeChecker()
+	tc.Check(program.Statements)
+
+	printDiagnostics(out, path, tc.Errors())
+
+	return len(tc.Errors()) == 0
+}
+
+// LintFile reports the warnings linter finds in a script without running it.
+// It reports whether the script is clean
+func LintFile(path string, out io.Writer, linter *runtime.Linter) bool {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(out, "Error reading file:", err)
+		return false
+	}
+
+	p := parser.New(lexer.New(string(data)))
+	program := p.ParseProgram()
+
+	if len(p.Errors()) != 0 {
+		printParserErrors(out, p.Errors())
+		return false
+	}
+
+	diagnostics := linter.Lint(program, string(data))
+	printDiagnostics(out, path, diagnostics)
+
+	return len(diagnostics) == 0
+}
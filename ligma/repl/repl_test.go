@@ -0,0 +1,68 @@
+package repl
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ligma/runtime"
+)
+
+func TestRunFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		opts     Options
+		expected bool
+	}{
+		{"clean script", `assert 1 < 2 print("ok")`, Options{}, true},
+		{"failed assertion", `assert 1 > 2 print("never")`, Options{}, false},
+		{"skipped assertion", `assert 1 > 2 print("ok")`, Options{SkipAssertions: true}, true},
+		{"other errors go on", `def f = 1 f() print("ok")`, Options{}, true},
+		{"resolver diagnostics", `return 1`, Options{}, false},
+		{"failed assertion on the vm", `assert 1 > 2 print("never")`, Options{VM: true}, false},
+	}
+
+	previous := runtime.Output
+	runtime.Output = io.Discard
+	defer func() { runtime.Output = previous }()
+
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "script.lg")
+		if err := os.WriteFile(path, []byte(tt.input), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		if ok := RunFile(path, tt.opts); ok != tt.expected {
+			t.Errorf("%s: RunFile returned %t, want %t", tt.name, ok, tt.expected)
+		}
+	}
+}
+
+func TestStartSkipsRejectedLines(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"constants", "const t = 1 t = 3\ndef t = 9\nprint(t)\n", "1:13: Can't assign to constant t.\n9\n"},
+		{"globals", "x = 1 return 2\nprint(x)\ndef x = 3\nprint(x)\n", "1:7: Can't return from top-level code.\n1:7: Undefined variable x.\n3\n"},
+	}
+
+	previous := runtime.Output
+	defer func() { runtime.Output = previous }()
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		runtime.Output = &out
+
+		Start(strings.NewReader(tt.input), &out, Options{})
+
+		if out.String() != tt.expected {
+			t.Errorf("%s: wrong output.\nexpected:\n%s\ngot:\n%s", tt.name, tt.expected, out.String())
+		}
+	}
+}
@@ -2,6 +2,7 @@ package runtime
 
 import (
 	"fmt"
+	"strings"
 )
 
 type MethodWrapper struct {
@@ -14,10 +15,36 @@ type LigmaClass struct {
 	Superclasses []*LigmaClass
 	//Methods map[string]*LigmaFunction
 	Methods ClassMethods
+	Fields []*DefStatement // declared fields, their values are evaluated for every new instance
+	fieldEnv *Environment // scope the field values are evaluated in
+	Members []*LigmaInstance // enum members in declaration order, nil for ordinary classes
+
+	Record []string // field names of a record in declaration order, nil for ordinary classes
+
+	Interfaces []*LigmaClass // interfaces the class declares to implement
+	Abstract []string // methods without an implementation, the class can't be instantiated
+	Interface bool
+
+	values []*LigmaInstance // shared instances of a value class, the small integers of int
 }
 
 func (c *LigmaClass) Call(i *Interpreter, args ...LigmaObject) LigmaObject {
+	if c.Members != nil {
+		return NewError("cannot instantiate enum %s", c.Name)
+	}
+
+	if c.Interface {
+		return NewError("cannot instantiate interface %s", c.Name)
+	}
+
+	if len(c.Abstract) > 0 {
+		return NewError("cannot instantiate abstract class %s, it doesn't implement %s", c.Name, strings.Join(c.Abstract, ", "))
+	}
+
 	instance := &LigmaInstance{Class: c, Fields: map[string]LigmaObject{}, interpreter: i}
+	if err := c.initFields(i, instance); err != nil {
+		return err
+	}
 
 	/* constructor, ok := c.Methods["init"]
 	if ok {
@@ -28,7 +55,17 @@ func (c *LigmaClass) Call(i *Interpreter, args ...LigmaObject) LigmaObject {
 	// check if the class has an init user defined method
 	constructor, ok := c.Methods.UserDefinedMethods["init"]
 	if ok {
-		(*constructor).Bind(instance).Call(i, args...)
+		init := (*constructor).Bind(instance)
+
+		// with type checks the constructor is checked like any other call
+		if i != nil && i.CheckTypes {
+			if result := ApplyFunction(i, init, args); isError(result) {
+				return result
+			}
+			return instance
+		}
+
+		init.Call(i, args...)
 		return instance
 	}
 
@@ -78,6 +115,128 @@ func (c *LigmaClass) GetMethod(name string) *MethodWrapper {
 	return nil
 }
 
+// PropertyCache remembers what a property access site last found on the
+// class of the object, so the next access to an instance of the same class
+// skips the walk through the superclasses. A class that is defined again is
+// a new LigmaClass, entries for the old one stop matching
+type PropertyCache struct {
+	class  *LigmaClass
+	getter *LigmaFunction
+	setter *LigmaFunction
+	method *MethodWrapper
+}
+
+// lookup fills the cache for name on class, unless it already holds it
+func (c *PropertyCache) lookup(class *LigmaClass, name string) {
+	if c.class == class {
+		return
+	}
+
+	c.class = class
+	c.getter = class.Getter(name)
+	c.setter = class.Setter(name)
+	c.method = class.GetMethod(name)
+}
+
+// accessors are stored with the methods under a name no identifier can
+// have, so they are inherited the same way through GetMethod
+func accessorName(kind string, name string) string {
+	return kind + " " + name
+}
+
+// Getter returns the property getter for name, if the class or an ancestor defines one
+func (c *LigmaClass) Getter(name string) *LigmaFunction {
+	if method := c.GetMethod(accessorName("get", name)); method != nil {
+		return method.UserMethod
+	}
+	return nil
+}
+
+// Setter returns the property setter for name, if the class or an ancestor defines one
+func (c *LigmaClass) Setter(name string) *LigmaFunction {
+	if method := c.GetMethod(accessorName("set", name)); method != nil {
+		return method.UserMethod
+	}
+	return nil
+}
+
+// Member returns the enum member called name
+func (c *LigmaClass) Member(name string) (*LigmaInstance, bool) {
+	for _, member := range c.Members {
+		if member.Fields["name"].(*LigmaInstance).Fields["value"].(*LigmaString).Value == name {
+			return member, true
+		}
+	}
+	return nil, false
+}
+
+// initFields evaluates the declared fields for a new instance, superclass
+// fields first so subclasses can override them. Every instance gets values
+// of its own, a list default is not shared between them
+func (c *LigmaClass) initFields(i *Interpreter, instance *LigmaInstance) LigmaObject {
+	for _, superclass := range c.Superclasses {
+		if err := superclass.initFields(i, instance); err != nil {
+			return err
+		}
+	}
+
+	if len(c.Fields) == 0 {
+		return nil
+	}
+
+	previous := i.Env
+	i.Env = c.fieldEnv
+	defer func() { i.Env = previous }()
+
+	for _, field := range c.Fields {
+		value := i.EvaluateExpression(field.Value)
+		if isError(value) {
+			return value
+		}
+		instance.Fields[field.Name.Value] = value
+	}
+	return nil
+}
+
+// IsSubclassOf reports whether the class, or any class it inherits from, is called name
+func (c *LigmaClass) IsSubclassOf(name string) bool {
+	if c.Name == name {
+		return true
+	}
+
+	for _, superclass := range c.Superclasses {
+		if superclass.IsSubclassOf(name) {
+			return true
+		}
+	}
+
+	for _, iface := range c.Interfaces {
+		if iface.IsSubclassOf(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// missingMethods lists the abstract methods of the superclasses and
+// interfaces that neither the class nor its ancestors implement
+func (c *LigmaClass) missingMethods() []string {
+	missing := []string{}
+	seen := map[string]bool{}
+
+	parents := append(append([]*LigmaClass{}, c.Superclasses...), c.Interfaces...)
+	for _, parent := range parents {
+		for _, name := range parent.Abstract {
+			if !seen[name] && c.GetMethod(name) == nil {
+				missing = append(missing, name)
+			}
+			seen[name] = true
+		}
+	}
+
+	return missing
+}
+
 func (c *LigmaClass) Arity() int { 
 
 	// check if the class has an init user defined method
@@ -106,6 +265,10 @@ type LigmaInstance struct {
 	Fields map[string]LigmaObject
 
 	interpreter *Interpreter
+
+	immutable bool // a shared int, float or str value
+
+	bound map[*LigmaFunction]*LigmaFunction // methods bound to the instance so far
 }
 
 func (i *LigmaInstance) Inspect() string {
@@ -124,7 +287,7 @@ func (i *LigmaInstance) Get(name string) (LigmaObject, bool) {
 	if method != nil {
 		//return method.Bind(i), true
 		if method.UserMethod != nil {
-			return method.UserMethod.Bind(i), true
+			return i.bind(method.UserMethod), true
 		}
 		if method.BuiltinMethod != nil {
 			return method.BuiltinMethod.Bind(i), true
@@ -134,36 +297,60 @@ func (i *LigmaInstance) Get(name string) (LigmaObject, bool) {
 	return &LigmaNull{}, false
 }
 
+// bind returns method bound to the instance. The scope holding self only
+// ever holds self, so a method is bound once and the same function is
+// handed out every time after
+func (i *LigmaInstance) bind(method *LigmaFunction) *LigmaFunction {
+	if bound, ok := i.bound[method]; ok {
+		return bound
+	}
+
+	if i.bound == nil {
+		i.bound = make(map[*LigmaFunction]*LigmaFunction)
+	}
+	bound := method.Bind(i)
+	i.bound[method] = bound
+	return bound
+}
+
 func (i *LigmaInstance) Set(name string, val LigmaObject) LigmaObject {
 	i.Fields[name] = val
 	return val
 }
 
-func (i *LigmaInstance) MapKey() MapKey {
-	var key MapKey
-
-	instanceValue := i.Fields["value"]
-
-	switch instanceValue.(type) {
+// hashKey hashes the value of builtin instances, other instances hash
+// through __hash__, which has to return an int. Instances with the same
+// hash are told apart by __eq__
+func (i *LigmaInstance) hashKey() (MapKey, LigmaObject) {
+	switch value := i.Fields["value"].(type) {
+	case *LigmaTuple:
+		return value.hashKey()
+	case LigmaHashable:
+		return value.MapKey(), nil
+	}
 
-	case *LigmaInteger:
-		key = instanceValue.(*LigmaInteger).MapKey()
-	case *LigmaString:
-		key = instanceValue.(*LigmaString).MapKey()
-	case *LigmaBoolean:
-		key = instanceValue.(*LigmaBoolean).MapKey()
-	
+	hash, ok := i.Get("__hash__")
+	if !ok {
+		return MapKey{}, NewError("unhashable type: %s", i.Class.Name)
 	}
 
-	return key
-	
+	result := ApplyFunction(i.interpreter, hash, []LigmaObject{})
+	if isError(result) {
+		return MapKey{}, result
+	}
+	if instance, ok := result.(*LigmaInstance); ok {
+		if value, ok := instance.Fields["value"].(*LigmaInteger); ok {
+			return MapKey{Type: i.Type(), Value: uint64(value.Value)}, nil
+		}
+	}
+	return MapKey{}, NewError("__hash__ of %s must return int, got %s", i.Class.Name, typeName(result))
 }
 
 func (i *LigmaInstance) Add (other LigmaObject) LigmaObject {
 	add_func, _ := i.Get("__add__")
 	switch add_func.(type) {
 	case *LigmaFunction:
-		return add_func.(*LigmaFunction).Bind(i).Call(nil, other)
+		return add_func.(*LigmaFunction).Call(i.interpreter, other)
 	case *BuiltinClassMethod:
 		return add_func.(*BuiltinClassMethod).Bind(i).Call(nil, other)
 	}
@@ -174,18 +361,40 @@ func (i *LigmaInstance) Sub (other LigmaObject) LigmaObject {
 	sub_func, _ := i.Get("__sub__")
 	switch sub_func.(type) {
 	case *LigmaFunction:
-		return sub_func.(*LigmaFunction).Bind(i).Call(nil, other)
+		return sub_func.(*LigmaFunction).Call(i.interpreter, other)
 	case *BuiltinClassMethod:
 		return sub_func.(*BuiltinClassMethod).Bind(i).Call(nil, other)
 	}
 	return &LigmaNull{}
 }
 
+func (i *LigmaInstance) Or (other LigmaObject) LigmaObject {
+	or_func, _ := i.Get("__or__")
+	switch or_func.(type) {
+	case *LigmaFunction:
+		return or_func.(*LigmaFunction).Call(i.interpreter, other)
+	case *BuiltinClassMethod:
+		return or_func.(*BuiltinClassMethod).Bind(i).Call(nil, other)
+	}
+	return &LigmaNull{}
+}
+
+func (i *LigmaInstance) And (other LigmaObject) LigmaObject {
+	and_func, _ := i.Get("__and__")
+	switch and_func.(type) {
+	case *LigmaFunction:
+		return and_func.(*LigmaFunction).Call(i.interpreter, other)
+	case *BuiltinClassMethod:
+		return and_func.(*BuiltinClassMethod).Bind(i).Call(nil, other)
+	}
+	return &LigmaNull{}
+}
+
 func (i *LigmaInstance) Eq (other LigmaObject) LigmaObject {
 	eq_func, _ := i.Get("__eq__")
 	switch eq_func.(type) {
 	case *LigmaFunction:
-		return eq_func.(*LigmaFunction).Bind(i).Call(nil, other)
+		return eq_func.(*LigmaFunction).Call(i.interpreter, other)
 	case *BuiltinClassMethod:
 		return eq_func.(*BuiltinClassMethod).Bind(i).Call(nil, other)
 	}
@@ -196,7 +405,7 @@ func (i *LigmaInstance) Ne (other LigmaObject) LigmaObject {
 	ne_func, _ := i.Get("__ne__")
 	switch ne_func.(type) {
 	case *LigmaFunction:
-		return ne_func.(*LigmaFunction).Bind(i).Call(nil, other)
+		return ne_func.(*LigmaFunction).Call(i.interpreter, other)
 	case *BuiltinClassMethod:
 		return ne_func.(*BuiltinClassMethod).Bind(i).Call(nil, other)
 	}
@@ -207,7 +416,7 @@ func (i *LigmaInstance) Mul (other LigmaObject) LigmaObject {
 	mul_func, _ := i.Get("__mul__")
 	switch mul_func.(type) {
 	case *LigmaFunction:
-		return mul_func.(*LigmaFunction).Bind(i).Call(nil, other)
+		return mul_func.(*LigmaFunction).Call(i.interpreter, other)
 	case *BuiltinClassMethod:
 		return mul_func.(*BuiltinClassMethod).Bind(i).Call(nil, other)
 	}
@@ -218,7 +427,7 @@ func (i *LigmaInstance) Div (other LigmaObject) LigmaObject {
 	div_func, _ := i.Get("__div__")
 	switch div_func.(type) {
 	case *LigmaFunction:
-		return div_func.(*LigmaFunction).Bind(i).Call(nil, other)
+		return div_func.(*LigmaFunction).Call(i.interpreter, other)
 	case *BuiltinClassMethod:
 		return div_func.(*BuiltinClassMethod).Bind(i).Call(nil, other)
 	}
@@ -229,7 +438,7 @@ func (i *LigmaInstance) Mod (other LigmaObject) LigmaObject {
 	mod_func, _ := i.Get("__mod__")
 	switch mod_func.(type) {
 	case *LigmaFunction:
-		return mod_func.(*LigmaFunction).Bind(i).Call(nil, other).(LigmaObject)
+		return mod_func.(*LigmaFunction).Call(i.interpreter, other).(LigmaObject)
 	case *BuiltinClassMethod:
 		return mod_func.(*BuiltinClassMethod).Bind(i).Call(nil, other).(LigmaObject)
 	}
@@ -240,9 +449,25 @@ func (i *LigmaInstance) Lt (other LigmaObject) LigmaObject {
 	lt_func, _ := i.Get("__lt__")
 	switch lt_func.(type) {
 	case *LigmaFunction:
-		return lt_func.(*LigmaFunction).Bind(i).Call(nil, other)
+		return lt_func.(*LigmaFunction).Call(i.interpreter, other)
 	case *BuiltinClassMethod:
 		return lt_func.(*BuiltinClassMethod).Bind(i).Call(nil, other)
 	}
 	return &LigmaNull{}
-}
\ No newline at end of file
+}
+
+// Contains dispatches `other in i` to the __contains__ method
+func (i *LigmaInstance) Contains (other LigmaObject) LigmaObject {
+	contains_func, ok := i.Get("__contains__")
+	if !ok {
+		return NewError("argument of type %s is not a container", i.Type())
+	}
+
+	switch contains_func := contains_func.(type) {
+	case *LigmaFunction:
+		return contains_func.Call(i.interpreter, other)
+	case *BuiltinClassMethod:
+		return contains_func.Bind(i).Call(nil, other)
+	}
+	return &LigmaNull{}
+}
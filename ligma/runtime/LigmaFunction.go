@@ -10,24 +10,98 @@ import (
 type LigmaFunction struct {
 	LigmaCallable
 	Parameters []*Identifier
+	ReturnType *TypeAnnotation
 	Body *BlockStatement
 	Env *Environment
+	IsGenerator bool
+
+	// Code runs the body instead of walking Body when the function was compiled
+	Code Code
+}
+
+// Code is a function body compiled to something other than its AST, like
+// the bytecode of the vm package. Run executes it in env, which holds the
+// arguments in the parameter slots, and returns the result of the call or
+// the TailCall the body ended with
+type Code interface {
+	Run(i *Interpreter, env *Environment) LigmaObject
 }
 
+// Call runs the function, generator functions return a generator instead
+// that runs the body as it is iterated
 func (f *LigmaFunction) Call(i *Interpreter, args ...LigmaObject) LigmaObject {
-	env := NewEnclosedEnvironment(f.Env)
+	if f.IsGenerator {
+		return newGenerator(i, f, args)
+	}
+	return f.execute(i, args)
+}
+
+// execute runs the body and makes the calls it returns in tail position,
+// one after the other, so deep tail recursion runs in constant Go stack
+func (f *LigmaFunction) execute(i *Interpreter, args []LigmaObject) LigmaObject {
+	result := f.run(i, args)
+
+	// with type checks, the results of the functions called in tail
+	// position are checked once the last of them returned
+	var returning []*LigmaFunction
+
+	for {
+		call, ok := result.(*TailCall)
+		if !ok {
+			break
+		}
+
+		fn, ok := call.Function.(*LigmaFunction)
+		if !ok || fn.IsGenerator {
+			result = ApplyFunction(i, call.Function, call.Args)
+			break
+		}
+
+		if len(call.Args) != fn.Arity() {
+			result = NewError("wrong number of arguments. got=%d, want=%d", len(call.Args), fn.Arity())
+			break
+		}
+
+		if i != nil && i.CheckTypes {
+			if err := checkArguments(fn, call.Args); err != nil {
+				result = err
+				break
+			}
+			returning = append(returning, fn)
+		}
+
+		result = fn.run(i, call.Args)
+	}
 
-	for i, param := range f.Parameters {
-		env.Set(param.Value, args[i])
+	for idx := len(returning) - 1; idx >= 0; idx-- {
+		result = checkResult(returning[idx], result)
 	}
+	return result
+}
 
+// run runs the body once, it may return a TailCall
+func (f *LigmaFunction) run(i *Interpreter, args []LigmaObject) LigmaObject {
+	env := f.Environment(args)
+
+	if f.Code != nil {
+		return f.Code.Run(i, env)
+	}
 	return unwrapReturnValue(i.ExecuteBlock(f.Body, env))
 }
 
+// Environment returns the scope a call with args runs in, the parameters
+// are the first locals of the function
+func (f *LigmaFunction) Environment(args []LigmaObject) *Environment {
+	env := NewEnclosedEnvironment(f.Env)
+	env.slots = make([]LigmaObject, len(f.Parameters))
+	copy(env.slots, args)
+	return env
+}
+
 func (f *LigmaFunction) Bind(instance *LigmaInstance) *LigmaFunction {
 	env := NewEnclosedEnvironment(f.Env)
-	env.Set("self", instance)
-	return &LigmaFunction{Parameters: f.Parameters, Body: f.Body, Env: env}
+	env.Define(0, instance)
+	return &LigmaFunction{Parameters: f.Parameters, ReturnType: f.ReturnType, Body: f.Body, Env: env, IsGenerator: f.IsGenerator, Code: f.Code}
 	//return nil
 }
 
@@ -60,6 +134,17 @@ type ReturnValue struct {
 func (rv *ReturnValue) Inspect() string { return rv.Value.Inspect() }
 func (rv *ReturnValue) Type() ObjectType { return RETURN_VALUE_OBJ }
 
+// TailCall is a call in tail position, `return f(x)`. The function body
+// returns it instead of making the call, and the call is made by execute
+// after the body is left, so the Go stack doesn't grow with it
+type TailCall struct {
+	Function LigmaObject
+	Args     []LigmaObject
+}
+
+func (tc *TailCall) Inspect() string  { return "<tail call>" }
+func (tc *TailCall) Type() ObjectType { return TAIL_CALL_OBJ }
+
 // built-in functions
 type Builtin struct {
 	LigmaCallable
@@ -0,0 +1,201 @@
+package runtime
+
+import (
+	"runtime"
+	"sync"
+)
+
+// generatorExit unwinds the body of a generator closed while it is
+// suspended, err is the first error of an __exit__ run on the way out
+type generatorExit struct {
+	err LigmaObject
+}
+
+// generatorResume is what a suspended body is woken up with
+type generatorResume struct {
+	value LigmaObject
+	close bool
+}
+
+// generatorStep is what the body hands back when it yields or finishes.
+// A Go panic in the body is carried over so it is raised in the caller
+type generatorStep struct {
+	value    LigmaObject
+	done     bool
+	panicked interface{}
+}
+
+// LigmaGenerator runs the body of a generator function on its own goroutine.
+// Control is handed back and forth over channels, so only one side ever runs
+// at a time and the body can be suspended in the middle of ExecuteBlock
+type LigmaGenerator struct {
+	body        *generatorBody
+	interpreter *Interpreter
+
+	started bool
+	done    bool
+}
+
+// generatorBody is the part of a generator its goroutine holds on to. The
+// goroutine never refers to the LigmaGenerator, so a generator dropped while
+// suspended can be collected, its finalizer hands the body to be closed
+type generatorBody struct {
+	fn   *LigmaFunction
+	args []LigmaObject
+
+	resume chan generatorResume
+	steps  chan generatorStep
+}
+
+// abandonedGenerators collects the bodies of generators that were collected
+// while suspended. Finalizers run on a goroutine of their own, so the bodies
+// are only closed later by the interpreter, see closeAbandoned
+type abandonedGenerators struct {
+	mu     sync.Mutex
+	bodies []*generatorBody
+}
+
+func newGenerator(i *Interpreter, fn *LigmaFunction, args []LigmaObject) LigmaObject {
+	i.closeAbandoned()
+
+	g := &LigmaGenerator{
+		body: &generatorBody{
+			fn:     fn,
+			args:   args,
+			resume: make(chan generatorResume),
+			steps:  make(chan generatorStep),
+		},
+		interpreter: i,
+	}
+
+	abandoned := i.abandoned
+	runtime.SetFinalizer(g, func(g *LigmaGenerator) {
+		if g.started && !g.done {
+			abandoned.mu.Lock()
+			abandoned.bodies = append(abandoned.bodies, g.body)
+			abandoned.mu.Unlock()
+		}
+	})
+
+	return &LigmaInstance{Class: builtinsClasses["generator"], Fields: map[string]LigmaObject{"value": g}, interpreter: i}
+}
+
+// closeAbandoned closes the suspended bodies of the generators that were
+// dropped since it last ran, so their goroutines end
+func (i *Interpreter) closeAbandoned() {
+	i.abandoned.mu.Lock()
+	bodies := i.abandoned.bodies
+	i.abandoned.bodies = nil
+	i.abandoned.mu.Unlock()
+
+	for _, body := range bodies {
+		// nobody is left to hand a failing __exit__ to
+		body.close()
+	}
+}
+
+func (g *LigmaGenerator) Inspect() string  { return "<generator>" }
+func (g *LigmaGenerator) Type() ObjectType { return GENERATOR_OBJ }
+
+// Next resumes the body with null, it implements LigmaIterator
+func (g *LigmaGenerator) Next() (LigmaObject, bool) {
+	return g.send(NULL)
+}
+
+// Close stops a suspended body, with blocks it is inside of still run their __exit__
+func (g *LigmaGenerator) Close() LigmaObject {
+	if g.done {
+		return nil
+	}
+
+	g.done = true
+	if !g.started {
+		return nil
+	}
+
+	step := g.body.close()
+	if step.panicked != nil {
+		panic(step.panicked)
+	}
+	if isError(step.value) {
+		return step.value
+	}
+	return nil
+}
+
+// send resumes the body with value and waits for it to yield or finish.
+// It reports false once the body has finished, errors are returned as values
+func (g *LigmaGenerator) send(value LigmaObject) (LigmaObject, bool) {
+	if g.done {
+		return nil, false
+	}
+
+	if !g.started {
+		if value.Type() != NULL_OBJ {
+			return NewError("can't send a value to a generator that hasn't started"), true
+		}
+
+		g.started = true
+
+		// the body gets an interpreter of its own, its Env moves independently.
+		// It starts out from the globals, the scope of the caller may hold
+		// the generator and would keep it from being collected
+		child := *g.interpreter
+		child.Env = child.globals
+		child.generator = g.body
+		go g.body.run(&child)
+	} else {
+		g.body.resume <- generatorResume{value: value}
+	}
+
+	step := <-g.body.steps
+	if step.panicked != nil {
+		g.done = true
+		panic(step.panicked)
+	}
+
+	if step.done {
+		g.done = true
+		if isError(step.value) {
+			return step.value, true
+		}
+		return nil, false
+	}
+
+	return step.value, true
+}
+
+// run executes the body, it is started by the first send
+func (b *generatorBody) run(i *Interpreter) {
+	step := generatorStep{done: true}
+
+	defer func() {
+		if r := recover(); r != nil {
+			if closing, ok := r.(generatorExit); ok {
+				step.value = closing.err
+			} else {
+				step.panicked = r
+			}
+		}
+		b.steps <- step
+	}()
+
+	step.value = b.fn.execute(i, b.args)
+}
+
+// close wakes the suspended body up to unwind and waits for it to finish
+func (b *generatorBody) close() generatorStep {
+	b.resume <- generatorResume{close: true}
+	return <-b.steps
+}
+
+// yield is called from the body, it suspends it until the next send
+func (b *generatorBody) yield(value LigmaObject) LigmaObject {
+	b.steps <- generatorStep{value: value}
+
+	resume := <-b.resume
+	if resume.close {
+		panic(generatorExit{})
+	}
+	return resume.value
+}
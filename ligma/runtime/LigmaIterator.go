@@ -0,0 +1,250 @@
+package runtime
+
+import (
+	"sort"
+)
+
+// sliceIterator walks a fixed slice of elements, it backs the iteration of
+// lists, strings and map keys
+type sliceIterator struct {
+	elements []LigmaObject
+	index    int
+}
+
+func (it *sliceIterator) Inspect() string  { return "<iterator>" }
+func (it *sliceIterator) Type() ObjectType { return ITERATOR_OBJ }
+func (it *sliceIterator) Next() (LigmaObject, bool) {
+	if it.index >= len(it.elements) {
+		return nil, false
+	}
+
+	element := it.elements[it.index]
+	it.index++
+	return element, true
+}
+
+// sortedPairs returns the pairs of a map in a stable order, Go maps have none
+func sortedPairs(m *LigmaMap) []MapPair {
+	keys := make([]MapKey, 0, len(m.Pairs))
+	for key := range m.Pairs {
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(a, b int) bool {
+		if keys[a].Type != keys[b].Type {
+			return keys[a].Type < keys[b].Type
+		}
+		return keys[a].Value < keys[b].Value
+	})
+
+	pairs := make([]MapPair, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, m.Pairs[key]...)
+	}
+
+	return pairs
+}
+
+// sortedElements returns the elements of a set in the same stable order as sortedPairs
+func sortedElements(s *LigmaSet) []LigmaObject {
+	keys := make([]MapKey, 0, len(s.Elements))
+	for key := range s.Elements {
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(a, b int) bool {
+		if keys[a].Type != keys[b].Type {
+			return keys[a].Type < keys[b].Type
+		}
+		return keys[a].Value < keys[b].Value
+	})
+
+	elements := make([]LigmaObject, 0, len(keys))
+	for _, key := range keys {
+		elements = append(elements, s.Elements[key]...)
+	}
+
+	return elements
+}
+
+// GetIterator returns an iterator over obj, lists, tuples and sets yield their elements, maps
+// their keys and strings their characters. Instances can take part by
+// defining an __iter__ method
+func GetIterator(i *Interpreter, obj LigmaObject) (LigmaIterator, LigmaObject) {
+	switch obj := obj.(type) {
+	case LigmaIterator:
+		return obj, nil
+
+	case *LigmaClass:
+		if obj.Members != nil {
+			members := []LigmaObject{}
+			for _, member := range obj.Members {
+				members = append(members, member)
+			}
+			return &sliceIterator{elements: members}, nil
+		}
+
+	case *LigmaInstance:
+		switch value := obj.Fields["value"].(type) {
+		case LigmaIterator:
+			return value, nil
+
+		case *LigmaList:
+			return &sliceIterator{elements: value.Elements}, nil
+
+		case *LigmaTuple:
+			return &sliceIterator{elements: value.Elements}, nil
+
+		case *LigmaSet:
+			return &sliceIterator{elements: sortedElements(value)}, nil
+
+		case *LigmaMap:
+			keys := []LigmaObject{}
+			for _, pair := range sortedPairs(value) {
+				keys = append(keys, pair.Key)
+			}
+			return &sliceIterator{elements: keys}, nil
+
+		case *LigmaString:
+			chars := []LigmaObject{}
+			for _, ch := range value.Value {
+				chars = append(chars, NewString(string(ch)))
+			}
+			return &sliceIterator{elements: chars}, nil
+		}
+
+		iter, ok := obj.Get("__iter__")
+		if ok {
+			result := ApplyFunction(i, iter, []LigmaObject{})
+			if isError(result) {
+				return nil, result
+			}
+			return GetIterator(i, result)
+		}
+	}
+
+	return nil, NewError("object of type %s is not iterable", obj.Type())
+}
+
+// iterate steps through obj and hands every element to fn unpacked into
+// targets values. Iteration stops as soon as fn returns something other than nil
+func (i *Interpreter) iterate(obj LigmaObject, targets int, fn func([]LigmaObject) LigmaObject) LigmaObject {
+	loop, err := NewLoop(i, obj, targets)
+	if err != nil {
+		return err
+	}
+
+	for {
+		values, err := loop.Next()
+		if err != nil {
+			return err
+		}
+		if values == nil {
+			return nil
+		}
+
+		if result := fn(values); result != nil {
+			if err := loop.Close(); err != nil && !isError(result) {
+				return err
+			}
+			return result
+		}
+	}
+}
+
+// Loop is an iteration in progress, every step is unpacked into the values
+// of the loop targets. Iterating a map with two targets yields its key/value
+// pairs
+type Loop struct {
+	iterator LigmaIterator
+	pairs    []MapPair
+	targets  int
+}
+
+// NewLoop starts iterating obj for targets loop variables
+func NewLoop(i *Interpreter, obj LigmaObject, targets int) (*Loop, LigmaObject) {
+	if instance, ok := obj.(*LigmaInstance); ok && targets == 2 {
+		if m, ok := instance.Fields["value"].(*LigmaMap); ok {
+			return &Loop{pairs: sortedPairs(m), targets: targets}, nil
+		}
+	}
+
+	iterator, err := GetIterator(i, obj)
+	if err != nil {
+		return nil, err
+	}
+	return &Loop{iterator: iterator, targets: targets}, nil
+}
+
+func (l *Loop) Inspect() string  { return "<loop>" }
+func (l *Loop) Type() ObjectType { return ITERATOR_OBJ }
+
+// Next returns the values of the next step, nil once the iteration is over.
+// The iterator is closed when a step fails
+func (l *Loop) Next() ([]LigmaObject, LigmaObject) {
+	if l.iterator == nil {
+		if len(l.pairs) == 0 {
+			return nil, nil
+		}
+		pair := l.pairs[0]
+		l.pairs = l.pairs[1:]
+		return []LigmaObject{pair.Key, pair.Value}, nil
+	}
+
+	element, ok := l.iterator.Next()
+	if !ok {
+		return nil, nil
+	}
+
+	if isError(element) {
+		l.Close()
+		return nil, element
+	}
+
+	values := []LigmaObject{element}
+	if l.targets > 1 {
+		values = unpackValues(element)
+		if len(values) != l.targets {
+			l.Close()
+			return nil, NewError("cannot unpack %s into %d values", element.Type(), l.targets)
+		}
+	}
+
+	return values, nil
+}
+
+// Close releases the iterator of a loop that is left before the end, it
+// returns the error releasing it failed with
+func (l *Loop) Close() LigmaObject {
+	if l.iterator == nil {
+		return nil
+	}
+	return closeIterator(l.iterator)
+}
+
+// closableIterator is an iterator holding resources that have to be released
+// when it is abandoned before the end, like a suspended generator
+type closableIterator interface {
+	LigmaIterator
+	Close() LigmaObject
+}
+
+func closeIterator(iterator LigmaIterator) LigmaObject {
+	if closable, ok := iterator.(closableIterator); ok {
+		return closable.Close()
+	}
+	return nil
+}
+
+// unpackValues returns the elements of a sequence that is being destructured
+func unpackValues(obj LigmaObject) []LigmaObject {
+	if instance, ok := obj.(*LigmaInstance); ok {
+		switch value := instance.Fields["value"].(type) {
+		case *LigmaList:
+			return value.Elements
+		case *LigmaTuple:
+			return value.Elements
+		}
+	}
+	return nil
+}
@@ -10,13 +10,19 @@ const (
 	NULL_OBJ = "NULL"
 	STRING_OBJ = "STRING"
 	RETURN_VALUE_OBJ = "RETURN_VALUE"
+	TAIL_CALL_OBJ = "TAIL_CALL"
 	ERROR_OBJ = "ERROR"
 	FUNCTION_OBJ = "FUNCTION"
 	BUILTIN_OBJ = "BUILTIN"
 	LIST_OBJ = "LIST"
+	TUPLE_OBJ = "TUPLE"
+	SET_OBJ = "SET"
 	CLASS_OBJ = "CLASS"
 	INSTANCE_OBJ = "INSTANCE"
 	MAP_OBJ = "MAP"
+	ITERATOR_OBJ = "ITERATOR"
+	GENERATOR_OBJ = "GENERATOR"
+	STATIC_TYPE_OBJ = "STATIC_TYPE"
 )
 
 type LigmaObject interface {
@@ -35,9 +41,32 @@ type LigmaHashable interface {
 	MapKey() MapKey
 }
 
+// HashKey returns the key obj is stored under in maps and sets, or an error
+// when obj can't be hashed. Objects that are == hash alike, objects that
+// hash alike aren't always ==
+func HashKey(obj LigmaObject) (MapKey, LigmaObject) {
+	switch obj := obj.(type) {
+	case *LigmaInstance:
+		return obj.hashKey()
+	case *LigmaTuple:
+		return obj.hashKey()
+	case LigmaHashable:
+		return obj.MapKey(), nil
+	}
+	return MapKey{}, NewError("unhashable type: %s", obj.Type())
+}
+
+// LigmaIterator produces the elements of an iterable one at a time,
+// the second return value is false once it is exhausted
+type LigmaIterator interface {
+	LigmaObject
+	Next() (LigmaObject, bool)
+}
+
 
 type Error struct {
 	Message string
+	Fatal   bool // the program ends here, failed assertions are fatal
 }
 
 func (e *Error) Inspect() string { return "ERROR: " + e.Message }
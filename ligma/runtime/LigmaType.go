@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"hash/fnv"
+	"math"
 	"strings"
 )
 
@@ -27,6 +28,13 @@ type LigmaFloat struct {
 
 func (f *LigmaFloat) Inspect() string { return fmt.Sprintf("%f", f.Value) }
 func (f *LigmaFloat) Type() ObjectType { return FLOAT_OBJ }
+func (f *LigmaFloat) MapKey() MapKey {
+	// 1.0 == 1, so integral floats hash like the int they are equal to
+	if f.Value == math.Trunc(f.Value) && math.Abs(f.Value) < math.MaxInt64 {
+		return (&LigmaInteger{Value: int64(f.Value)}).MapKey()
+	}
+	return MapKey{Type: f.Type(), Value: math.Float64bits(f.Value)}
+}
 
 
 // LigmaBoolean
@@ -86,6 +94,126 @@ func (l *LigmaList) Inspect() string {
 }
 func (l *LigmaList) Type() ObjectType { return LIST_OBJ }
 
+// LigmaTuple
+type LigmaTuple struct {
+	Elements []LigmaObject
+}
+
+func (t *LigmaTuple) Inspect() string {
+	var out bytes.Buffer
+
+	elements := []string{}
+	for _, el := range t.Elements {
+		elements = append(elements, el.Inspect())
+	}
+
+	out.WriteString("(")
+	out.WriteString(strings.Join(elements, ", "))
+	if len(elements) == 1 {
+		out.WriteString(",")
+	}
+	out.WriteString(")")
+
+	return out.String()
+}
+func (t *LigmaTuple) Type() ObjectType { return TUPLE_OBJ }
+func (t *LigmaTuple) hashKey() (MapKey, LigmaObject) {
+	h := fnv.New64a()
+	for _, el := range t.Elements {
+		key, err := HashKey(el)
+		if err != nil {
+			return MapKey{}, err
+		}
+		fmt.Fprintf(h, "%s:%d|", key.Type, key.Value)
+	}
+	return MapKey{Type: t.Type(), Value: h.Sum64()}, nil
+}
+// LigmaSet holds its elements by their MapKey like the keys of a LigmaMap,
+// elements that hash alike share a bucket
+type LigmaSet struct {
+	Elements map[MapKey][]LigmaObject
+}
+
+func NewSet() *LigmaSet {
+	return &LigmaSet{Elements: map[MapKey][]LigmaObject{}}
+}
+
+// Contains reports whether the set holds an element equal to element
+func (s *LigmaSet) Contains(element LigmaObject) (bool, LigmaObject) {
+	key, err := HashKey(element)
+	if err != nil {
+		return false, err
+	}
+	return s.index(key, element) >= 0, nil
+}
+
+// Add adds element unless the set already holds an equal one
+func (s *LigmaSet) Add(element LigmaObject) LigmaObject {
+	key, err := HashKey(element)
+	if err != nil {
+		return err
+	}
+	if s.index(key, element) < 0 {
+		s.Elements[key] = append(s.Elements[key], element)
+	}
+	return nil
+}
+
+// Remove removes the element equal to element, it reports whether there was one
+func (s *LigmaSet) Remove(element LigmaObject) (bool, LigmaObject) {
+	key, err := HashKey(element)
+	if err != nil {
+		return false, err
+	}
+
+	idx := s.index(key, element)
+	if idx < 0 {
+		return false, nil
+	}
+
+	bucket := s.Elements[key]
+	if len(bucket) == 1 {
+		delete(s.Elements, key)
+	} else {
+		s.Elements[key] = append(bucket[:idx:idx], bucket[idx+1:]...)
+	}
+	return true, nil
+}
+
+// Len returns the number of elements
+func (s *LigmaSet) Len() int {
+	n := 0
+	for _, bucket := range s.Elements {
+		n += len(bucket)
+	}
+	return n
+}
+
+// index returns where the element equal to element is in the bucket of key, or -1
+func (s *LigmaSet) index(key MapKey, element LigmaObject) int {
+	for idx, other := range s.Elements[key] {
+		if valuesEqual(other, element) {
+			return idx
+		}
+	}
+	return -1
+}
+
+func (s *LigmaSet) Inspect() string {
+	var out bytes.Buffer
+
+	elements := []string{}
+	for _, el := range sortedElements(s) {
+		elements = append(elements, el.Inspect())
+	}
+
+	out.WriteString("{")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
+func (s *LigmaSet) Type() ObjectType { return SET_OBJ }
 
 type MapKey struct {
 	Type ObjectType
@@ -98,16 +226,65 @@ type MapPair struct {
 	Value LigmaObject
 }
 
-// LigmaMap
+// LigmaMap keeps its pairs by the MapKey of their key, pairs whose keys
+// hash alike share a bucket and are told apart by ==
 type LigmaMap struct {
-	Pairs map[MapKey]MapPair
+	Pairs map[MapKey][]MapPair
+}
+
+func NewMap() *LigmaMap {
+	return &LigmaMap{Pairs: map[MapKey][]MapPair{}}
+}
+
+// Get returns the value stored under a key equal to key, found is false
+// if there is none
+func (m *LigmaMap) Get(key LigmaObject) (value LigmaObject, found bool, err LigmaObject) {
+	hashed, err := HashKey(key)
+	if err != nil {
+		return nil, false, err
+	}
+
+	for _, pair := range m.Pairs[hashed] {
+		if valuesEqual(pair.Key, key) {
+			return pair.Value, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+// Set stores value under key, an equal key that is already there keeps
+// its place and gets the new value
+func (m *LigmaMap) Set(key, value LigmaObject) LigmaObject {
+	hashed, err := HashKey(key)
+	if err != nil {
+		return err
+	}
+
+	bucket := m.Pairs[hashed]
+	for idx, pair := range bucket {
+		if valuesEqual(pair.Key, key) {
+			bucket[idx].Value = value
+			return nil
+		}
+	}
+	m.Pairs[hashed] = append(bucket, MapPair{Key: key, Value: value})
+	return nil
+}
+
+// Len returns the number of pairs
+func (m *LigmaMap) Len() int {
+	n := 0
+	for _, bucket := range m.Pairs {
+		n += len(bucket)
+	}
+	return n
 }
 
 func (m *LigmaMap) Inspect() string {
 	var out bytes.Buffer
 
 	pairs := []string{}
-	for _, pair := range m.Pairs {
+	for _, pair := range sortedPairs(m) {
 		pairs = append(pairs, pair.Key.Inspect()+":"+pair.Value.Inspect())
 	}
 
@@ -0,0 +1,65 @@
+package runtime
+
+// Instances of int, float and str are values: nothing can be assigned to
+// their attributes, so one instance can stand for the same value wherever
+// it is used. Small integers are made once per int class and shared, the
+// strings of literals are interned by the interpreter that runs them,
+// literals get their instance from the resolver. Booleans are already the
+// TRUE and FALSE singletons
+
+const (
+	smallIntMin = -5
+	smallIntMax = 256
+
+	// maxInterned bounds the strings an interpreter interns, a long REPL
+	// session keeps seeing new literals. Past it literals aren't shared
+	maxInterned = 4096
+)
+
+func newValue(class string, value LigmaObject) *LigmaInstance {
+	return &LigmaInstance{Class: builtinsClasses[class], Fields: map[string]LigmaObject{"value": value}, immutable: true}
+}
+
+// NewInteger returns the int instance of value, small integers are shared
+func NewInteger(value int64) *LigmaInstance {
+	if value >= smallIntMin && value <= smallIntMax {
+		return smallInteger(value)
+	}
+	return newValue("int", &LigmaInteger{Value: value})
+}
+
+// NewFloat returns a float instance of value
+func NewFloat(value float64) *LigmaInstance {
+	return newValue("float", &LigmaFloat{Value: value})
+}
+
+// NewString returns a str instance of value
+func NewString(value string) *LigmaInstance {
+	return newValue("str", &LigmaString{Value: value})
+}
+
+// smallInteger returns the shared instance of a small integer, the int
+// class makes them the first time one is asked for
+func smallInteger(value int64) *LigmaInstance {
+	class := builtinsClasses["int"]
+	if class.values == nil {
+		class.values = make([]*LigmaInstance, smallIntMax-smallIntMin+1)
+		for idx := range class.values {
+			class.values[idx] = newValue("int", &LigmaInteger{Value: int64(idx + smallIntMin)})
+		}
+	}
+	return class.values[value-smallIntMin]
+}
+
+// Intern returns the shared str instance of value. It is meant for the
+// strings of literals, which live as long as the program does
+func (i *Interpreter) Intern(value string) *LigmaInstance {
+	instance, ok := i.interned[value]
+	if !ok {
+		instance = NewString(value)
+		if len(i.interned) < maxInterned {
+			i.interned[value] = instance
+		}
+	}
+	return instance
+}
@@ -16,6 +16,8 @@ const (
 type ExpressionVisitor interface {
 	VisitPrefixExpression(*PrefixExpression) LigmaObject
 	VisitInfixExpression(*InfixExpression) LigmaObject
+	VisitPipeExpression(*PipeExpression) LigmaObject
+	VisitYieldExpression(*YieldExpression) LigmaObject
 	VisitIfExpression(*IfExpression) LigmaObject
 	VisitCallExpression(*CallExpression) LigmaObject
 	VisitIndexExpression(*IndexExpression) LigmaObject
@@ -26,9 +28,13 @@ type ExpressionVisitor interface {
 	VisitBoolean(*Boolean) LigmaObject
 	VisitNull(*Null) LigmaObject
 	VisitListLiteral(*ListLiteral) LigmaObject
+	VisitTupleLiteral(*TupleLiteral) LigmaObject
+	VisitSetLiteral(*SetLiteral) LigmaObject
 	VisitStringLiteral(*StringLiteral) LigmaObject
 	VisitFunctionLiteral(*FunctionLiteral) LigmaObject
 	VisitMapLiteral(*MapLiteral) LigmaObject
+	VisitListComprehension(*ListComprehension) LigmaObject
+	VisitMapComprehension(*MapComprehension) LigmaObject
 	VisitGetExpression(*GetExpression) LigmaObject
 	VisitSetExpression(*SetExpression) LigmaObject
 	VisitSelfExpression(*Self) LigmaObject
@@ -37,11 +43,18 @@ type ExpressionVisitor interface {
 
 type StatementVisitor interface {
 	VisitDefStatement(*DefStatement) LigmaObject
+	VisitUnpackStatement(*UnpackStatement) LigmaObject
 	VisitReturnStatement(*ReturnStatement) LigmaObject
 	VisitExpressionStatement(*ExpressionStatement) LigmaObject
 	VisitBlockStatement(*BlockStatement)  LigmaObject
 	VisitClassStatement(*Class) LigmaObject
+	VisitEnumStatement(*EnumStatement) LigmaObject
+	VisitRecordStatement(*RecordStatement) LigmaObject
+	VisitInterfaceStatement(*InterfaceStatement) LigmaObject
 	VisitWhileStatement(*WhileStatement) LigmaObject
+	VisitForStatement(*ForStatement) LigmaObject
+	VisitWithStatement(*WithStatement) LigmaObject
+	VisitAssertStatement(*AssertStatement) LigmaObject
 }
 
 
@@ -2,6 +2,7 @@ package runtime
 
 import (
 	"bytes"
+	"strings"
 	"ligma/token"
 )
 
@@ -11,6 +12,11 @@ type Class struct {
 	Name *Identifier
 	Superclass *Identifier
 	Methods []*DefStatement
+	Fields []*DefStatement // non-function defs in the class body
+	Interfaces []*Identifier // `implements A, B`
+	Abstract []*Identifier // `abstract def name`, methods subclasses have to provide
+	Getters []*DefStatement // `get name = func() {...}`
+	Setters []*DefStatement // `set name = func(value) {...}`
 }
 
 func (c *Class) Accept(v StatementVisitor) LigmaObject {
@@ -23,22 +29,155 @@ func (c *Class) String() string {
 
 	out.WriteString("class ")
 	out.WriteString(c.Name.String())
+
+	if c.Superclass != nil {
+		out.WriteString(" : ")
+		out.WriteString(c.Superclass.String())
+	}
+
+	if len(c.Interfaces) > 0 {
+		interfaces := []string{}
+		for _, i := range c.Interfaces {
+			interfaces = append(interfaces, i.String())
+		}
+		out.WriteString(" implements ")
+		out.WriteString(strings.Join(interfaces, ", "))
+	}
+
 	out.WriteString(" {\n")
 
+	for _, a := range c.Abstract {
+		out.WriteString("abstract def " + a.String() + ";")
+	}
+
+	for _, f := range c.Fields {
+		out.WriteString(f.String())
+	}
+
 	for _, m := range c.Methods {
 		out.WriteString(m.String())
 	}
 
+	for _, g := range c.Getters {
+		out.WriteString(g.String())
+	}
+
+	for _, s := range c.Setters {
+		out.WriteString(s.String())
+	}
+
 	out.WriteString("\n}")
 	return out.String()
 }
 // ---- End Class Block ----
 
+// ---- Start RecordStatement Block ----
+type RecordStatement struct {
+	Token token.Token
+	Name *Identifier
+	Fields []*Identifier // constructor parameters, in order
+}
+
+func (rs *RecordStatement) Accept(v StatementVisitor) LigmaObject {
+	return v.VisitRecordStatement(rs)
+}
+func (rs *RecordStatement) statementNode()       {}
+func (rs *RecordStatement) TokenLiteral() string { return rs.Token.Literal }
+func (rs *RecordStatement) String() string {
+	var out bytes.Buffer
+
+	fields := []string{}
+	for _, f := range rs.Fields {
+		field := f.String()
+		if f.Type != nil {
+			field += ": " + f.Type.String()
+		}
+		fields = append(fields, field)
+	}
+
+	out.WriteString("record ")
+	out.WriteString(rs.Name.String())
+	out.WriteString("(")
+	out.WriteString(strings.Join(fields, ", "))
+	out.WriteString(")")
+	return out.String()
+}
+// ---- End RecordStatement Block ----
+
+// ---- Start InterfaceStatement Block ----
+type InterfaceStatement struct {
+	Token token.Token
+	Name *Identifier
+	Methods []*Identifier // names implementing classes have to define
+}
+
+func (is *InterfaceStatement) Accept(v StatementVisitor) LigmaObject {
+	return v.VisitInterfaceStatement(is)
+}
+func (is *InterfaceStatement) statementNode()       {}
+func (is *InterfaceStatement) TokenLiteral() string { return is.Token.Literal }
+func (is *InterfaceStatement) String() string {
+	var out bytes.Buffer
+
+	methods := []string{}
+	for _, m := range is.Methods {
+		methods = append(methods, m.String())
+	}
+
+	out.WriteString("interface ")
+	out.WriteString(is.Name.String())
+	out.WriteString(" { ")
+	out.WriteString(strings.Join(methods, "; "))
+	out.WriteString(" }")
+	return out.String()
+}
+// ---- End InterfaceStatement Block ----
+
+// ---- Start EnumStatement Block ----
+type EnumMember struct {
+	Name *Identifier
+	Value Expression // nil when the value is implied by the previous member
+}
+
+type EnumStatement struct {
+	Token token.Token
+	Name *Identifier
+	Members []*EnumMember
+}
+
+func (es *EnumStatement) Accept(v StatementVisitor) LigmaObject {
+	return v.VisitEnumStatement(es)
+}
+func (es *EnumStatement) statementNode()       {}
+func (es *EnumStatement) TokenLiteral() string { return es.Token.Literal }
+func (es *EnumStatement) String() string {
+	var out bytes.Buffer
+
+	members := []string{}
+	for _, m := range es.Members {
+		if m.Value != nil {
+			members = append(members, m.Name.String()+" = "+m.Value.String())
+		} else {
+			members = append(members, m.Name.String())
+		}
+	}
+
+	out.WriteString("enum ")
+	out.WriteString(es.Name.String())
+	out.WriteString(" { ")
+	out.WriteString(strings.Join(members, ", "))
+	out.WriteString(" }")
+	return out.String()
+}
+// ---- End EnumStatement Block ----
+
 // ---- Start GetExpression Block ----
 type GetExpression struct {
 	Token token.Token
 	Object Expression
 	Property *Identifier
+
+	cache PropertyCache // inline cache of the interpreter
 }
 
 func (ge *GetExpression) Accept(v ExpressionVisitor) LigmaObject {
@@ -63,6 +202,8 @@ type SetExpression struct {
 	Object Expression
 	Property *Identifier
 	Value Expression
+
+	cache PropertyCache // inline cache of the interpreter
 }
 
 func (se *SetExpression) Accept(v ExpressionVisitor) LigmaObject {
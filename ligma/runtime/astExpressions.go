@@ -56,6 +56,50 @@ func (ie *InfixExpression) String() string {
 }
 // ---- End InfixExpression Block ----
 
+// ---- Start PipeExpression Block ----
+type PipeExpression struct {
+	Token token.Token // the '|>' token
+	Left  Expression  // the value being piped
+	Right Expression  // the function, or call, it is piped into
+}
+
+func (pe *PipeExpression) Accept(v ExpressionVisitor) LigmaObject {
+	return v.VisitPipeExpression(pe)
+}
+func (pe *PipeExpression) expressionNode()      {}
+func (pe *PipeExpression) TokenLiteral() string { return pe.Token.Literal }
+func (pe *PipeExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(pe.Left.String())
+	out.WriteString(" |> ")
+	out.WriteString(pe.Right.String())
+	out.WriteString(")")
+
+	return out.String()
+}
+// ---- End PipeExpression Block ----
+
+// ---- Start YieldExpression Block ----
+type YieldExpression struct {
+	Token token.Token // the 'yield' token
+	Value Expression  // nil for a bare yield
+}
+
+func (ye *YieldExpression) Accept(v ExpressionVisitor) LigmaObject {
+	return v.VisitYieldExpression(ye)
+}
+func (ye *YieldExpression) expressionNode()      {}
+func (ye *YieldExpression) TokenLiteral() string { return ye.Token.Literal }
+func (ye *YieldExpression) String() string {
+	if ye.Value == nil {
+		return "yield"
+	}
+	return "(yield " + ye.Value.String() + ")"
+}
+// ---- End YieldExpression Block ----
+
 // ---- Start IfExpression Block ----
 type IfExpression struct {
 	Token       token.Token // The 'if' token
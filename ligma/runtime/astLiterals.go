@@ -10,6 +10,7 @@ import (
 type Identifier struct {
 	Token token.Token // the token.IDENT token
 	Value string
+	Type  *TypeAnnotation // optional, only set on annotated parameters
 }
 
 func (i *Identifier) Accept(v ExpressionVisitor) LigmaObject {
@@ -25,6 +26,8 @@ func (i *Identifier) String() string       { return i.Value }
 type IntegerLiteral struct {
 	Token token.Token
 	Value int64
+
+	instance *LigmaInstance // of the value, built by the resolver
 }
 
 func (il *IntegerLiteral) Accept(v ExpressionVisitor) LigmaObject {
@@ -39,6 +42,8 @@ func (il *IntegerLiteral) String() string       { return il.Token.Literal }
 type FloatLiteral struct {
 	Token token.Token
 	Value float64
+
+	instance *LigmaInstance // of the value, built by the resolver
 }
 
 func (fl *FloatLiteral) Accept(v ExpressionVisitor) LigmaObject {
@@ -78,6 +83,8 @@ func (n *Null) String() string       { return n.Token.Literal }
 type StringLiteral struct {
 	Token token.Token
 	Value string
+
+	instance *LigmaInstance // of the value, built by the resolver
 }
 
 func (sl *StringLiteral) Accept(v ExpressionVisitor) LigmaObject {
@@ -92,7 +99,9 @@ func (sl *StringLiteral) String() string       { return sl.Token.Literal }
 type FunctionLiteral struct {
 	Token      token.Token // the 'fn' token
 	Parameters []*Identifier
+	ReturnType *TypeAnnotation // optional, `func(a: int) -> int`
 	Body       *BlockStatement
+	IsGenerator bool // the body contains a yield
 }
 
 func (fl *FunctionLiteral) Accept(v ExpressionVisitor) LigmaObject {
@@ -105,13 +114,24 @@ func (fl *FunctionLiteral) String() string {
 
 	params := []string{}
 	for _, p := range fl.Parameters {
-		params = append(params, p.String())
+		if p.Type != nil {
+			params = append(params, p.String()+": "+p.Type.String())
+		} else {
+			params = append(params, p.String())
+		}
 	}
 
 	out.WriteString(fl.TokenLiteral())
 	out.WriteString("(")
 	out.WriteString(strings.Join(params, ", "))
 	out.WriteString(") ")
+
+	if fl.ReturnType != nil {
+		out.WriteString("-> ")
+		out.WriteString(fl.ReturnType.String())
+		out.WriteString(" ")
+	}
+
 	out.WriteString(fl.Body.String())
 
 	return out.String()
@@ -145,6 +165,63 @@ func (ll *ListLiteral) String() string {
 }
 // ---- End ListLiteral Block ----
 
+// ---- Start TupleLiteral Block ----
+type TupleLiteral struct {
+	Token    token.Token // the '(' token
+	Elements []Expression
+}
+
+func (tl *TupleLiteral) Accept(v ExpressionVisitor) LigmaObject {
+	return v.VisitTupleLiteral(tl)
+}
+func (tl *TupleLiteral) expressionNode()      {}
+func (tl *TupleLiteral) TokenLiteral() string { return tl.Token.Literal }
+func (tl *TupleLiteral) String() string {
+	var out bytes.Buffer
+
+	elements := []string{}
+	for _, el := range tl.Elements {
+		elements = append(elements, el.String())
+	}
+
+	out.WriteString("(")
+	out.WriteString(strings.Join(elements, ", "))
+	if len(elements) == 1 {
+		out.WriteString(",")
+	}
+	out.WriteString(")")
+
+	return out.String()
+}
+// ---- End TupleLiteral Block ----
+
+// ---- Start SetLiteral Block ----
+type SetLiteral struct {
+	Token    token.Token // the '{' token
+	Elements []Expression
+}
+
+func (sl *SetLiteral) Accept(v ExpressionVisitor) LigmaObject {
+	return v.VisitSetLiteral(sl)
+}
+func (sl *SetLiteral) expressionNode()      {}
+func (sl *SetLiteral) TokenLiteral() string { return sl.Token.Literal }
+func (sl *SetLiteral) String() string {
+	var out bytes.Buffer
+
+	elements := []string{}
+	for _, el := range sl.Elements {
+		elements = append(elements, el.String())
+	}
+
+	out.WriteString("{")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
+// ---- End SetLiteral Block ----
+
 // ---- Start MapLiteral Block ----
 type MapLiteral struct {
 	Token token.Token // the '{' token
@@ -169,4 +246,81 @@ func (ml *MapLiteral) String() string {
 	out.WriteString("}")
 
 	return out.String()
-}
\ No newline at end of file
+}
+// ---- End MapLiteral Block ----
+
+// ---- Start ListComprehension Block ----
+type ListComprehension struct {
+	Token     token.Token // the '[' token
+	Element   Expression
+	Targets   []*Identifier
+	Iterable  Expression
+	Condition Expression // optional 'if' filter
+}
+
+func (lc *ListComprehension) Accept(v ExpressionVisitor) LigmaObject {
+	return v.VisitListComprehension(lc)
+}
+func (lc *ListComprehension) expressionNode()      {}
+func (lc *ListComprehension) TokenLiteral() string { return lc.Token.Literal }
+func (lc *ListComprehension) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("[")
+	out.WriteString(lc.Element.String())
+	out.WriteString(comprehensionClauseString(lc.Targets, lc.Iterable, lc.Condition))
+	out.WriteString("]")
+
+	return out.String()
+}
+// ---- End ListComprehension Block ----
+
+// ---- Start MapComprehension Block ----
+type MapComprehension struct {
+	Token     token.Token // the '{' token
+	Key       Expression
+	Value     Expression
+	Targets   []*Identifier
+	Iterable  Expression
+	Condition Expression // optional 'if' filter
+}
+
+func (mc *MapComprehension) Accept(v ExpressionVisitor) LigmaObject {
+	return v.VisitMapComprehension(mc)
+}
+func (mc *MapComprehension) expressionNode()      {}
+func (mc *MapComprehension) TokenLiteral() string { return mc.Token.Literal }
+func (mc *MapComprehension) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("{")
+	out.WriteString(mc.Key.String())
+	out.WriteString(": ")
+	out.WriteString(mc.Value.String())
+	out.WriteString(comprehensionClauseString(mc.Targets, mc.Iterable, mc.Condition))
+	out.WriteString("}")
+
+	return out.String()
+}
+// ---- End MapComprehension Block ----
+
+func comprehensionClauseString(targets []*Identifier, iterable Expression, condition Expression) string {
+	var out bytes.Buffer
+
+	names := []string{}
+	for _, t := range targets {
+		names = append(names, t.String())
+	}
+
+	out.WriteString(" for ")
+	out.WriteString(strings.Join(names, ", "))
+	out.WriteString(" in ")
+	out.WriteString(iterable.String())
+
+	if condition != nil {
+		out.WriteString(" if ")
+		out.WriteString(condition.String())
+	}
+
+	return out.String()
+}
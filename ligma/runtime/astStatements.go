@@ -3,13 +3,16 @@ package runtime
 import (
 	"bytes"
 	"ligma/token"
+	"strings"
 )
 
 // ---- Start DefStatement Block ----
 type DefStatement struct {
 	Token token.Token // the token.DEF token
 	Name  *Identifier
+	Type  *TypeAnnotation // optional, `def x: int = 5`
 	Value Expression
+	Constant bool // declared with const, the name can't be assigned again
 }
 
 func (ls *DefStatement) Accept(v StatementVisitor) LigmaObject {
@@ -22,6 +25,12 @@ func (ls *DefStatement) String() string {
 
 	out.WriteString(ls.TokenLiteral() + " ")
 	out.WriteString(ls.Name.String())
+
+	if ls.Type != nil {
+		out.WriteString(": ")
+		out.WriteString(ls.Type.String())
+	}
+
 	out.WriteString(" = ")
 
 	if ls.Value != nil {
@@ -37,6 +46,10 @@ func (ls *DefStatement) String() string {
 type ReturnStatement struct {
 	Token       token.Token // the 'return' token
 	ReturnValue Expression
+
+	// Tail is set by the resolver when the value is a call the function
+	// can leave to its caller to make, see TailCall
+	Tail bool
 }
 
 func (rs *ReturnStatement) Accept(v StatementVisitor) LigmaObject {
@@ -122,3 +135,124 @@ func (ws *WhileStatement) String() string {
 	return out.String()
 }
 // ---- End WhileStatement Block ----
+
+// ---- Start UnpackStatement Block ----
+type UnpackStatement struct {
+	Token    token.Token // the 'def' or 'const' token
+	Targets  []*Identifier
+	Value    Expression
+	Constant bool
+}
+
+func (us *UnpackStatement) Accept(v StatementVisitor) LigmaObject {
+	return v.VisitUnpackStatement(us)
+}
+func (us *UnpackStatement) statementNode()       {}
+func (us *UnpackStatement) TokenLiteral() string { return us.Token.Literal }
+func (us *UnpackStatement) String() string {
+	var out bytes.Buffer
+
+	targets := []string{}
+	for _, t := range us.Targets {
+		targets = append(targets, t.String())
+	}
+
+	out.WriteString(us.TokenLiteral() + " (")
+	out.WriteString(strings.Join(targets, ", "))
+	out.WriteString(") = ")
+	out.WriteString(us.Value.String())
+	out.WriteString(";")
+
+	return out.String()
+}
+// ---- End UnpackStatement Block ----
+
+// ---- Start ForStatement Block ----
+type ForStatement struct {
+	Token    token.Token // the 'for' token
+	Targets  []*Identifier
+	Iterable Expression
+	Body     *BlockStatement
+}
+
+func (fs *ForStatement) Accept(v StatementVisitor) LigmaObject {
+	return v.VisitForStatement(fs)
+}
+func (fs *ForStatement) statementNode()       {}
+func (fs *ForStatement) TokenLiteral() string { return fs.Token.Literal }
+func (fs *ForStatement) String() string {
+	var out bytes.Buffer
+
+	targets := []string{}
+	for _, t := range fs.Targets {
+		targets = append(targets, t.String())
+	}
+
+	out.WriteString("for (")
+	out.WriteString(strings.Join(targets, ", "))
+	out.WriteString(" in ")
+	out.WriteString(fs.Iterable.String())
+	out.WriteString(") ")
+	out.WriteString(fs.Body.String())
+
+	return out.String()
+}
+// ---- End ForStatement Block ----
+
+// ---- Start WithStatement Block ----
+type WithStatement struct {
+	Token   token.Token // the 'with' token
+	Manager Expression  // the context manager expression
+	Name    *Identifier // optional 'as' binding
+	Body    *BlockStatement
+}
+
+func (ws *WithStatement) Accept(v StatementVisitor) LigmaObject {
+	return v.VisitWithStatement(ws)
+}
+func (ws *WithStatement) statementNode()       {}
+func (ws *WithStatement) TokenLiteral() string { return ws.Token.Literal }
+func (ws *WithStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("with (")
+	out.WriteString(ws.Manager.String())
+
+	if ws.Name != nil {
+		out.WriteString(" as ")
+		out.WriteString(ws.Name.String())
+	}
+
+	out.WriteString(") ")
+	out.WriteString(ws.Body.String())
+
+	return out.String()
+}
+// ---- End WithStatement Block ----
+
+// ---- Start AssertStatement Block ----
+type AssertStatement struct {
+	Token     token.Token // the 'assert' token
+	Condition Expression
+	Message   Expression // optional
+}
+
+func (as *AssertStatement) Accept(v StatementVisitor) LigmaObject {
+	return v.VisitAssertStatement(as)
+}
+func (as *AssertStatement) statementNode()       {}
+func (as *AssertStatement) TokenLiteral() string { return as.Token.Literal }
+func (as *AssertStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("assert ")
+	out.WriteString(as.Condition.String())
+
+	if as.Message != nil {
+		out.WriteString(", ")
+		out.WriteString(as.Message.String())
+	}
+
+	return out.String()
+}
+// ---- End AssertStatement Block ----
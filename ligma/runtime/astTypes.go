@@ -0,0 +1,40 @@
+package runtime
+
+import (
+	"bytes"
+	"ligma/token"
+	"strings"
+)
+
+// ---- Start TypeAnnotation Block ----
+
+// TypeAnnotation is an optional type written after a name, e.g. `int` or
+// `map[str, list[int]]`. The interpreter ignores annotations unless it runs
+// with type checks enabled, they are mostly there for tooling
+type TypeAnnotation struct {
+	Token  token.Token // the first token of the type
+	Name   string
+	Params []*TypeAnnotation
+}
+
+func (ta *TypeAnnotation) TokenLiteral() string { return ta.Token.Literal }
+func (ta *TypeAnnotation) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(ta.Name)
+
+	if len(ta.Params) > 0 {
+		params := []string{}
+		for _, p := range ta.Params {
+			params = append(params, p.String())
+		}
+
+		out.WriteString("[")
+		out.WriteString(strings.Join(params, ", "))
+		out.WriteString("]")
+	}
+
+	return out.String()
+}
+
+// ---- End TypeAnnotation Block ----
@@ -2,10 +2,17 @@ package runtime
 
 import (
 	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
 	"strings"
 	"time"
 )
 
+// Output is where print and runtime errors are written, an embedder can
+// point it somewhere other than standard error
+var Output io.Writer = os.Stderr
+
 var builtins = map[string]*Builtin{
 "len": {
 		Literal: "len",
@@ -33,11 +40,11 @@ var builtins = map[string]*Builtin{
 						// call the __str__ method
 						switch str := str.(type) {
 						case *BuiltinClassMethod:
-							println(str.Call(nil, instance).Inspect())
+							fmt.Fprintln(Output, str.Call(nil, instance).Inspect())
 						case *LigmaFunction:
 							res := str.Call(instance.interpreter, instance)
 							res = res.(*LigmaInstance).Fields["value"]
-							println(res.Inspect())
+							fmt.Fprintln(Output, res.Inspect())
 						}
 					}
 				}
@@ -51,7 +58,7 @@ var builtins = map[string]*Builtin{
 		Literal: "time",
 		Fn: func(args ...LigmaObject) LigmaObject {
 			t := time.Now().UnixMilli()
-			return builtinsClasses["int"].Call(nil, &LigmaInteger{Value: t})
+			return NewInteger(t)
 		},
 	},
 
@@ -64,7 +71,7 @@ var builtins = map[string]*Builtin{
 			if err != nil {
 				return NewError(err.Error())
 			}
-			return builtinsClasses["str"].Call(nil, &LigmaString{Value: input})
+			return NewString(input)
 		},
 		NumArgs: 1,
 	},
@@ -150,6 +157,236 @@ var builtins = map[string]*Builtin{
 	},
 }
 
+// reprOf renders an object the way it shows up inside a container,
+// instances go through their __repr__ method
+func reprOf(obj LigmaObject) string {
+	instance, ok := obj.(*LigmaInstance)
+	if !ok {
+		if obj == nil {
+			return "null"
+		}
+		return obj.Inspect()
+	}
+
+	repr, ok := instance.Get("__repr__")
+	if !ok {
+		return instance.Inspect()
+	}
+
+	res := repr.(LigmaCallable).Call(instance.interpreter, instance)
+	switch res := res.(type) {
+	case *LigmaString:
+		return res.Value
+	case *LigmaInstance:
+		if str, ok := res.Fields["value"].(*LigmaString); ok {
+			return str.Value
+		}
+	case nil:
+		return "null"
+	}
+	return res.Inspect()
+}
+
+// valuesEqual compares two values the way == does. Values wrapping builtin
+// types of different kinds are never equal, instances without their own
+// __eq__ are only equal to themselves
+func valuesEqual(a, b LigmaObject) bool {
+	left, ok := a.(*LigmaInstance)
+	if !ok {
+		return a == b
+	}
+	right, ok := b.(*LigmaInstance)
+	if !ok {
+		return false
+	}
+
+	switch l := left.Fields["value"].(type) {
+	case *LigmaInteger, *LigmaFloat:
+		lv, _ := numberValue(l)
+		rv, ok := numberValue(right.Fields["value"])
+		return ok && lv == rv
+	case *LigmaString:
+		r, ok := right.Fields["value"].(*LigmaString)
+		return ok && l.Value == r.Value
+	case *LigmaBoolean:
+		r, ok := right.Fields["value"].(*LigmaBoolean)
+		return ok && l.Value == r.Value
+	}
+
+	eq := left.Class.GetMethod("__eq__")
+	if eq == nil || eq.BuiltinMethod == builtinsClasses["object"].Methods.BuiltinMethods["__eq__"] {
+		return left == right
+	}
+
+	result := left.Eq(right)
+	return !isError(result) && IsTruthy(result)
+}
+
+func numberValue(obj LigmaObject) (float64, bool) {
+	switch obj := obj.(type) {
+	case *LigmaInteger:
+		return float64(obj.Value), true
+	case *LigmaFloat:
+		return obj.Value, true
+	}
+	return 0, false
+}
+
+func listRepr(list *LigmaList) string {
+	out := []string{}
+	for _, elem := range list.Elements {
+		out = append(out, reprOf(elem))
+	}
+	return "[" + strings.Join(out, ", ") + "]"
+}
+
+func tupleRepr(tuple *LigmaTuple) string {
+	out := []string{}
+	for _, elem := range tuple.Elements {
+		out = append(out, reprOf(elem))
+	}
+	if len(out) == 1 {
+		return "(" + out[0] + ",)"
+	}
+	return "(" + strings.Join(out, ", ") + ")"
+}
+
+// tupleElements returns the elements of a tuple instance
+func tupleElements(obj LigmaObject) ([]LigmaObject, bool) {
+	instance, ok := obj.(*LigmaInstance)
+	if !ok {
+		return nil, false
+	}
+	tuple, ok := instance.Fields["value"].(*LigmaTuple)
+	if !ok {
+		return nil, false
+	}
+	return tuple.Elements, true
+}
+
+func tuplesEqual(a, b LigmaObject) bool {
+	left, _ := tupleElements(a)
+	right, ok := tupleElements(b)
+	if !ok || len(left) != len(right) {
+		return false
+	}
+
+	for idx := range left {
+		if !valuesEqual(left[idx], right[idx]) {
+			return false
+		}
+	}
+	return true
+}
+
+// tupleLess orders tuples lexicographically, the first differing elements
+// decide and a tuple that is a prefix of the other is smaller
+func tupleLess(a, b LigmaObject) LigmaObject {
+	left, _ := tupleElements(a)
+	right, ok := tupleElements(b)
+	if !ok {
+		return NewError("cannot compare tuple with %s", b.Type())
+	}
+
+	for idx := 0; idx < len(left) && idx < len(right); idx++ {
+		if valuesEqual(left[idx], right[idx]) {
+			continue
+		}
+
+		l, lok := left[idx].(*LigmaInstance)
+		r, rok := right[idx].(*LigmaInstance)
+		if !lok || !rok {
+			return NewError("cannot compare %s with %s", left[idx].Type(), right[idx].Type())
+		}
+		return l.Lt(r)
+	}
+
+	return nativeBoolToBooleanObject(len(left) < len(right))
+}
+
+func setRepr(s *LigmaSet) string {
+	// {} is the empty map
+	if s.Len() == 0 {
+		return "set()"
+	}
+
+	out := []string{}
+	for _, elem := range sortedElements(s) {
+		out = append(out, reprOf(elem))
+	}
+	return "{" + strings.Join(out, ", ") + "}"
+}
+
+// makeSet hashes elements into a set, duplicates are dropped
+func makeSet(elements []LigmaObject) (*LigmaSet, LigmaObject) {
+	set := NewSet()
+
+	for _, element := range elements {
+		if err := set.Add(element); err != nil {
+			return nil, err
+		}
+	}
+
+	return set, nil
+}
+
+// setValue returns the LigmaSet wrapped by a set instance
+func setValue(obj LigmaObject) (*LigmaSet, bool) {
+	instance, ok := obj.(*LigmaInstance)
+	if !ok {
+		return nil, false
+	}
+	set, ok := instance.Fields["value"].(*LigmaSet)
+	return set, ok
+}
+
+// setOperation applies a binary set operator, keep decides which elements
+// of both operands end up in the result
+func setOperation(operator string, args []LigmaObject, keep func(inLeft, inRight bool) bool) LigmaObject {
+	left, _ := setValue(args[len(args)-1])
+	right, ok := setValue(args[0])
+	if !ok {
+		return NewError("unsupported operand types for %s: set and %s", operator, args[0].Type())
+	}
+
+	// the elements of both are hashable, so membership can't fail
+	result := NewSet()
+	for _, s := range []*LigmaSet{left, right} {
+		for _, element := range sortedElements(s) {
+			inLeft, _ := left.Contains(element)
+			inRight, _ := right.Contains(element)
+			if keep(inLeft, inRight) {
+				result.Add(element)
+			}
+		}
+	}
+
+	return builtinsClasses["set"].Call(nil, result)
+}
+
+func setsEqual(a, b LigmaObject) bool {
+	left, _ := setValue(a)
+	right, ok := setValue(b)
+	if !ok || left.Len() != right.Len() {
+		return false
+	}
+
+	for _, element := range sortedElements(left) {
+		if found, _ := right.Contains(element); !found {
+			return false
+		}
+	}
+	return true
+}
+
+func mapRepr(m *LigmaMap) string {
+	out := []string{}
+	for _, pair := range sortedPairs(m) {
+		out = append(out, reprOf(pair.Key)+": "+reprOf(pair.Value))
+	}
+	return "{" + strings.Join(out, ", ") + "}"
+}
+
 func DefineBuiltinTypes() {
 	// implement a metaclass for the built-in classes, metaclass instances are classes themselves
 	builtinsClasses["type"] = &LigmaClass{
@@ -197,22 +434,22 @@ func DefineBuiltinTypes() {
 									case "int":
 										my_val := self.Fields["value"].(*LigmaInteger).Value
 										other_val := other.Fields["value"].(*LigmaInteger).Value
-										return builtinsClasses["int"].Call(nil, &LigmaInteger{Value: my_val + other_val})
+										return NewInteger(my_val + other_val)
 									case "float":
 										my_val := float64(self.Fields["value"].(*LigmaInteger).Value)
 										other_val := other.Fields["value"].(*LigmaFloat).Value
-										return builtinsClasses["float"].Call(nil, &LigmaFloat{Value: my_val + other_val})
+										return NewFloat(my_val + other_val)
 									}
 							case "float":
 								switch other_type {
 									case "int":
 										my_val := self.Fields["value"].(*LigmaFloat).Value
 										other_val := float64(other.Fields["value"].(*LigmaInteger).Value)
-										return builtinsClasses["float"].Call(nil, &LigmaFloat{Value: my_val + other_val})
+										return NewFloat(my_val + other_val)
 									case "float":
 										my_val := self.Fields["value"].(*LigmaFloat).Value
 										other_val := other.Fields["value"].(*LigmaFloat).Value
-										return builtinsClasses["float"].Call(nil, &LigmaFloat{Value: my_val + other_val})
+										return NewFloat(my_val + other_val)
 									}
 						}
 						return NewError("unsupported operand type(s) for +: '%s' and '%s'", my_type, other_type)
@@ -235,22 +472,22 @@ func DefineBuiltinTypes() {
 									case "int":
 										my_val := self.Fields["value"].(*LigmaInteger).Value
 										other_val := other.Fields["value"].(*LigmaInteger).Value
-										return builtinsClasses["int"].Call(nil, &LigmaInteger{Value: my_val - other_val})
+										return NewInteger(my_val - other_val)
 									case "float":
 										my_val := float64(self.Fields["value"].(*LigmaInteger).Value)
 										other_val := other.Fields["value"].(*LigmaFloat).Value
-										return builtinsClasses["float"].Call(nil, &LigmaFloat{Value: my_val - other_val})
+										return NewFloat(my_val - other_val)
 									}
 							case "float":
 								switch other_type {
 									case "int":
 										my_val := self.Fields["value"].(*LigmaFloat).Value
 										other_val := float64(other.Fields["value"].(*LigmaInteger).Value)
-										return builtinsClasses["float"].Call(nil, &LigmaFloat{Value: my_val - other_val})
+										return NewFloat(my_val - other_val)
 									case "float":
 										my_val := self.Fields["value"].(*LigmaFloat).Value
 										other_val := other.Fields["value"].(*LigmaFloat).Value
-										return builtinsClasses["float"].Call(nil, &LigmaFloat{Value: my_val - other_val})
+										return NewFloat(my_val - other_val)
 									}
 						}
 						return NewError("unsupported operand type(s) for -: '%s' and '%s'", my_type, other_type)
@@ -274,22 +511,22 @@ func DefineBuiltinTypes() {
 									case "int":
 										my_val := self.Fields["value"].(*LigmaInteger).Value
 										other_val := other.Fields["value"].(*LigmaInteger).Value
-										return builtinsClasses["int"].Call(nil, &LigmaInteger{Value: my_val * other_val})
+										return NewInteger(my_val * other_val)
 									case "float":
 										my_val := float64(self.Fields["value"].(*LigmaInteger).Value)
 										other_val := other.Fields["value"].(*LigmaFloat).Value
-										return builtinsClasses["float"].Call(nil, &LigmaFloat{Value: my_val * other_val})
+										return NewFloat(my_val * other_val)
 								}
 							case "float":
 								switch other_type {
 									case "int":
 										my_val := self.Fields["value"].(*LigmaFloat).Value
 										other_val := float64(other.Fields["value"].(*LigmaInteger).Value)
-										return builtinsClasses["float"].Call(nil, &LigmaFloat{Value: my_val * other_val})
+										return NewFloat(my_val * other_val)
 									case "float":
 										my_val := self.Fields["value"].(*LigmaFloat).Value
 										other_val := other.Fields["value"].(*LigmaFloat).Value
-										return builtinsClasses["float"].Call(nil, &LigmaFloat{Value: my_val * other_val})
+										return NewFloat(my_val * other_val)
 								}
 						}
 						return NewError("unsupported operand type(s) for *: '%s' and '%s'", my_type, other_type)
@@ -312,22 +549,22 @@ func DefineBuiltinTypes() {
 									case "int":
 										my_val := self.Fields["value"].(*LigmaInteger).Value
 										other_val := other.Fields["value"].(*LigmaInteger).Value
-										return builtinsClasses["float"].Call(nil, &LigmaFloat{Value: float64(my_val) / float64(other_val)})
+										return NewFloat(float64(my_val) / float64(other_val))
 									case "float":
 										my_val := float64(self.Fields["value"].(*LigmaInteger).Value)
 										other_val := other.Fields["value"].(*LigmaFloat).Value
-										return builtinsClasses["float"].Call(nil, &LigmaFloat{Value: my_val / other_val})
+										return NewFloat(my_val / other_val)
 								}
 							case "float":
 								switch other_type {
 									case "int":
 										my_val := self.Fields["value"].(*LigmaFloat).Value
 										other_val := float64(other.Fields["value"].(*LigmaInteger).Value)
-										return builtinsClasses["float"].Call(nil, &LigmaFloat{Value: my_val / other_val})
+										return NewFloat(my_val / other_val)
 									case "float":
 										my_val := self.Fields["value"].(*LigmaFloat).Value
 										other_val := other.Fields["value"].(*LigmaFloat).Value
-										return builtinsClasses["float"].Call(nil, &LigmaFloat{Value: my_val / other_val})
+										return NewFloat(my_val / other_val)
 								}
 						}
 						return NewError("unsupported operand type(s) for /: '%s' and '%s'", my_type, other_type)
@@ -350,25 +587,25 @@ func DefineBuiltinTypes() {
 									case "int":
 										my_val := self.Fields["value"].(*LigmaInteger).Value
 										other_val := other.Fields["value"].(*LigmaInteger).Value
-										return builtinsClasses["int"].Call(nil, &LigmaInteger{Value: my_val % other_val})
+										return NewInteger(my_val % other_val)
 									case "float":
 										my_val := float64(self.Fields["value"].(*LigmaInteger).Value)
 										other_val := other.Fields["value"].(*LigmaFloat).Value
-										return builtinsClasses["float"].Call(nil, &LigmaFloat{Value: float64(int64(my_val) % int64(other_val))})
+										return NewFloat(float64(int64(my_val) % int64(other_val)))
 								}
 							case "float":
 								switch other_type {
 									case "int":
 										my_val := self.Fields["value"].(*LigmaFloat).Value
 										other_val := float64(other.Fields["value"].(*LigmaInteger).Value)
-										return builtinsClasses["float"].Call(nil, &LigmaFloat{Value: float64(int64(my_val) % int64(other_val))})
+										return NewFloat(float64(int64(my_val) % int64(other_val)))
 									case "float":
 										my_val := self.Fields["value"].(*LigmaFloat).Value
 										other_val := other.Fields["value"].(*LigmaFloat).Value
-										return builtinsClasses["float"].Call(nil, &LigmaFloat{Value: float64(int64(my_val) % int64(other_val))})
+										return NewFloat(float64(int64(my_val) % int64(other_val)))
 								}
 						}
-						return NewError("unsupported operand type(s) for %: '%s' and '%s'", my_type, other_type)
+						return NewError("unsupported operand type(s) for %%: '%s' and '%s'", my_type, other_type)
 					},
 				},
 				"__eq__": {
@@ -660,19 +897,30 @@ func DefineBuiltinTypes() {
 					Literal: "__repr__",
 					Fn: func(args ...LigmaObject) LigmaObject {
 						self := args[len(args)-1].(*LigmaInstance)
-						elements := self.Fields["value"].(*LigmaList).Elements
-						var out []string
-						for _, elem := range elements {
-							// check if the element has a __repr__ method
-							repr, ok := elem.(*LigmaInstance).Get("__repr__")
-							if ok {
-								repr_callable := repr.(LigmaCallable)
-								res := repr_callable.Call(nil, elem)
-								out = append(out, res.(*LigmaString).Value)
+						return &LigmaString{Value: listRepr(self.Fields["value"].(*LigmaList))}
+					},
+				},
+
+				"__str__": {
+					Literal: "__str__",
+					Fn: func(args ...LigmaObject) LigmaObject {
+						self := args[len(args)-1].(*LigmaInstance)
+						return &LigmaString{Value: listRepr(self.Fields["value"].(*LigmaList))}
+					},
+				},
+
+				"__contains__": {
+					Literal: "__contains__",
+					Fn: func(args ...LigmaObject) LigmaObject {
+						self := args[len(args)-1].(*LigmaInstance)
+						for _, element := range self.Fields["value"].(*LigmaList).Elements {
+							if valuesEqual(element, args[0]) {
+								return TRUE
 							}
 						}
-						return &LigmaString{Value: "[" + strings.Join(out, ", ") + "]"}
+						return FALSE
 					},
+					NumArgs: 1,
 				},
 
 				"__get__": {
@@ -695,6 +943,306 @@ func DefineBuiltinTypes() {
 		Superclasses: []*LigmaClass{builtinsClasses["container"]},
 	}
 
+	// tuples are immutable, they compare and hash by their elements
+	builtinsClasses["tuple"] = &LigmaClass{
+		Name: "tuple",
+		Methods: ClassMethods{
+			BuiltinMethods: map[string]*BuiltinClassMethod{
+				"init": {
+					Literal: "init",
+					Fn: func(args ...LigmaObject) LigmaObject {
+						self := args[len(args)-1].(*LigmaInstance)
+						args = args[:len(args)-1]
+
+						if len(args) == 0 {
+							self.Fields["value"] = &LigmaTuple{Elements: []LigmaObject{}}
+							return nil
+						}
+
+						switch arg := args[0].(type) {
+						case *LigmaTuple:
+							self.Fields["value"] = arg
+						case *LigmaInstance:
+							elements := unpackValues(arg)
+							if elements == nil {
+								return NewError("cannot make a tuple from %s", arg.Type())
+							}
+							self.Fields["value"] = &LigmaTuple{Elements: append([]LigmaObject{}, elements...)}
+						}
+						return nil
+					},
+					NumArgs: 1,
+				},
+
+				"__repr__": {
+					Literal: "__repr__",
+					Fn: func(args ...LigmaObject) LigmaObject {
+						self := args[len(args)-1].(*LigmaInstance)
+						return &LigmaString{Value: tupleRepr(self.Fields["value"].(*LigmaTuple))}
+					},
+				},
+
+				"__str__": {
+					Literal: "__str__",
+					Fn: func(args ...LigmaObject) LigmaObject {
+						self := args[len(args)-1].(*LigmaInstance)
+						return &LigmaString{Value: tupleRepr(self.Fields["value"].(*LigmaTuple))}
+					},
+				},
+
+				"__len__": {
+					Literal: "__len__",
+					Fn: func(args ...LigmaObject) LigmaObject {
+						self := args[len(args)-1].(*LigmaInstance)
+						return NewInteger(int64(len(self.Fields["value"].(*LigmaTuple).Elements)))
+					},
+				},
+
+				"__eq__": {
+					Literal: "__eq__",
+					Fn: func(args ...LigmaObject) LigmaObject {
+						self := args[len(args)-1].(*LigmaInstance)
+						return nativeBoolToBooleanObject(tuplesEqual(self, args[0]))
+					},
+					NumArgs: 1,
+				},
+
+				"__ne__": {
+					Literal: "__ne__",
+					Fn: func(args ...LigmaObject) LigmaObject {
+						self := args[len(args)-1].(*LigmaInstance)
+						return nativeBoolToBooleanObject(!tuplesEqual(self, args[0]))
+					},
+					NumArgs: 1,
+				},
+
+				"__lt__": {
+					Literal: "__lt__",
+					Fn: func(args ...LigmaObject) LigmaObject {
+						self := args[len(args)-1].(*LigmaInstance)
+						return tupleLess(self, args[0])
+					},
+					NumArgs: 1,
+				},
+
+				"__hash__": {
+					Literal: "__hash__",
+					Fn: func(args ...LigmaObject) LigmaObject {
+						self := args[len(args)-1].(*LigmaInstance)
+						key, err := self.Fields["value"].(*LigmaTuple).hashKey()
+						if err != nil {
+							return err
+						}
+						return NewInteger(int64(key.Value))
+					},
+				},
+
+				"__contains__": {
+					Literal: "__contains__",
+					Fn: func(args ...LigmaObject) LigmaObject {
+						self := args[len(args)-1].(*LigmaInstance)
+						for _, element := range self.Fields["value"].(*LigmaTuple).Elements {
+							if valuesEqual(element, args[0]) {
+								return TRUE
+							}
+						}
+						return FALSE
+					},
+					NumArgs: 1,
+				},
+
+				"__get__": {
+					Literal: "__get__",
+					Fn: func(args ...LigmaObject) LigmaObject {
+						self := args[len(args)-1].(*LigmaInstance)
+						index := args[0].(*LigmaInstance).Fields["value"].(*LigmaInteger).Value
+						elements := self.Fields["value"].(*LigmaTuple).Elements
+
+						if index < 0 || index >= int64(len(elements)) {
+							return NewError("index out of range")
+						}
+
+						return elements[index]
+					},
+					NumArgs: 1,
+				},
+			},
+		},
+		Superclasses: []*LigmaClass{builtinsClasses["container"]},
+	}
+
+	// sets hash their elements the same way maps hash their keys
+	builtinsClasses["set"] = &LigmaClass{
+		Name: "set",
+		Methods: ClassMethods{
+			BuiltinMethods: map[string]*BuiltinClassMethod{
+				"init": {
+					Literal: "init",
+					Fn: func(args ...LigmaObject) LigmaObject {
+						self := args[len(args)-1].(*LigmaInstance)
+						args = args[:len(args)-1]
+
+						// `{}` is an empty map, so set() is the only way to write an empty set
+						if len(args) == 0 {
+							self.Fields["value"] = NewSet()
+							return nil
+						}
+						if len(args) > 1 {
+							return NewError("set expects at most one argument, got %d", len(args))
+						}
+
+						switch arg := args[0].(type) {
+						case *LigmaSet:
+							self.Fields["value"] = arg
+						case *LigmaInstance:
+							var elements []LigmaObject
+							switch value := arg.Fields["value"].(type) {
+							case *LigmaSet:
+								elements = sortedElements(value)
+							case *LigmaMap:
+								for _, pair := range sortedPairs(value) {
+									elements = append(elements, pair.Key)
+								}
+							default:
+								elements = unpackValues(arg)
+								if elements == nil {
+									return NewError("cannot make a set from %s", arg.Type())
+								}
+							}
+
+							set, err := makeSet(elements)
+							if err != nil {
+								return err
+							}
+							self.Fields["value"] = set
+						}
+						return nil
+					},
+					NumArgs: -1,
+				},
+
+				"__repr__": {
+					Literal: "__repr__",
+					Fn: func(args ...LigmaObject) LigmaObject {
+						self := args[len(args)-1].(*LigmaInstance)
+						return &LigmaString{Value: setRepr(self.Fields["value"].(*LigmaSet))}
+					},
+				},
+
+				"__str__": {
+					Literal: "__str__",
+					Fn: func(args ...LigmaObject) LigmaObject {
+						self := args[len(args)-1].(*LigmaInstance)
+						return &LigmaString{Value: setRepr(self.Fields["value"].(*LigmaSet))}
+					},
+				},
+
+				"__len__": {
+					Literal: "__len__",
+					Fn: func(args ...LigmaObject) LigmaObject {
+						self := args[len(args)-1].(*LigmaInstance)
+						return NewInteger(int64(self.Fields["value"].(*LigmaSet).Len()))
+					},
+				},
+
+				"add": {
+					Literal: "add",
+					Fn: func(args ...LigmaObject) LigmaObject {
+						self := args[len(args)-1].(*LigmaInstance)
+						if err := self.Fields["value"].(*LigmaSet).Add(args[0]); err != nil {
+							return err
+						}
+						return NULL
+					},
+					NumArgs: 1,
+				},
+
+				"remove": {
+					Literal: "remove",
+					Fn: func(args ...LigmaObject) LigmaObject {
+						self := args[len(args)-1].(*LigmaInstance)
+						set := self.Fields["value"].(*LigmaSet)
+
+						found, err := set.Remove(args[0])
+						if err != nil {
+							return err
+						}
+						if !found {
+							return NewError("%s not in set", reprOf(args[0]))
+						}
+						return NULL
+					},
+					NumArgs: 1,
+				},
+
+				"contains": {
+					Literal: "contains",
+					Fn: func(args ...LigmaObject) LigmaObject {
+						self := args[len(args)-1].(*LigmaInstance)
+						return self.Contains(args[0])
+					},
+					NumArgs: 1,
+				},
+
+				"__contains__": {
+					Literal: "__contains__",
+					Fn: func(args ...LigmaObject) LigmaObject {
+						self := args[len(args)-1].(*LigmaInstance)
+						found, err := self.Fields["value"].(*LigmaSet).Contains(args[0])
+						if err != nil {
+							return err
+						}
+						return nativeBoolToBooleanObject(found)
+					},
+					NumArgs: 1,
+				},
+
+				"__or__": {
+					Literal: "__or__",
+					Fn: func(args ...LigmaObject) LigmaObject {
+						return setOperation("|", args, func(inLeft, inRight bool) bool { return inLeft || inRight })
+					},
+					NumArgs: 1,
+				},
+
+				"__and__": {
+					Literal: "__and__",
+					Fn: func(args ...LigmaObject) LigmaObject {
+						return setOperation("&", args, func(inLeft, inRight bool) bool { return inLeft && inRight })
+					},
+					NumArgs: 1,
+				},
+
+				"__sub__": {
+					Literal: "__sub__",
+					Fn: func(args ...LigmaObject) LigmaObject {
+						return setOperation("-", args, func(inLeft, inRight bool) bool { return inLeft && !inRight })
+					},
+					NumArgs: 1,
+				},
+
+				"__eq__": {
+					Literal: "__eq__",
+					Fn: func(args ...LigmaObject) LigmaObject {
+						self := args[len(args)-1].(*LigmaInstance)
+						return nativeBoolToBooleanObject(setsEqual(self, args[0]))
+					},
+					NumArgs: 1,
+				},
+
+				"__ne__": {
+					Literal: "__ne__",
+					Fn: func(args ...LigmaObject) LigmaObject {
+						self := args[len(args)-1].(*LigmaInstance)
+						return nativeBoolToBooleanObject(!setsEqual(self, args[0]))
+					},
+					NumArgs: 1,
+				},
+			},
+		},
+		Superclasses: []*LigmaClass{builtinsClasses["container"]},
+	}
+
 	builtinsClasses["map"] = &LigmaClass{
 		Name: "map",
 		Methods: ClassMethods{
@@ -706,7 +1254,7 @@ func DefineBuiltinTypes() {
 						args = args[:len(args)-1]
 
 						if len(args) == 0 {
-							self.Fields["value"] = &LigmaMap{Pairs: map[MapKey]MapPair{}}
+							self.Fields["value"] = NewMap()
 						} else {
 							switch arg := args[0].(type) {
 							case *LigmaMap:
@@ -721,10 +1269,32 @@ func DefineBuiltinTypes() {
 				"__repr__": {
 					Literal: "__repr__",
 					Fn: func(args ...LigmaObject) LigmaObject {
-						return NewError("Not implemented")
+						self := args[len(args)-1].(*LigmaInstance)
+						return &LigmaString{Value: mapRepr(self.Fields["value"].(*LigmaMap))}
 					},
 				},
 
+				"__str__": {
+					Literal: "__str__",
+					Fn: func(args ...LigmaObject) LigmaObject {
+						self := args[len(args)-1].(*LigmaInstance)
+						return &LigmaString{Value: mapRepr(self.Fields["value"].(*LigmaMap))}
+					},
+				},
+
+				"__contains__": {
+					Literal: "__contains__",
+					Fn: func(args ...LigmaObject) LigmaObject {
+						self := args[len(args)-1].(*LigmaInstance)
+						_, found, err := self.Fields["value"].(*LigmaMap).Get(args[0])
+						if err != nil {
+							return err
+						}
+						return nativeBoolToBooleanObject(found)
+					},
+					NumArgs: 1,
+				},
+
 				"__get__": {
 					Literal: "__get__",
 					Fn: func(args ...LigmaObject) LigmaObject {
@@ -733,15 +1303,15 @@ func DefineBuiltinTypes() {
 
 						mapObj := self.Fields["value"].(*LigmaMap)
 
-						index := args[0]
-						key := index.(*LigmaInstance).Fields["value"].(LigmaHashable)
-
-						pair, ok := mapObj.Pairs[key.MapKey()]
+						value, ok, err := mapObj.Get(args[0])
+						if err != nil {
+							return err
+						}
 						if !ok {
 							return NewError("key not found")
 						}
 
-						return pair.Value
+						return value
 
 					},
 					NumArgs: 1,
@@ -792,7 +1362,7 @@ func DefineBuiltinTypes() {
 							return NewError("index out of range")
 						}
 
-						return builtinsClasses["str"].Call(nil, &LigmaString{Value: str[start:end]})
+						return NewString(str[start:end])
 					},
 					NumArgs: 2,
 				},
@@ -806,7 +1376,7 @@ func DefineBuiltinTypes() {
 						new := args[1].(*LigmaInstance).Fields["value"].(*LigmaString).Value
 						str := self.Fields["value"].(*LigmaString).Value
 
-						return builtinsClasses["str"].Call(nil, &LigmaString{Value: strings.Replace(str, old, new, -1)})
+						return NewString(strings.Replace(str, old, new, -1))
 					},
 					NumArgs: 2,
 				},
@@ -821,13 +1391,29 @@ func DefineBuiltinTypes() {
 
 						var parts []LigmaObject
 						for _, part := range strings.Split(str, sep) {
-							parts = append(parts, builtinsClasses["str"].Call(nil, &LigmaString{Value: part}))
+							parts = append(parts, NewString(part))
 						}
 
 						return builtinsClasses["list"].Call(nil, parts...)
 					},
 					NumArgs: 1,
 				},
+				"__contains__": {
+					Literal: "__contains__",
+					Fn: func(args ...LigmaObject) LigmaObject {
+						self := args[len(args)-1].(*LigmaInstance)
+						other, ok := args[0].(*LigmaInstance)
+						if !ok {
+							return NewError("'in <str>' requires str as left operand, not %s", args[0].Type())
+						}
+						sub, ok := other.Fields["value"].(*LigmaString)
+						if !ok {
+							return NewError("'in <str>' requires str as left operand, not %s", other.Type())
+						}
+						return nativeBoolToBooleanObject(strings.Contains(self.Fields["value"].(*LigmaString).Value, sub.Value))
+					},
+					NumArgs: 1,
+				},
 				"__get__": {
 					Literal: "__get__",
 					Fn: func(args ...LigmaObject) LigmaObject {
@@ -839,7 +1425,7 @@ func DefineBuiltinTypes() {
 							return NewError("index out of range")
 						}
 
-						return builtinsClasses["str"].Call(nil, &LigmaString{Value: string(str[index])})
+						return NewString(string(str[index]))
 
 					},
 					NumArgs: 1,
@@ -868,7 +1454,7 @@ func DefineBuiltinTypes() {
 					Fn: func(args ...LigmaObject) LigmaObject {
 						self := args[len(args)-1].(*LigmaInstance)
 						str_list := self.Fields["value"].(*LigmaList)
-						return builtinsClasses["int"].Call(nil, &LigmaInteger{Value: int64(len(str_list.Elements))})
+						return NewInteger(int64(len(str_list.Elements)))
 					},
 				},
 
@@ -882,7 +1468,7 @@ func DefineBuiltinTypes() {
 						other := args[0].(*LigmaInstance)
 						other_str := other.Fields["value"].(*LigmaString).Value
 
-						return builtinsClasses["str"].Call(nil, &LigmaString{Value: my_str + other_str})
+						return NewString(my_str + other_str)
 					},
 				},
 
@@ -904,4 +1490,240 @@ func DefineBuiltinTypes() {
 		},
 		Superclasses: []*LigmaClass{builtinsClasses["container"]},
 	}
+
+	// base class of every enum, members are compared by identity and ordered by value
+	builtinsClasses["enum"] = &LigmaClass{
+		Name: "enum",
+		Methods: ClassMethods{
+			BuiltinMethods: map[string]*BuiltinClassMethod{
+				"__repr__": {
+					Literal: "__repr__",
+					Fn: func(args ...LigmaObject) LigmaObject {
+						self := args[len(args)-1].(*LigmaInstance)
+						return &LigmaString{Value: enumMemberName(self)}
+					},
+				},
+				"__str__": {
+					Literal: "__str__",
+					Fn: func(args ...LigmaObject) LigmaObject {
+						self := args[len(args)-1].(*LigmaInstance)
+						return &LigmaString{Value: enumMemberName(self)}
+					},
+				},
+				"__eq__": {
+					Literal: "__eq__",
+					Fn: func(args ...LigmaObject) LigmaObject {
+						self := args[len(args)-1].(*LigmaInstance)
+						return nativeBoolToBooleanObject(args[0] == self)
+					},
+					NumArgs: 1,
+				},
+				"__ne__": {
+					Literal: "__ne__",
+					Fn: func(args ...LigmaObject) LigmaObject {
+						self := args[len(args)-1].(*LigmaInstance)
+						return nativeBoolToBooleanObject(args[0] != self)
+					},
+					NumArgs: 1,
+				},
+				"__lt__": {
+					Literal: "__lt__",
+					Fn: func(args ...LigmaObject) LigmaObject {
+						self := args[len(args)-1].(*LigmaInstance)
+						other, ok := args[0].(*LigmaInstance)
+						if !ok || other.Class != self.Class {
+							return NewError("cannot compare %s with %s", self.Type(), args[0].Type())
+						}
+						return self.Fields["value"].(*LigmaInstance).Lt(other.Fields["value"])
+					},
+					NumArgs: 1,
+				},
+				"__hash__": {
+					Literal: "__hash__",
+					Fn: func(args ...LigmaObject) LigmaObject {
+						self := args[len(args)-1].(*LigmaInstance)
+						hash := (&LigmaString{Value: enumMemberName(self)}).MapKey().Value
+						return NewInteger(int64(hash))
+					},
+				},
+			},
+		},
+		Superclasses: []*LigmaClass{builtinsClasses["object"]},
+	}
+
+	// base class of every record, fields are compared, hashed and printed in declaration order
+	builtinsClasses["record"] = &LigmaClass{
+		Name: "record",
+		Methods: ClassMethods{
+			BuiltinMethods: map[string]*BuiltinClassMethod{
+				"__repr__": {
+					Literal: "__repr__",
+					Fn: func(args ...LigmaObject) LigmaObject {
+						self := args[len(args)-1].(*LigmaInstance)
+						return &LigmaString{Value: recordRepr(self)}
+					},
+				},
+				"__str__": {
+					Literal: "__str__",
+					Fn: func(args ...LigmaObject) LigmaObject {
+						self := args[len(args)-1].(*LigmaInstance)
+						return &LigmaString{Value: recordRepr(self)}
+					},
+				},
+				"__eq__": {
+					Literal: "__eq__",
+					Fn: func(args ...LigmaObject) LigmaObject {
+						self := args[len(args)-1].(*LigmaInstance)
+						return nativeBoolToBooleanObject(recordsEqual(self, args[0]))
+					},
+					NumArgs: 1,
+				},
+				"__ne__": {
+					Literal: "__ne__",
+					Fn: func(args ...LigmaObject) LigmaObject {
+						self := args[len(args)-1].(*LigmaInstance)
+						return nativeBoolToBooleanObject(!recordsEqual(self, args[0]))
+					},
+					NumArgs: 1,
+				},
+				"__hash__": {
+					Literal: "__hash__",
+					Fn: func(args ...LigmaObject) LigmaObject {
+						self := args[len(args)-1].(*LigmaInstance)
+
+						h := fnv.New64a()
+						h.Write([]byte(self.Class.Name))
+						for _, name := range self.Class.Record {
+							key, err := HashKey(self.Fields[name])
+							if err != nil {
+								return err
+							}
+							fmt.Fprintf(h, "|%s:%d", key.Type, key.Value)
+						}
+						return NewInteger(int64(h.Sum64()))
+					},
+				},
+				"with": {
+					Literal: "with",
+					Fn: func(args ...LigmaObject) LigmaObject {
+						self := args[len(args)-1].(*LigmaInstance)
+
+						// `p.with(x = 5)` passes the null result of an assignment
+						if len(args) < 2 || args[0] == nil {
+							return NewError("with expects a map of changes")
+						}
+
+						changes, ok := args[0].(*LigmaInstance)
+						if !ok {
+							return NewError("with expects a map of changes, got %s", args[0].Type())
+						}
+						pairs, ok := changes.Fields["value"].(*LigmaMap)
+						if !ok {
+							return NewError("with expects a map of changes, got %s", args[0].Type())
+						}
+
+						fields := map[string]LigmaObject{}
+						for name, value := range self.Fields {
+							fields[name] = value
+						}
+
+						for _, pair := range sortedPairs(pairs) {
+							name := reprOf(pair.Key)
+							if _, ok := fields[name]; !ok {
+								return NewError("%s has no field %s", self.Class.Name, name)
+							}
+							fields[name] = pair.Value
+						}
+
+						return &LigmaInstance{Class: self.Class, Fields: fields, interpreter: self.interpreter}
+					},
+					NumArgs: 1,
+				},
+			},
+		},
+		Superclasses: []*LigmaClass{builtinsClasses["object"]},
+	}
+
+	// generators are created by calling a function that contains yield
+	builtinsClasses["generator"] = &LigmaClass{
+		Name: "generator",
+		Methods: ClassMethods{
+			BuiltinMethods: map[string]*BuiltinClassMethod{
+				"next": {
+					Literal: "next",
+					Fn: func(args ...LigmaObject) LigmaObject {
+						self := args[len(args)-1].(*LigmaInstance)
+						return resumeGenerator(self, NULL)
+					},
+				},
+				"send": {
+					Literal: "send",
+					Fn: func(args ...LigmaObject) LigmaObject {
+						self := args[len(args)-1].(*LigmaInstance)
+						return resumeGenerator(self, args[0])
+					},
+					NumArgs: 1,
+				},
+				"close": {
+					Literal: "close",
+					Fn: func(args ...LigmaObject) LigmaObject {
+						self := args[len(args)-1].(*LigmaInstance)
+						return self.Fields["value"].(*LigmaGenerator).Close()
+					},
+				},
+				"__iter__": {
+					Literal: "__iter__",
+					Fn: func(args ...LigmaObject) LigmaObject {
+						return args[len(args)-1]
+					},
+				},
+				"__repr__": {
+					Literal: "__repr__",
+					Fn: func(args ...LigmaObject) LigmaObject {
+						return &LigmaString{Value: "<generator>"}
+					},
+				},
+			},
+		},
+		Superclasses: []*LigmaClass{builtinsClasses["object"]},
+	}
+}
+
+// resumeGenerator backs next and send, resuming a finished generator is an error
+func resumeGenerator(self *LigmaInstance, value LigmaObject) LigmaObject {
+	result, ok := self.Fields["value"].(*LigmaGenerator).send(value)
+	if !ok {
+		return NewError("generator is exhausted")
+	}
+	return result
+}
+
+// recordRepr renders a record as Name(field=value, ...)
+func recordRepr(record *LigmaInstance) string {
+	fields := []string{}
+	for _, name := range record.Class.Record {
+		fields = append(fields, name+"="+reprOf(record.Fields[name]))
+	}
+	return record.Class.Name + "(" + strings.Join(fields, ", ") + ")"
+}
+
+// recordsEqual reports whether other is a record of the same class with equal fields
+func recordsEqual(record *LigmaInstance, other LigmaObject) bool {
+	otherRecord, ok := other.(*LigmaInstance)
+	if !ok || otherRecord.Class != record.Class {
+		return false
+	}
+
+	for _, name := range record.Class.Record {
+		if !valuesEqual(record.Fields[name], otherRecord.Fields[name]) {
+			return false
+		}
+	}
+	return true
+}
+
+// enumMemberName renders an enum member as Enum.Member
+func enumMemberName(member *LigmaInstance) string {
+	name := member.Fields["name"].(*LigmaInstance).Fields["value"].(*LigmaString).Value
+	return member.Class.Name + "." + name
 }
\ No newline at end of file
@@ -0,0 +1,74 @@
+package runtime
+
+import (
+	"fmt"
+	"ligma/token"
+)
+
+// Diagnostic is a problem found in a program before it runs, positioned at
+// the token where it was detected
+type Diagnostic struct {
+	Line    int
+	Column  int
+	Message string
+	Rule    string // the lint rule that produced it, empty for errors
+}
+
+func newDiagnostic(tok token.Token, format string, a ...interface{}) Diagnostic {
+	return Diagnostic{Line: tok.Line, Column: tok.Column, Message: fmt.Sprintf(format, a...)}
+}
+
+func (d Diagnostic) String() string {
+	if d.Rule != "" {
+		return fmt.Sprintf("%d:%d: %s [%s]", d.Line, d.Column, d.Message, d.Rule)
+	}
+	return fmt.Sprintf("%d:%d: %s", d.Line, d.Column, d.Message)
+}
+
+// suggestName returns the candidate closest to name by edit distance, or an
+// empty string when none is close enough to be a likely typo
+func suggestName(name string, candidates []string) string {
+	best, bestDistance := "", (len(name)+1)/3+1
+
+	for _, candidate := range candidates {
+		if candidate == name {
+			continue
+		}
+
+		d := editDistance(name, candidate)
+		if d < bestDistance || (d == bestDistance && best != "" && candidate < best) {
+			best, bestDistance = candidate, d
+		}
+	}
+
+	return best
+}
+
+// editDistance counts the insertions, deletions, substitutions and swaps of
+// adjacent characters needed to turn a into b
+func editDistance(a, b string) int {
+	rows := make([][]int, len(a)+1)
+	for i := range rows {
+		rows[i] = make([]int, len(b)+1)
+		rows[i][0] = i
+	}
+	for j := range rows[0] {
+		rows[0][j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			rows[i][j] = min(rows[i-1][j]+1, rows[i][j-1]+1, rows[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				rows[i][j] = min(rows[i][j], rows[i-2][j-2]+1)
+			}
+		}
+	}
+
+	return rows[len(a)][len(b)]
+}
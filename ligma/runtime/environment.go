@@ -1,7 +1,13 @@
 package runtime
 
+// Environment holds the variables of one scope. Globals, and whatever else
+// is bound by name, live in store. Locals live in slots, at the index the
+// Resolver gave them, and are reached through GetAt and SetAt
 type Environment struct {
 	store map[string]LigmaObject
+	slots []LigmaObject
+	constants map[string]bool // names bound with const
+	constantSlots map[int]string // names of the slots bound with const
 	parent *Environment
 }
 
@@ -20,10 +26,54 @@ func (e *Environment) Get(name string) (LigmaObject, bool) {
 }
 
 func (e *Environment) Set(name string, val LigmaObject) LigmaObject {
+	if e.constants[name] {
+		return NewError("cannot assign to constant %s", name)
+	}
+	if e.store == nil {
+		e.store = make(map[string]LigmaObject)
+	}
 	e.store[name] = val
 	return val
 }
 
+// SetConstant binds name to val, later Set calls for it fail
+func (e *Environment) SetConstant(name string, val LigmaObject) LigmaObject {
+	result := e.Set(name, val)
+	if isError(result) {
+		return result
+	}
+
+	if e.constants == nil {
+		e.constants = make(map[string]bool)
+	}
+	e.constants[name] = true
+	return val
+}
+
+// Define stores a local in its slot, the slots grow as locals are declared
+func (e *Environment) Define(slot int, val LigmaObject) {
+	for len(e.slots) <= slot {
+		e.slots = append(e.slots, nil)
+	}
+	e.slots[slot] = val
+}
+
+// DefineConstant stores the local called name in its slot, later SetAt
+// calls for it fail
+func (e *Environment) DefineConstant(slot int, name string, val LigmaObject) {
+	e.Define(slot, val)
+
+	if e.constantSlots == nil {
+		e.constantSlots = make(map[int]string)
+	}
+	e.constantSlots[slot] = name
+}
+
+// Parent returns the enclosing environment, nil for the globals
+func (e *Environment) Parent() *Environment {
+	return e.parent
+}
+
 func (e *Environment) ancestor(distance int) *Environment {
 	env := e
 	for i := 0; i < distance; i++ {
@@ -32,21 +82,30 @@ func (e *Environment) ancestor(distance int) *Environment {
 	return env
 }
 
-func (e *Environment) GetAt(distance int, name string) (LigmaObject, bool) {
+// GetAt reads the local in slot of the environment distance scopes up,
+// a local that hasn't been defined yet reads as missing
+func (e *Environment) GetAt(distance int, slot int) (LigmaObject, bool) {
 	env := e.ancestor(distance)
-	obj, ok := env.store[name]
-	return obj, ok
+	if slot >= len(env.slots) {
+		return nil, false
+	}
+	return env.slots[slot], true
 }
 
-func (e *Environment) SetAt(distance int, name string, val LigmaObject) LigmaObject {
+// SetAt assigns the local in slot of the environment distance scopes up
+func (e *Environment) SetAt(distance int, slot int, val LigmaObject) LigmaObject {
 	env := e.ancestor(distance)
-	env.store[name] = val
+	if name, ok := env.constantSlots[slot]; ok {
+		return NewError("cannot assign to constant %s", name)
+	}
+
+	env.Define(slot, val)
 	return val
 }
 
 
+// NewEnclosedEnvironment returns an environment for a local scope, its
+// store is only made if something is bound in it by name
 func NewEnclosedEnvironment(parent *Environment) *Environment {
-	env := NewEnvironment()
-	env.parent = parent
-	return env
-}
\ No newline at end of file
+	return &Environment{parent: parent}
+}
@@ -0,0 +1,40 @@
+package runtime_test
+
+import (
+	"io"
+	"testing"
+
+	"ligma/runtime"
+)
+
+// the resolver rejects programs that assign constants, the environment
+// guards them again for code it didn't see
+func TestEnvironmentGuardsConstants(t *testing.T) {
+	previous := runtime.Output
+	runtime.Output = io.Discard
+	defer func() { runtime.Output = previous }()
+
+	one, two := &runtime.LigmaInteger{Value: 1}, &runtime.LigmaInteger{Value: 2}
+
+	globals := runtime.NewEnvironment()
+	globals.SetConstant("g", one)
+	if err, ok := globals.Set("g", two).(*runtime.Error); !ok || err.Message != "cannot assign to constant g" {
+		t.Errorf("assigning a constant global should fail, got %v", err)
+	}
+
+	local := runtime.NewEnclosedEnvironment(globals)
+	local.DefineConstant(0, "k", one)
+	local.Define(1, one)
+	inner := runtime.NewEnclosedEnvironment(local)
+
+	if err, ok := inner.SetAt(1, 0, two).(*runtime.Error); !ok || err.Message != "cannot assign to constant k" {
+		t.Errorf("assigning a constant local should fail, got %v", err)
+	}
+	if value, _ := local.GetAt(0, 0); value != one {
+		t.Errorf("a constant local changed to %v", value.Inspect())
+	}
+
+	if result := inner.SetAt(1, 1, two); result != two {
+		t.Errorf("assigning a local should work, got %v", result)
+	}
+}
@@ -0,0 +1,720 @@
+package runtime
+
+import (
+	"sort"
+	"ligma/token"
+)
+
+// BasicBlock is a run of nodes that execute one after the other, control
+// only enters at the top and leaves at the bottom. Statements that branch
+// are split up: an if, while or for contributes its condition or iterable
+// to the block that decides where to go next, the bodies get blocks of
+// their own
+type BasicBlock struct {
+	Nodes        []Node
+	Successors   []*BasicBlock
+	Predecessors []*BasicBlock
+}
+
+// ControlFlowGraph connects the basic blocks of a function body or of the
+// top level code. Returns and falling off the end both lead to Exit
+type ControlFlowGraph struct {
+	Entry  *BasicBlock
+	Exit   *BasicBlock
+	Blocks []*BasicBlock // in source order, Exit comes last
+
+	end       *BasicBlock // the block that falls off the end
+	returns   int         // number of return statements
+	loops     []*cfgLoop
+	reachable map[*BasicBlock]bool
+}
+
+// cfgLoop remembers a `while (true)` and how many returns its body has
+type cfgLoop struct {
+	token token.Token
+	exits int
+}
+
+type cfgBuilder struct {
+	graph   *ControlFlowGraph
+	current *BasicBlock
+}
+
+// BuildCFG builds the control flow graph of a list of statements, the
+// bodies of nested functions are left out, each gets a graph of its own
+func BuildCFG(stmts []Statement) *ControlFlowGraph {
+	b := &cfgBuilder{graph: &ControlFlowGraph{}}
+
+	b.graph.Entry = b.newBlock()
+	b.graph.Exit = &BasicBlock{}
+	b.current = b.graph.Entry
+	b.statements(stmts)
+
+	b.graph.end = b.current
+	link(b.graph.end, b.graph.Exit)
+	b.graph.Blocks = append(b.graph.Blocks, b.graph.Exit)
+
+	b.graph.reachable = map[*BasicBlock]bool{}
+	b.graph.markReachable(b.graph.Entry)
+
+	return b.graph
+}
+
+func (b *cfgBuilder) newBlock() *BasicBlock {
+	block := &BasicBlock{}
+	b.graph.Blocks = append(b.graph.Blocks, block)
+	return block
+}
+
+func link(from, to *BasicBlock) {
+	from.Successors = append(from.Successors, to)
+	to.Predecessors = append(to.Predecessors, from)
+}
+
+func (b *cfgBuilder) add(node Node) {
+	b.current.Nodes = append(b.current.Nodes, node)
+}
+
+func (b *cfgBuilder) statements(stmts []Statement) {
+	for _, stmt := range stmts {
+		b.statement(stmt)
+	}
+}
+
+func (b *cfgBuilder) statement(stmt Statement) {
+	switch stmt := stmt.(type) {
+	case *ReturnStatement:
+		b.add(stmt)
+		b.graph.returns++
+		link(b.current, b.graph.Exit)
+
+		// whatever follows can't be reached
+		b.current = b.newBlock()
+
+	case *ExpressionStatement:
+		ifExpr, ok := stmt.Expression.(*IfExpression)
+		if !ok {
+			b.add(stmt)
+			return
+		}
+
+		b.add(ifExpr)
+		branch := b.current
+
+		b.current = b.newBlock()
+		link(branch, b.current)
+		b.statements(ifExpr.Consequence.Statements)
+		consequenceEnd := b.current
+
+		alternativeEnd := branch
+		if ifExpr.Alternative != nil {
+			b.current = b.newBlock()
+			link(branch, b.current)
+			b.statements(ifExpr.Alternative.Statements)
+			alternativeEnd = b.current
+		}
+
+		b.current = b.newBlock()
+		link(consequenceEnd, b.current)
+		link(alternativeEnd, b.current)
+
+	case *WhileStatement:
+		condition := b.newBlock()
+		link(b.current, condition)
+		b.current = condition
+		b.add(stmt)
+
+		value, constant := stmt.Condition.(*Boolean)
+
+		var loop *cfgLoop
+		if constant && value.Value {
+			loop = &cfgLoop{token: stmt.Token, exits: -b.graph.returns}
+			b.graph.loops = append(b.graph.loops, loop)
+		}
+
+		b.current = b.newBlock()
+		if !constant || value.Value {
+			link(condition, b.current)
+		}
+		b.statements(stmt.Body.Statements)
+		link(b.current, condition)
+
+		b.current = b.newBlock()
+		if loop != nil {
+			loop.exits += b.graph.returns
+		} else {
+			link(condition, b.current)
+		}
+
+	case *ForStatement:
+		header := b.newBlock()
+		link(b.current, header)
+		b.current = header
+		b.add(stmt)
+
+		b.current = b.newBlock()
+		link(header, b.current)
+		b.statements(stmt.Body.Statements)
+		link(b.current, header)
+
+		b.current = b.newBlock()
+		link(header, b.current)
+
+	case *WithStatement:
+		// the body always runs, __exit__ doesn't change where control goes
+		b.add(stmt)
+		b.statements(stmt.Body.Statements)
+
+	case *BlockStatement:
+		b.statements(stmt.Statements)
+
+	default:
+		b.add(stmt)
+	}
+}
+
+func (g *ControlFlowGraph) markReachable(block *BasicBlock) {
+	if g.reachable[block] {
+		return
+	}
+	g.reachable[block] = true
+	for _, next := range block.Successors {
+		g.markReachable(next)
+	}
+}
+
+// Reachable reports whether control can get to block from the entry
+func (g *ControlFlowGraph) Reachable(block *BasicBlock) bool {
+	return g.reachable[block]
+}
+
+// FallsOffEnd reports whether control can reach the end of the code without a return
+func (g *ControlFlowGraph) FallsOffEnd() bool {
+	return g.reachable[g.end]
+}
+
+// nodeToken returns the token to report a node of a basic block at
+func nodeToken(node Node) token.Token {
+	if ifExpr, ok := node.(*IfExpression); ok {
+		return ifExpr.Token
+	}
+	if stmt, ok := node.(Statement); ok {
+		return statementToken(stmt)
+	}
+	return token.Token{}
+}
+
+// statementToken returns the token to report a statement at
+func statementToken(stmt Statement) token.Token {
+	switch stmt := stmt.(type) {
+	case *DefStatement:
+		return stmt.Token
+	case *ReturnStatement:
+		return stmt.Token
+	case *ExpressionStatement:
+		return stmt.Token
+	case *BlockStatement:
+		return stmt.Token
+	case *WhileStatement:
+		return stmt.Token
+	case *ForStatement:
+		return stmt.Token
+	case *WithStatement:
+		return stmt.Token
+	case *AssertStatement:
+		return stmt.Token
+	case *UnpackStatement:
+		return stmt.Token
+	case *Class:
+		return stmt.Token
+	case *EnumStatement:
+		return stmt.Token
+	case *RecordStatement:
+		return stmt.Token
+	case *InterfaceStatement:
+		return stmt.Token
+	}
+	return token.Token{}
+}
+
+// flow rules, they are reported by AnalyzeFlow and can be switched off in the Linter
+const (
+	LintUseBeforeAssignment = "use-before-assignment"
+	LintMissingReturn       = "missing-return"
+	LintInfiniteLoop        = "infinite-loop"
+)
+
+// AnalyzeFlow builds the control flow graphs of the top level code and of
+// every function in it, and reports unreachable code, variables that may
+// be read before they are assigned, functions that return a value on some
+// paths only and `while (true)` loops nothing gets out of
+func AnalyzeFlow(stmts []Statement) []Diagnostic {
+	a := &flowAnalyzer{}
+	a.analyze(stmts, nil)
+
+	for len(a.functions) > 0 {
+		fn := a.functions[0]
+		a.functions = a.functions[1:]
+		a.analyze(fn.literal.Body.Statements, &fn)
+	}
+
+	sort.SliceStable(a.diagnostics, func(i, j int) bool {
+		if a.diagnostics[i].Line != a.diagnostics[j].Line {
+			return a.diagnostics[i].Line < a.diagnostics[j].Line
+		}
+		return a.diagnostics[i].Column < a.diagnostics[j].Column
+	})
+
+	return a.diagnostics
+}
+
+type flowFunction struct {
+	name    string // empty for anonymous functions
+	literal *FunctionLiteral
+}
+
+type flowAnalyzer struct {
+	functions   []flowFunction
+	diagnostics []Diagnostic
+
+	// set while the final pass over a graph reports what it finds
+	reporting bool
+	tracked   map[string]bool
+	reported  map[*Identifier]bool
+
+	// set while collecting the names a nested function assigns, see assignments
+	collected map[string]bool
+}
+
+func (a *flowAnalyzer) report(rule string, tok token.Token, format string, args ...interface{}) {
+	d := newDiagnostic(tok, format, args...)
+	d.Rule = rule
+	a.diagnostics = append(a.diagnostics, d)
+}
+
+// assigned is the set of variables that are certainly assigned at a point
+type assigned map[string]bool
+
+func (s assigned) clone() assigned {
+	c := assigned{}
+	for name := range s {
+		c[name] = true
+	}
+	return c
+}
+
+// intersect keeps the names assigned in both s and other, nil stands for
+// a state nothing has flowed into yet
+func (s assigned) intersect(other assigned) assigned {
+	if s == nil {
+		return other.clone()
+	}
+	if other == nil {
+		return s
+	}
+	for name := range s {
+		if !other[name] {
+			delete(s, name)
+		}
+	}
+	return s
+}
+
+func (s assigned) equal(other assigned) bool {
+	if len(s) != len(other) {
+		return false
+	}
+	for name := range s {
+		if !other[name] {
+			return false
+		}
+	}
+	return true
+}
+
+// analyze checks the top level code when fn is nil, the body of fn otherwise
+func (a *flowAnalyzer) analyze(stmts []Statement, fn *flowFunction) {
+	g := BuildCFG(stmts)
+
+	a.reportUnreachable(g)
+
+	// a generator runs as far as its consumer asks
+	generator := fn != nil && fn.literal.IsGenerator
+
+	if fn != nil && !generator && g.returns > 0 && g.FallsOffEnd() {
+		if fn.name == "" {
+			a.report(LintMissingReturn, fn.literal.Token, "function returns a value on some paths but not on others")
+		} else {
+			a.report(LintMissingReturn, fn.literal.Token, "function %s returns a value on some paths but not on others", fn.name)
+		}
+	}
+
+	if !generator {
+		for _, loop := range g.loops {
+			if loop.exits == 0 {
+				a.report(LintInfiniteLoop, loop.token, "while (true) loop never exits")
+			}
+		}
+	}
+
+	var params []*Identifier
+	if fn != nil {
+		params = fn.literal.Parameters
+	}
+	a.checkAssignments(g, params)
+}
+
+// reportUnreachable reports the first node of every region of code that can't be reached
+func (a *flowAnalyzer) reportUnreachable(g *ControlFlowGraph) {
+	// a dead block is inside a region already reported when code that
+	// flows into it was dead as well
+	tainted := map[*BasicBlock]bool{}
+
+	for _, block := range g.Blocks {
+		if g.Reachable(block) {
+			continue
+		}
+
+		inRegion := false
+		for _, pred := range block.Predecessors {
+			if tainted[pred] {
+				inRegion = true
+			}
+		}
+
+		if len(block.Nodes) > 0 && !inRegion {
+			a.report(LintUnreachable, nodeToken(block.Nodes[0]), "unreachable code")
+		}
+		tainted[block] = inRegion || len(block.Nodes) > 0
+	}
+}
+
+// checkAssignments runs a definite assignment analysis over the graph and
+// reports reads of variables that aren't assigned on every path to them.
+// Only names declared in the code itself are tracked, parameters are
+// assigned on entry
+func (a *flowAnalyzer) checkAssignments(g *ControlFlowGraph, params []*Identifier) {
+	a.tracked = map[string]bool{}
+	for _, block := range g.Blocks {
+		for _, node := range block.Nodes {
+			for _, name := range declaredNames(node) {
+				a.tracked[name.Value] = true
+			}
+		}
+	}
+
+	entry := assigned{}
+	for _, param := range params {
+		entry[param.Value] = true
+	}
+
+	out := map[*BasicBlock]assigned{}
+	in := func(block *BasicBlock) assigned {
+		if block == g.Entry {
+			return entry.clone()
+		}
+		var state assigned
+		for _, pred := range block.Predecessors {
+			if g.Reachable(pred) {
+				state = state.intersect(out[pred])
+			}
+		}
+		if state == nil {
+			return assigned{}
+		}
+		return state
+	}
+
+	a.reporting = false
+	for changed := true; changed; {
+		changed = false
+		for _, block := range g.Blocks {
+			if !g.Reachable(block) {
+				continue
+			}
+
+			state := in(block)
+			for _, node := range block.Nodes {
+				a.blockNode(node, state)
+			}
+
+			if previous, ok := out[block]; !ok || !previous.equal(state) {
+				out[block] = state
+				changed = true
+			}
+		}
+	}
+
+	a.reporting = true
+	a.reported = map[*Identifier]bool{}
+	for _, block := range g.Blocks {
+		if !g.Reachable(block) {
+			continue
+		}
+
+		state := in(block)
+		for _, node := range block.Nodes {
+			a.blockNode(node, state)
+		}
+	}
+	a.reporting = false
+}
+
+// declaredNames returns the names a node of a basic block declares
+func declaredNames(node Node) []*Identifier {
+	switch node := node.(type) {
+	case *DefStatement:
+		return []*Identifier{node.Name}
+	case *UnpackStatement:
+		return node.Targets
+	case *Class:
+		return []*Identifier{node.Name}
+	case *EnumStatement:
+		return []*Identifier{node.Name}
+	case *RecordStatement:
+		return []*Identifier{node.Name}
+	case *InterfaceStatement:
+		return []*Identifier{node.Name}
+	}
+	return nil
+}
+
+// blockNode updates state with a node of a basic block, the nodes standing
+// for branching statements only evaluate their condition or iterable there
+func (a *flowAnalyzer) blockNode(node Node, state assigned) {
+	switch node := node.(type) {
+	case *IfExpression:
+		a.expression(node.Condition, state)
+	case *WhileStatement:
+		a.expression(node.Condition, state)
+	case *ForStatement:
+		a.expression(node.Iterable, state)
+		for _, target := range node.Targets {
+			state[target.Value] = true
+		}
+	case *WithStatement:
+		a.expression(node.Manager, state)
+		if node.Name != nil {
+			state[node.Name.Value] = true
+		}
+	case Statement:
+		a.statement(node, state)
+	}
+}
+
+// statement updates state with a statement that is nested inside an
+// expression and so isn't part of the graph itself
+func (a *flowAnalyzer) statement(stmt Statement, state assigned) {
+	switch stmt := stmt.(type) {
+	case *DefStatement:
+		if fn, ok := stmt.Value.(*FunctionLiteral); ok {
+			a.function(stmt.Name.Value, fn, state)
+		} else {
+			a.expression(stmt.Value, state)
+		}
+
+		// `def x;` only declares x
+		if null, ok := stmt.Value.(*Null); !ok || null.Token.Literal != "" {
+			state[stmt.Name.Value] = true
+		}
+
+	case *UnpackStatement:
+		a.expression(stmt.Value, state)
+		for _, target := range stmt.Targets {
+			state[target.Value] = true
+		}
+
+	case *ExpressionStatement:
+		a.expression(stmt.Expression, state)
+
+	case *ReturnStatement:
+		a.expression(stmt.ReturnValue, state)
+
+	case *AssertStatement:
+		a.expression(stmt.Condition, state)
+		a.expression(stmt.Message, state)
+
+	case *BlockStatement:
+		for _, s := range stmt.Statements {
+			a.statement(s, state)
+		}
+
+	case *WhileStatement:
+		a.expression(stmt.Condition, state)
+		a.statement(stmt.Body, state.clone())
+
+	case *ForStatement:
+		a.expression(stmt.Iterable, state)
+		body := state.clone()
+		for _, target := range stmt.Targets {
+			body[target.Value] = true
+		}
+		a.statement(stmt.Body, body)
+
+	case *WithStatement:
+		a.expression(stmt.Manager, state)
+		if stmt.Name != nil {
+			state[stmt.Name.Value] = true
+		}
+		a.statement(stmt.Body, state)
+
+	case *Class:
+		if stmt.Superclass != nil {
+			a.expression(stmt.Superclass, state)
+		}
+		for _, field := range stmt.Fields {
+			a.expression(field.Value, state)
+		}
+		for _, method := range append(append(append([]*DefStatement{}, stmt.Methods...), stmt.Getters...), stmt.Setters...) {
+			if fn, ok := method.Value.(*FunctionLiteral); ok {
+				a.function(stmt.Name.Value+"."+method.Name.Value, fn, state)
+			}
+		}
+		state[stmt.Name.Value] = true
+
+	case *EnumStatement:
+		for _, member := range stmt.Members {
+			a.expression(member.Value, state)
+		}
+		state[stmt.Name.Value] = true
+
+	case *RecordStatement:
+		state[stmt.Name.Value] = true
+
+	case *InterfaceStatement:
+		state[stmt.Name.Value] = true
+	}
+}
+
+// function queues a function literal to be analyzed on its own. When it
+// runs can't be told, so the variables it assigns count as assigned from
+// where it is created on
+func (a *flowAnalyzer) function(name string, fn *FunctionLiteral, state assigned) {
+	if a.collected != nil {
+		for _, stmt := range fn.Body.Statements {
+			a.statement(stmt, assigned{})
+		}
+		return
+	}
+
+	if a.reporting {
+		a.functions = append(a.functions, flowFunction{name: name, literal: fn})
+	}
+
+	for name := range assignments(fn) {
+		state[name] = true
+	}
+}
+
+// assignments returns the names fn assigns, in its body or in functions
+// nested in it, leaving out its parameters
+func assignments(fn *FunctionLiteral) map[string]bool {
+	collector := &flowAnalyzer{collected: map[string]bool{}}
+	collector.function("", fn, nil)
+
+	for _, param := range fn.Parameters {
+		delete(collector.collected, param.Value)
+	}
+	return collector.collected
+}
+
+// expression updates state with an expression, reading a tracked variable
+// that isn't assigned yet is reported
+func (a *flowAnalyzer) expression(expr Expression, state assigned) {
+	switch expr := expr.(type) {
+	case *Identifier:
+		if a.reporting && a.tracked[expr.Value] && !state[expr.Value] && !a.reported[expr] {
+			a.reported[expr] = true
+			a.report(LintUseBeforeAssignment, expr.Token, "%s may be used before it is assigned", expr.Value)
+		}
+
+	case *AssignExpression:
+		a.expression(expr.Value, state)
+		state[expr.Name.Value] = true
+		if a.collected != nil {
+			a.collected[expr.Name.Value] = true
+		}
+
+	case *FunctionLiteral:
+		a.function("", expr, state)
+
+	case *IfExpression:
+		// an if inside an expression, each branch only counts where both agree
+		a.expression(expr.Condition, state)
+
+		consequence := state.clone()
+		a.statement(expr.Consequence, consequence)
+
+		alternative := state.clone()
+		if expr.Alternative != nil {
+			a.statement(expr.Alternative, alternative)
+		}
+
+		for name := range consequence {
+			if alternative[name] {
+				state[name] = true
+			}
+		}
+
+	case *PrefixExpression:
+		a.expression(expr.Right, state)
+	case *InfixExpression:
+		a.expression(expr.Left, state)
+		a.expression(expr.Right, state)
+	case *PipeExpression:
+		a.expression(expr.Left, state)
+		a.expression(expr.Right, state)
+	case *YieldExpression:
+		a.expression(expr.Value, state)
+	case *CallExpression:
+		a.expression(expr.Function, state)
+		for _, arg := range expr.Arguments {
+			a.expression(arg, state)
+		}
+	case *IndexExpression:
+		a.expression(expr.Left, state)
+		a.expression(expr.Index, state)
+	case *GetExpression:
+		a.expression(expr.Object, state)
+	case *SetExpression:
+		a.expression(expr.Value, state)
+		a.expression(expr.Object, state)
+
+	case *ListLiteral:
+		for _, element := range expr.Elements {
+			a.expression(element, state)
+		}
+	case *TupleLiteral:
+		for _, element := range expr.Elements {
+			a.expression(element, state)
+		}
+	case *SetLiteral:
+		for _, element := range expr.Elements {
+			a.expression(element, state)
+		}
+	case *MapLiteral:
+		for key, value := range expr.Pairs {
+			a.expression(key, state)
+			a.expression(value, state)
+		}
+
+	case *ListComprehension:
+		a.expression(expr.Iterable, state)
+		inner := state.clone()
+		for _, target := range expr.Targets {
+			inner[target.Value] = true
+		}
+		a.expression(expr.Condition, inner)
+		a.expression(expr.Element, inner)
+
+	case *MapComprehension:
+		a.expression(expr.Iterable, state)
+		inner := state.clone()
+		for _, target := range expr.Targets {
+			inner[target.Value] = true
+		}
+		a.expression(expr.Condition, inner)
+		a.expression(expr.Key, inner)
+		a.expression(expr.Value, inner)
+	}
+}
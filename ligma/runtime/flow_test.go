@@ -0,0 +1,110 @@
+package runtime_test
+
+import (
+	"reflect"
+	"testing"
+
+	"ligma/lexer"
+	"ligma/parser"
+	"ligma/runtime"
+)
+
+func TestAnalyzeFlow(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []string
+	}{
+		{"clean code", `
+def sign = func(n) {
+    if (n > 0) { return 1 } else { return -1 }
+}
+def wait = func() {
+    while (true) { return 1 }
+}
+def count = func() {
+    def n = 0
+    while (true) { yield n n = n + 1 }
+}
+`, []string{}},
+		{"missing returns and endless loops", `
+def half = func(n) {
+    if (n > 0) { return n / 2 }
+}
+def spin = func() {
+    while (true) { print("x") }
+}
+`, []string{
+			"2:12: function half returns a value on some paths but not on others [missing-return]",
+			"6:5: while (true) loop never exits [infinite-loop]",
+		}},
+		{"unreachable code", `
+def f = func() {
+    return 1
+    print("dead")
+    print("still dead")
+}
+`, []string{
+			"4:5: unreachable code [unreachable]",
+		}},
+		{"use before assignment", `
+def pick = func(c) {
+    def x;
+    if (c) { x = 1 }
+    print(x)
+    def y;
+    if (c) { y = 1 } else { y = 2 }
+    print(y)
+    print(z)
+    def z = 3
+    def w;
+    while (c) { w = c }
+    return w
+}
+`, []string{
+			"5:11: x may be used before it is assigned [use-before-assignment]",
+			"9:11: z may be used before it is assigned [use-before-assignment]",
+			"13:12: w may be used before it is assigned [use-before-assignment]",
+		}},
+		{"bare declarations assigned later", `
+def v;
+v = 5
+print(v)
+def total;
+def reset = func() { total = 0 }
+reset()
+print(total)
+def f = func() {
+    def n;
+    def set = func(value) { n = value }
+    set(1)
+    return n
+}
+def g = func(c) {
+    def m;
+    print(m)
+    def later = func() { m = c }
+    return m
+}
+`, []string{
+			"17:11: m may be used before it is assigned [use-before-assignment]",
+		}},
+	}
+
+	for _, tt := range tests {
+		p := parser.New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			t.Fatalf("%s: parser errors: %v", tt.name, p.Errors())
+		}
+
+		diagnostics := []string{}
+		for _, d := range runtime.AnalyzeFlow(program.Statements) {
+			diagnostics = append(diagnostics, d.String())
+		}
+
+		if !reflect.DeepEqual(diagnostics, tt.expected) {
+			t.Errorf("%s: wrong diagnostics.\nexpected: %q\ngot:      %q", tt.name, tt.expected, diagnostics)
+		}
+	}
+}
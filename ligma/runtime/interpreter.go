@@ -2,6 +2,7 @@ package runtime
 
 import (
 	"fmt"
+	"strings"
 )
 
 var (
@@ -21,8 +22,29 @@ type TreeWalker interface {
 
 type Interpreter struct {
 	globals *Environment 
-	locals map[Expression]int
+	locals map[Expression]local
 	Env *Environment
+
+	// CheckTypes makes ApplyFunction check arguments and return values
+	// against the annotations of the function being called
+	CheckTypes bool
+
+	// SkipAssertions turns assert statements into no-ops
+	SkipAssertions bool
+
+	// generator is the generator whose body this interpreter runs, if any
+	generator *generatorBody
+
+	// abandoned holds the generators dropped while suspended, the
+	// interpreters running generator bodies share it
+	abandoned *abandonedGenerators
+
+	// interned holds the str instances of the literals seen so far, see Intern
+	interned map[string]*LigmaInstance
+
+	// Compile, if set, gives every function the interpreter creates from a
+	// literal a compiled body to run instead of its AST
+	Compile func(*FunctionLiteral) Code
 }
 
 func NewInterpreter() *Interpreter {
@@ -42,11 +64,65 @@ func NewInterpreter() *Interpreter {
 
 	env := globals
 
-	return &Interpreter{globals: globals, locals: make(map[Expression]int), Env: env}
+	return &Interpreter{globals: globals, locals: make(map[Expression]local), Env: env, abandoned: &abandonedGenerators{}, interned: map[string]*LigmaInstance{}}
+}
+
+// local is where the Resolver found a variable: how many scopes up from
+// where it is used, and its slot in that scope
+type local struct {
+	depth int
+	slot int
+}
+
+// Resolve records that expr refers to the local in slot, depth scopes up.
+// Declarations are recorded with depth 0
+func (i *Interpreter) Resolve(expr Expression, depth int, slot int) {
+	i.locals[expr] = local{depth: depth, slot: slot}
+}
+
+// define binds a declared name, locals go to the slot the Resolver gave
+// them and everything else to the current environment by name
+func (i *Interpreter) define(name *Identifier, val LigmaObject, constant bool) LigmaObject {
+	if local, ok := i.locals[name]; ok {
+		if constant {
+			i.Env.DefineConstant(local.slot, name.Value, val)
+		} else {
+			i.Env.Define(local.slot, val)
+		}
+		return val
+	}
+
+	if constant {
+		return i.Env.SetConstant(name.Value, val)
+	}
+	return i.Env.Set(name.Value, val)
+}
+
+// Local reports where the Resolver found the variable expr refers to, ok is
+// false for globals
+func (i *Interpreter) Local(expr Expression) (depth int, slot int, ok bool) {
+	local, ok := i.locals[expr]
+	return local.depth, local.slot, ok
+}
+
+// Globals returns the environment of the top level
+func (i *Interpreter) Globals() *Environment {
+	return i.globals
+}
+
+// IsBuiltin reports whether name is a built-in function, those can't be rebound
+func IsBuiltin(name string) bool {
+	_, ok := builtins[name]
+	return ok
 }
 
-func (i *Interpreter) Resolve(expr Expression, depth int) {
-	i.locals[expr] = depth
+// newFunction creates the function a literal evaluates to in the current environment
+func (i *Interpreter) newFunction(fl *FunctionLiteral) *LigmaFunction {
+	fn := &LigmaFunction{Parameters: fl.Parameters, ReturnType: fl.ReturnType, Body: fl.Body, Env: i.Env, IsGenerator: fl.IsGenerator}
+	if i.Compile != nil {
+		fn.Code = i.Compile(fl)
+	}
+	return fn
 }
 
 func (i *Interpreter) ExecuteStatement(statement Statement) LigmaObject {
@@ -63,8 +139,12 @@ func (i *Interpreter) Interpret(p *Program) LigmaObject {
 
 	for _, statement := range p.Statements {
 		result = i.ExecuteStatement(statement)
+		if IsFatal(result) {
+			break
+		}
 	}
 
+	i.closeAbandoned()
 	return result
 }
 
@@ -92,9 +172,9 @@ func (i *Interpreter) ExecuteBlock(block *BlockStatement, env *Environment) Ligm
 }
 
 func (i *Interpreter) LookupVariable(name string, expr Expression) LigmaObject {
-	distance, ok := i.locals[expr]
+	local, ok := i.locals[expr]
 	if ok {
-		ret, _ := i.Env.GetAt(distance, name)
+		ret, _ := i.Env.GetAt(local.depth, local.slot)
 		return ret
 	}
 	ret , ok := i.globals.Get(name)
@@ -116,12 +196,48 @@ func (i *Interpreter) VisitDefStatement(def *DefStatement) LigmaObject{
 		return NewError("Built-in function %s cannot be redefined", def.Name.Value)
 	}
 
+	result := i.define(def.Name, val, def.Constant)
+	if isError(result) {
+		return result
+	}
+	return nil
+}
+
+// VisitUnpackStatement binds the elements of a tuple or list to the targets
+func (i *Interpreter) VisitUnpackStatement(us *UnpackStatement) LigmaObject {
+	val := us.Value.Accept(i)
+	if isError(val) {
+		return val
+	}
+
+	values := unpackValues(val)
+	if len(values) != len(us.Targets) {
+		return NewError("cannot unpack %s into %d values", val.Type(), len(us.Targets))
+	}
+
+	for idx, target := range us.Targets {
+		if _, ok := builtins[target.Value]; ok {
+			return NewError("Built-in function %s cannot be redefined", target.Value)
+		}
 
-	i.Env.Set(def.Name.Value, val)
+		result := i.define(target, values[idx], us.Constant)
+		if isError(result) {
+			return result
+		}
+	}
 	return nil
 }
 
 func (i *Interpreter) VisitReturnStatement(rs *ReturnStatement) LigmaObject {
+	// the function returning makes a call in tail position, see TailCall
+	if rs.Tail {
+		function, args, err := i.evalCall(rs.ReturnValue.(*CallExpression))
+		if err != nil {
+			return err
+		}
+		return &ReturnValue{Value: &TailCall{Function: function, Args: args}}
+	}
+
 	val := rs.ReturnValue.Accept(i)
 	if isError(val) {
 		return val
@@ -148,7 +264,7 @@ func (i *Interpreter) VisitBlockStatement(block *BlockStatement) LigmaObject {
 
 func (i *Interpreter) VisitClassStatement(class *Class) LigmaObject {
 
-	i.Env.Set(class.Name.Value, nil)
+	i.define(class.Name, nil, false)
 
 
 	classObj := &LigmaClass{Name: class.Name.Value}
@@ -174,21 +290,11 @@ func (i *Interpreter) VisitClassStatement(class *Class) LigmaObject {
 		
 	}
 
-	/* if class.Superclass != nil {
-		i.Env = NewEnclosedEnvironment(i.Env)
-		i.Env.Set("super", classObj.Superclass)
-	} */
-
-	if class.Superclass == nil {
-		// set super to Object
-		i.Env = NewEnclosedEnvironment(i.Env)
-		i.Env.Set("super", objectClass)
-	} else {
-		// inherit from Object then from the superclass
-		i.Env = NewEnclosedEnvironment(i.Env)
-		i.Env.Set("super", objectClass)
+	// the methods of a subclass see super in a scope of its own, the only
+	// local there, like the Resolver has it
+	if class.Superclass != nil {
 		i.Env = NewEnclosedEnvironment(i.Env)
-		i.Env.Set("super", classObj.Superclasses[1])
+		i.Env.Define(0, classObj.Superclasses[1])
 	}
 
 	
@@ -197,41 +303,216 @@ func (i *Interpreter) VisitClassStatement(class *Class) LigmaObject {
 
 	for _, method := range class.Methods {
 		method_func := method.Value.(*FunctionLiteral)
-		methods[method.Name.Value] = &LigmaFunction{Parameters: method_func.Parameters, Body: method_func.Body, Env: i.Env}
+		methods[method.Name.Value] = i.newFunction(method_func)
+	}
+
+	for _, getter := range class.Getters {
+		getter_func := getter.Value.(*FunctionLiteral)
+		methods[accessorName("get", getter.Name.Value)] = i.newFunction(getter_func)
+	}
+
+	for _, setter := range class.Setters {
+		setter_func := setter.Value.(*FunctionLiteral)
+		methods[accessorName("set", setter.Name.Value)] = i.newFunction(setter_func)
 	}
 
 	classObj.Methods = ClassMethods{UserDefinedMethods: methods}
 
-	/* if class.Superclass != nil {
-		i.Env = i.Env.parent
-	} */
+	// field declarations are evaluated for every new instance, in this scope
+	classObj.Fields = class.Fields
+	classObj.fieldEnv = i.Env
 
 	if class.Superclass != nil {
 		i.Env = i.Env.parent
-		i.Env = i.Env.parent
-	} else {
-		i.Env = i.Env.parent
 	}
+
+	for _, name := range class.Interfaces {
+		iface := name.Accept(i)
+		if isError(iface) {
+			return iface
+		}
+
+		ifaceClass, ok := iface.(*LigmaClass)
+		if !ok || !ifaceClass.Interface {
+			return NewError("%s is not an interface", name.Value)
+		}
+		classObj.Interfaces = append(classObj.Interfaces, ifaceClass)
+	}
+
+	// a class that declares no abstract methods of its own is meant to be
+	// instantiated, everything it inherits as abstract has to be implemented
+	missing := classObj.missingMethods()
+	if len(missing) > 0 && len(class.Abstract) == 0 {
+		return NewError("class %s does not implement %s", class.Name.Value, strings.Join(missing, ", "))
+	}
+
+	for _, name := range class.Abstract {
+		classObj.Abstract = append(classObj.Abstract, name.Value)
+	}
+	classObj.Abstract = append(classObj.Abstract, missing...)
 	
-	i.Env.Set(class.Name.Value, classObj)
+	i.define(class.Name, classObj, false)
+
+	return nil
+}
+
+// VisitRecordStatement builds a class whose constructor takes the fields
+// in order, the rest of its behaviour comes from the record base class
+func (i *Interpreter) VisitRecordStatement(rs *RecordStatement) LigmaObject {
+	names := []string{}
+	for _, field := range rs.Fields {
+		for _, name := range names {
+			if name == field.Value {
+				return NewError("duplicate field %s in record %s", field.Value, rs.Name.Value)
+			}
+		}
+		names = append(names, field.Value)
+	}
+
+	init := &BuiltinClassMethod{
+		Literal: "init",
+		Fn: func(args ...LigmaObject) LigmaObject {
+			self := args[len(args)-1].(*LigmaInstance)
+			for idx, name := range names {
+				self.Fields[name] = args[idx]
+			}
+			return nil
+		},
+		NumArgs: len(names),
+	}
+
+	record := &LigmaClass{
+		Name: rs.Name.Value,
+		Superclasses: []*LigmaClass{builtinsClasses["record"]},
+		Methods: ClassMethods{
+			BuiltinMethods: map[string]*BuiltinClassMethod{"init": init},
+			UserDefinedMethods: map[string]*LigmaFunction{},
+		},
+		Record: names,
+	}
+
+	i.define(rs.Name, record, false)
+	return nil
+}
+
+// VisitInterfaceStatement builds a class that only lists abstract methods
+func (i *Interpreter) VisitInterfaceStatement(is *InterfaceStatement) LigmaObject {
+	iface := &LigmaClass{
+		Name: is.Name.Value,
+		Superclasses: []*LigmaClass{builtinsClasses["object"]},
+		Interface: true,
+	}
+
+	for _, method := range is.Methods {
+		iface.Abstract = append(iface.Abstract, method.Value)
+	}
+
+	i.define(is.Name, iface, false)
+	return nil
+}
+
+// implementsInterface reports whether obj, an instance or a class, declares
+// iface or provides every method it lists
+func implementsInterface(obj, iface LigmaObject) LigmaObject {
+	target, ok := iface.(*LigmaClass)
+	if !ok {
+		return NewError("right side of implements must be an interface, got %s", iface.Type())
+	}
+
+	var class *LigmaClass
+	switch obj := obj.(type) {
+	case *LigmaInstance:
+		class = obj.Class
+	case *LigmaClass:
+		class = obj
+	default:
+		return FALSE
+	}
+
+	if class.IsSubclassOf(target.Name) {
+		return TRUE
+	}
+
+	if !target.Interface {
+		return FALSE
+	}
+
+	for _, name := range target.Abstract {
+		if class.GetMethod(name) == nil {
+			return FALSE
+		}
+	}
+	return TRUE
+}
+
+// VisitEnumStatement builds a class whose members are created once, here.
+// Members without a value continue counting from the previous int member
+func (i *Interpreter) VisitEnumStatement(es *EnumStatement) LigmaObject {
+	enumClass := &LigmaClass{
+		Name: es.Name.Value,
+		Superclasses: []*LigmaClass{builtinsClasses["enum"]},
+		Members: []*LigmaInstance{},
+	}
+
+	var next int64 = 0
+	counting := true
+
+	for _, member := range es.Members {
+		if _, ok := enumClass.Member(member.Name.Value); ok {
+			return NewError("duplicate member %s in enum %s", member.Name.Value, es.Name.Value)
+		}
+
+		var value LigmaObject
+		if member.Value != nil {
+			value = i.EvaluateExpression(member.Value)
+			if isError(value) {
+				return value
+			}
+		} else {
+			if !counting {
+				return NewError("enum member %s.%s needs an explicit value", es.Name.Value, member.Name.Value)
+			}
+			value = NewInteger(next)
+		}
+
+		counting = false
+		if instance, ok := value.(*LigmaInstance); ok {
+			if number, ok := instance.Fields["value"].(*LigmaInteger); ok {
+				next = number.Value + 1
+				counting = true
+			}
+		}
+
+		enumClass.Members = append(enumClass.Members, &LigmaInstance{
+			Class: enumClass,
+			Fields: map[string]LigmaObject{
+				"name": NewString(member.Name.Value),
+				"value": value,
+			},
+			interpreter: i,
+		})
+	}
+
+	i.define(es.Name, enumClass, false)
 
 	return nil
 }
 
 func (i *Interpreter) VisitSuper(s *Super) LigmaObject {
-	distance, ok := i.locals[s]
+	local, ok := i.locals[s]
 	if !ok {
 		return NewError("super must be used inside a method")
 	}
 
-	superclass, ok := i.Env.GetAt(distance, "super")
+	superclass, ok := i.Env.GetAt(local.depth, local.slot)
 	if !ok {
 		return NewError("super must be used inside a method")
 	}
 
 	supercls := superclass.(*LigmaClass)
 
-	thisInstance, ok := i.Env.GetAt(distance - 1, "self")
+	// self is the only local of the scope right inside
+	thisInstance, ok := i.Env.GetAt(local.depth - 1, 0)
 	if !ok {
 		return NewError("super must be used inside a method")
 	}
@@ -259,9 +540,9 @@ func (i *Interpreter) VisitWhileStatement(ws *WhileStatement) LigmaObject {
 		return condition
 	}
 
-	for isTruthy(condition) {
+	for IsTruthy(condition) {
 		result := i.ExecuteStatement(ws.Body)
-		if isError(result) {
+		if result != nil && (result.Type() == RETURN_VALUE_OBJ || result.Type() == ERROR_OBJ) {
 			return result
 		}
 		condition = i.EvaluateExpression(ws.Condition)
@@ -269,25 +550,191 @@ func (i *Interpreter) VisitWhileStatement(ws *WhileStatement) LigmaObject {
 	return nil
 }
 
+// VisitForStatement runs the body once per element, the targets live in the
+// same environment as the body
+func (i *Interpreter) VisitForStatement(fs *ForStatement) LigmaObject {
+	iterable := i.EvaluateExpression(fs.Iterable)
+	if isError(iterable) {
+		return iterable
+	}
+
+	return i.iterate(iterable, len(fs.Targets), func(values []LigmaObject) LigmaObject {
+		// the targets are the first locals of the scope
+		env := NewEnclosedEnvironment(i.Env)
+		for idx := range fs.Targets {
+			env.Define(idx, values[idx])
+		}
+		return i.ExecuteBlock(fs.Body, env)
+	})
+}
+
+// VisitAssertStatement fails with the asserted source and its position,
+// the failure ends the program. Comparisons have their operands evaluated
+// once and shown in the failure
+func (i *Interpreter) VisitAssertStatement(as *AssertStatement) LigmaObject {
+	if i.SkipAssertions {
+		return nil
+	}
+
+	var result LigmaObject
+	operands := ""
+
+	comparison, ok := as.Condition.(*InfixExpression)
+	if ok && isComparison(comparison.Operator) {
+		left := i.EvaluateExpression(comparison.Left)
+		if isError(left) {
+			return left
+		}
+		right := i.EvaluateExpression(comparison.Right)
+		if isError(right) {
+			return right
+		}
+
+		result = EvalInfixExpression(comparison.Operator, left, right)
+		operands = fmt.Sprintf(" with left = %s, right = %s", reprOf(left), reprOf(right))
+	} else {
+		result = i.EvaluateExpression(as.Condition)
+	}
+
+	if isError(result) {
+		return result
+	}
+	if IsTruthy(result) {
+		return nil
+	}
+
+	message := ""
+	if as.Message != nil {
+		msg := i.EvaluateExpression(as.Message)
+		if isError(msg) {
+			return msg
+		}
+		message = ": " + reprOf(msg)
+	}
+
+	err := NewError("assertion failed at line %d, column %d: assert %s%s%s", as.Token.Line, as.Token.Column, as.Condition.String(), operands, message)
+	err.Fatal = true
+	return err
+}
+
+func isComparison(operator string) bool {
+	switch operator {
+	case "==", "!=", "<", ">", "<=", ">=", "in", "not in":
+		return true
+	}
+	return false
+}
+
+func (i *Interpreter) VisitWithStatement(ws *WithStatement) LigmaObject {
+	manager := i.EvaluateExpression(ws.Manager)
+	if isError(manager) {
+		return manager
+	}
+
+	instance, ok := manager.(*LigmaInstance)
+	if !ok {
+		return NewError("object of type %s is not a context manager", manager.Type())
+	}
+
+	enter, ok := instance.Get("__enter__")
+	if !ok {
+		return NewError("object of type %s does not implement __enter__", manager.Type())
+	}
+
+	exit, ok := instance.Get("__exit__")
+	if !ok {
+		return NewError("object of type %s does not implement __exit__", manager.Type())
+	}
+
+	value := ApplyFunction(i, enter, []LigmaObject{})
+	if isError(value) {
+		return value
+	}
+
+	env := NewEnclosedEnvironment(i.Env)
+	if ws.Name != nil {
+		env.Define(0, value)
+	}
+
+	// a generator closed while it is suspended in the body unwinds through
+	// here, __exit__ runs and the unwinding goes on. A failing __exit__
+	// becomes the error of the close. Other panics are not the business of
+	// the with statement
+	previousEnv := i.Env
+	defer func() {
+		if r := recover(); r != nil {
+			closing, ok := r.(generatorExit)
+			if !ok {
+				panic(r)
+			}
+
+			i.Env = previousEnv
+			exitResult, _ := i.exitContext(exit, nil)
+			if isError(exitResult) && closing.err == nil {
+				closing.err = exitResult
+			}
+			panic(closing)
+		}
+	}()
+
+	result := i.ExecuteBlock(ws.Body, env)
+
+	var err *Error
+	if isError(result) {
+		err = result.(*Error)
+	}
+
+	exitResult, suppressed := i.exitContext(exit, err)
+	if isError(exitResult) {
+		return exitResult
+	}
+
+	if err != nil && suppressed {
+		return nil
+	}
+
+	return result
+}
+
+// exitContext calls the __exit__ hook of a context manager with the error
+// leaving the with block (null if there is none) and reports whether the
+// hook asked for the error to be suppressed
+func (i *Interpreter) exitContext(exit LigmaObject, err *Error) (LigmaObject, bool) {
+	var arg LigmaObject = NULL
+	if err != nil {
+		arg = NewString(err.Message)
+	}
+
+	result := ApplyFunction(i, exit, []LigmaObject{arg})
+	if isError(result) {
+		return result, false
+	}
+
+	return result, result != nil && IsTruthy(result)
+}
+
 func (i *Interpreter) VisitExpressionStatement(es *ExpressionStatement) LigmaObject {
 	return es.Expression.Accept(i)
 }
 
 // literals 
+// literals that went through the resolver have their instance ready
 func (i *Interpreter) VisitIntegerLiteral(il *IntegerLiteral) LigmaObject {
-	//return &LigmaInteger{Value: il.Value}
-	int_class, _ := i.Env.Get("int")
-	return ApplyFunction(i, int_class.(*LigmaClass), []LigmaObject{&LigmaInteger{Value: il.Value}})
+	if il.instance != nil {
+		return il.instance
+	}
+	return NewInteger(il.Value)
 }
 
 func (i *Interpreter) VisitFloatLiteral(fl *FloatLiteral) LigmaObject {
-	//return &LigmaFloat{Value: fl.Value}
-	float_class, _ := i.Env.Get("float")
-	return ApplyFunction(i, float_class.(*LigmaClass), []LigmaObject{&LigmaFloat{Value: fl.Value}})
+	if fl.instance != nil {
+		return fl.instance
+	}
+	return NewFloat(fl.Value)
 }
 
 func (i *Interpreter) VisitBoolean(b *Boolean) LigmaObject {
-	return &LigmaBoolean{Value: b.Value}
+	return nativeBoolToBooleanObject(b.Value)
 }
 
 func (i *Interpreter) VisitNull(n *Null) LigmaObject {
@@ -299,7 +746,11 @@ func (i *Interpreter) VisitListLiteral(ll *ListLiteral) LigmaObject {
 
 	for _, element := range ll.Elements {
 		//elements = append(elements, element.Accept(i))
-		elements.Elements = append(elements.Elements, element.Accept(i))
+		value := element.Accept(i)
+		if isError(value) {
+			return value
+		}
+		elements.Elements = append(elements.Elements, value)
 	}
 
 	//return &LigmaList{Elements: elements}
@@ -307,8 +758,43 @@ func (i *Interpreter) VisitListLiteral(ll *ListLiteral) LigmaObject {
 	return ApplyFunction(i, list_class.(*LigmaClass), []LigmaObject{&elements})
 }
 
+func (i *Interpreter) VisitTupleLiteral(tl *TupleLiteral) LigmaObject {
+	elements := []LigmaObject{}
+
+	for _, element := range tl.Elements {
+		value := element.Accept(i)
+		if isError(value) {
+			return value
+		}
+		elements = append(elements, value)
+	}
+
+	tuple_class, _ := i.Env.Get("tuple")
+	return ApplyFunction(i, tuple_class.(*LigmaClass), []LigmaObject{&LigmaTuple{Elements: elements}})
+}
+
+func (i *Interpreter) VisitSetLiteral(sl *SetLiteral) LigmaObject {
+	elements := []LigmaObject{}
+
+	for _, element := range sl.Elements {
+		value := element.Accept(i)
+		if isError(value) {
+			return value
+		}
+		elements = append(elements, value)
+	}
+
+	set, err := makeSet(elements)
+	if err != nil {
+		return err
+	}
+
+	set_class, _ := i.Env.Get("set")
+	return ApplyFunction(i, set_class.(*LigmaClass), []LigmaObject{set})
+}
+
 func (i *Interpreter) VisitMapLiteral(ml *MapLiteral) LigmaObject {
-	pairs := make(map[MapKey]MapPair)
+	pairs := NewMap()
 
 	for key, value := range ml.Pairs {
 		key := key.Accept(i)
@@ -316,35 +802,127 @@ func (i *Interpreter) VisitMapLiteral(ml *MapLiteral) LigmaObject {
 			return key
 		}
 
-		hashKey, ok := key.(LigmaHashable)
-		if !ok {
-			return NewError("unusable as map key: %s", key.Type())
-		}
-
 		value := value.Accept(i)
 		if isError(value) {
 			return value
 		}
 
-		hashed := hashKey.MapKey()
+		if err := pairs.Set(key, value); err != nil {
+			return err
+		}
+
+	}
+
+	map_class, _ := i.Env.Get("map")
+	return ApplyFunction(i, map_class.(*LigmaClass), []LigmaObject{pairs})
+}
+
+func (i *Interpreter) VisitListComprehension(lc *ListComprehension) LigmaObject {
+	iterable := i.EvaluateExpression(lc.Iterable)
+	if isError(iterable) {
+		return iterable
+	}
+
+	elements := []LigmaObject{}
+
+	previousEnv := i.Env
+	err := i.iterate(iterable, len(lc.Targets), func(values []LigmaObject) LigmaObject {
+		i.Env = comprehensionEnvironment(previousEnv, lc.Targets, values)
+
+		if lc.Condition != nil {
+			condition := i.EvaluateExpression(lc.Condition)
+			if isError(condition) {
+				return condition
+			}
+			if !IsTruthy(condition) {
+				return nil
+			}
+		}
+
+		element := i.EvaluateExpression(lc.Element)
+		if isError(element) {
+			return element
+		}
+
+		elements = append(elements, element)
+		return nil
+	})
+	i.Env = previousEnv
+
+	if err != nil {
+		return err
+	}
 
-		pairs[hashed] = MapPair{Key: key, Value: value}
+	list_class, _ := i.Env.Get("list")
+	return ApplyFunction(i, list_class.(*LigmaClass), []LigmaObject{&LigmaList{Elements: elements}})
+}
 
+func (i *Interpreter) VisitMapComprehension(mc *MapComprehension) LigmaObject {
+	iterable := i.EvaluateExpression(mc.Iterable)
+	if isError(iterable) {
+		return iterable
+	}
+
+	pairs := NewMap()
+
+	previousEnv := i.Env
+	err := i.iterate(iterable, len(mc.Targets), func(values []LigmaObject) LigmaObject {
+		i.Env = comprehensionEnvironment(previousEnv, mc.Targets, values)
+
+		if mc.Condition != nil {
+			condition := i.EvaluateExpression(mc.Condition)
+			if isError(condition) {
+				return condition
+			}
+			if !IsTruthy(condition) {
+				return nil
+			}
+		}
+
+		key := i.EvaluateExpression(mc.Key)
+		if isError(key) {
+			return key
+		}
+
+		value := i.EvaluateExpression(mc.Value)
+		if isError(value) {
+			return value
+		}
+
+		if err := pairs.Set(key, value); err != nil {
+			return err
+		}
+		return nil
+	})
+	i.Env = previousEnv
+
+	if err != nil {
+		return err
 	}
 
 	map_class, _ := i.Env.Get("map")
-	return ApplyFunction(i, map_class.(*LigmaClass), []LigmaObject{&LigmaMap{Pairs: pairs}})
+	return ApplyFunction(i, map_class.(*LigmaClass), []LigmaObject{pairs})
 }
 
-func (i *Interpreter) VisitStringLiteral(sl *StringLiteral) LigmaObject {
-	//return &LigmaString{Value: sl.Value}
-	string_class, _ := i.Env.Get("str")
-	return ApplyFunction(i, string_class.(*LigmaClass), []LigmaObject{&LigmaString{Value: sl.Value}})
+// comprehensionEnvironment gives every iteration of a comprehension its own
+// scope so closures capture the loop variables of that iteration
+func comprehensionEnvironment(parent *Environment, targets []*Identifier, values []LigmaObject) *Environment {
+	env := NewEnclosedEnvironment(parent)
+	for idx := range targets {
+		env.Define(idx, values[idx])
+	}
+	return env
+}
 
+func (i *Interpreter) VisitStringLiteral(sl *StringLiteral) LigmaObject {
+	if sl.instance != nil {
+		return sl.instance
+	}
+	return NewString(sl.Value)
 }
 
 func (i *Interpreter) VisitFunctionLiteral(fl *FunctionLiteral) LigmaObject {
-	return &LigmaFunction{Parameters: fl.Parameters, Body: fl.Body, Env: i.Env}
+	return i.newFunction(fl)
 }
 
 func (i *Interpreter) VisitPrefixExpression(pe *PrefixExpression) LigmaObject {
@@ -352,8 +930,11 @@ func (i *Interpreter) VisitPrefixExpression(pe *PrefixExpression) LigmaObject {
 	if isError(right) {
 		return right
 	}
-	operator := pe.Operator
 
+	return EvalPrefixExpression(pe.Operator, right)
+}
+
+func EvalPrefixExpression(operator string, right LigmaObject) LigmaObject {
 	switch operator {
 	case "!":
 		return evalBangOperatorExpression(right)
@@ -374,8 +955,10 @@ func (i *Interpreter) VisitInfixExpression(ie *InfixExpression) LigmaObject {
 		return right
 	}
 
-	operator := ie.Operator
+	return EvalInfixExpression(ie.Operator, left, right)
+}
 
+func EvalInfixExpression(operator string, left, right LigmaObject) LigmaObject {
 	switch {
 		/* case left.Type() == ObjectType("int") && right.Type() == ObjectType("int"):
 			return evalIntegerInfixExpression(i, operator, left, right)
@@ -386,6 +969,21 @@ func (i *Interpreter) VisitInfixExpression(ie *InfixExpression) LigmaObject {
 		case left.Type() == FLOAT_OBJ && right.Type() == INTEGER_OBJ:
 				return evalMixedInfixExpression(operator, left, right) */
 		
+		case operator == "implements":
+			return implementsInterface(left, right)
+		case operator == "in" || operator == "not in":
+			container, ok := right.(*LigmaInstance)
+			if !ok {
+				return NewError("argument of type %s is not a container", right.Type())
+			}
+			result := container.Contains(left)
+			if operator == "not in" {
+				return negateComparison(result)
+			}
+			if isError(result) {
+				return result
+			}
+			return nativeBoolToBooleanObject(IsTruthy(result))
 		case operator == "+":
 			return left.(*LigmaInstance).Add(right.(*LigmaInstance))
 		case operator == "-":
@@ -396,21 +994,96 @@ func (i *Interpreter) VisitInfixExpression(ie *InfixExpression) LigmaObject {
 			return left.(*LigmaInstance).Div(right.(*LigmaInstance))
 		case operator == "%":
 			return left.(*LigmaInstance).Mod(right.(*LigmaInstance))
+		case operator == "|":
+			return left.(*LigmaInstance).Or(right.(*LigmaInstance))
+		case operator == "&":
+			return left.(*LigmaInstance).And(right.(*LigmaInstance))
 		case operator == "<":
 			return left.(*LigmaInstance).Lt(right.(*LigmaInstance))
+		case operator == ">":
+			return right.(*LigmaInstance).Lt(left.(*LigmaInstance))
+		case operator == "<=":
+			return negateComparison(right.(*LigmaInstance).Lt(left.(*LigmaInstance)))
+		case operator == ">=":
+			return negateComparison(left.(*LigmaInstance).Lt(right.(*LigmaInstance)))
 		
 		case operator == "==":
 			return left.(*LigmaInstance).Eq(right.(*LigmaInstance))
 		case operator == "!=":
 			return left.(*LigmaInstance).Ne(right.(*LigmaInstance))
 		case operator == "and":
-			return nativeBoolToBooleanObject(isTruthy(left) && isTruthy(right))
+			return nativeBoolToBooleanObject(IsTruthy(left) && IsTruthy(right))
 		case operator == "or":
-			return nativeBoolToBooleanObject(isTruthy(left) || isTruthy(right))
+			return nativeBoolToBooleanObject(IsTruthy(left) || IsTruthy(right))
 		
 	}
 
-	return NewError("unknown operator: %s %s %s", left.Type(), ie.Operator, right.Type())
+	return NewError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+}
+
+// VisitYieldExpression hands a value to whoever resumed the generator and
+// evaluates to the value it is resumed with
+func (i *Interpreter) VisitYieldExpression(ye *YieldExpression) LigmaObject {
+	if i.generator == nil {
+		return NewError("yield outside of a generator")
+	}
+
+	var value LigmaObject = NULL
+	if ye.Value != nil {
+		value = i.EvaluateExpression(ye.Value)
+		if isError(value) {
+			return value
+		}
+	}
+
+	return i.generator.yield(value)
+}
+
+// Yield suspends the generator whose body the interpreter runs, it returns
+// the value the generator is resumed with
+func (i *Interpreter) Yield(value LigmaObject) LigmaObject {
+	if i.generator == nil {
+		return NewError("yield outside of a generator")
+	}
+	return i.generator.yield(value)
+}
+
+// VisitPipeExpression desugars `a |> f(b)` into `f(a, b)` and `a |> f` into `f(a)`
+func (i *Interpreter) VisitPipeExpression(pe *PipeExpression) LigmaObject {
+	left := i.EvaluateExpression(pe.Left)
+	if isError(left) {
+		return left
+	}
+
+	args := []LigmaObject{left}
+	target := pe.Right
+
+	if call, ok := pe.Right.(*CallExpression); ok {
+		target = call.Function
+
+		for _, arg := range call.Arguments {
+			evalArg := i.EvaluateExpression(arg)
+			if isError(evalArg) {
+				return evalArg
+			}
+			args = append(args, evalArg)
+		}
+	}
+
+	function := i.EvaluateExpression(target)
+	if isError(function) {
+		return function
+	}
+
+	return ApplyFunction(i, function, args)
+}
+
+// negateComparison flips the result of a comparison, errors pass through
+func negateComparison(result LigmaObject) LigmaObject {
+	if isError(result) {
+		return result
+	}
+	return nativeBoolToBooleanObject(!IsTruthy(result))
 }
 
 func (i *Interpreter) VisitIfExpression(ie *IfExpression) LigmaObject {
@@ -419,7 +1092,7 @@ func (i *Interpreter) VisitIfExpression(ie *IfExpression) LigmaObject {
 		return condition
 	}
 
-	if isTruthy(condition) {
+	if IsTruthy(condition) {
 		return i.ExecuteStatement(ie.Consequence)
 	} else if ie.Alternative != nil {
 		return i.ExecuteStatement(ie.Alternative)
@@ -442,7 +1115,12 @@ func (i *Interpreter) VisitIndexExpression(ie *IndexExpression) LigmaObject {
 	if isError(index) {
 		return index
 	}
-	
+
+	return i.Index(left, index)
+}
+
+// Index looks index up in left through its __get__ method
+func (i *Interpreter) Index(left, index LigmaObject) LigmaObject {
 	get_func, ok := left.(*LigmaInstance).Get("__get__")
 
 	if !ok {
@@ -462,33 +1140,47 @@ func (i *Interpreter) VisitAssignExpression(ae *AssignExpression) LigmaObject {
 		return NewError("identifier %s is reserved", ae.Name.Value)
 	}
 
-	if distance, ok := i.locals[ae]; ok { // if the variable is local
-		i.Env.SetAt(distance, ae.Name.Value, val)
+	var result LigmaObject
+	if local, ok := i.locals[ae]; ok { // if the variable is local
+		result = i.Env.SetAt(local.depth, local.slot, val)
 	} else {
-		i.globals.Set(ae.Name.Value, val)
+		result = i.globals.Set(ae.Name.Value, val)
 	}
 
+	if isError(result) {
+		return result
+	}
 	return nil
 }
 
 func (i *Interpreter) VisitCallExpression(ce *CallExpression) LigmaObject {
 
 	//os.Exit(1)
+	function, args, err := i.evalCall(ce)
+	if err != nil {
+		return err
+	}
+
+	return ApplyFunction(i, function, args)
+}
+
+// evalCall evaluates the function and the arguments of a call
+func (i *Interpreter) evalCall(ce *CallExpression) (LigmaObject, []LigmaObject, LigmaObject) {
 	function := ce.Function.Accept(i)
 	if isError(function) {
-		return function
+		return nil, nil, function
 	}
-	
+
 	args := []LigmaObject{}
 	for _, arg := range ce.Arguments {
 		evalArg := arg.Accept(i)
 		if isError(evalArg) {
-			return evalArg
+			return nil, nil, evalArg
 		}
 		args = append(args, evalArg)
 	}
-	
-	return ApplyFunction(i, function, args)
+
+	return function, args, nil
 }
 
 func (i *Interpreter) VisitSelfExpression(se *Self) LigmaObject {
@@ -506,7 +1198,44 @@ func (i *Interpreter) VisitGetExpression(ge *GetExpression) LigmaObject {
 	if isError(obj) {
 		return obj
 	}
-	return evalGetExpression(obj, ge.Property)
+
+	return i.GetProperty(obj, ge.Property.Value, &ge.cache)
+}
+
+// GetProperty reads the attribute name of obj, properties with a getter are
+// computed. cache is the inline cache of the site the access is made from,
+// it may be nil
+func (i *Interpreter) GetProperty(obj LigmaObject, name string, cache *PropertyCache) LigmaObject {
+	instance, ok := obj.(*LigmaInstance)
+	if !ok {
+		return evalGetExpression(obj, name)
+	}
+
+	if cache == nil {
+		cache = &PropertyCache{}
+	}
+	cache.lookup(instance.Class, name)
+
+	// properties are computed by their getter
+	if cache.getter != nil {
+		return ApplyFunction(i, instance.bind(cache.getter), []LigmaObject{})
+	}
+
+	// fields hide the methods of the class
+	if field, ok := instance.Fields[name]; ok {
+		if method, ok := field.(*BuiltinClassMethod); ok {
+			method.ObjInstance = instance
+		}
+		return field
+	}
+
+	if cache.method == nil {
+		return &LigmaNull{}
+	}
+	if cache.method.UserMethod != nil {
+		return instance.bind(cache.method.UserMethod)
+	}
+	return cache.method.BuiltinMethod.Bind(instance)
 }
 
 func (i *Interpreter) VisitSetExpression(se *SetExpression) LigmaObject {
@@ -520,13 +1249,45 @@ func (i *Interpreter) VisitSetExpression(se *SetExpression) LigmaObject {
 		return val
 	}
 
+	return i.SetProperty(obj, se.Property.Value, val, &se.cache)
+}
+
+// SetProperty assigns val to the attribute name of obj and returns it,
+// properties go through their setter. cache is like for GetProperty
+func (i *Interpreter) SetProperty(obj LigmaObject, name string, val LigmaObject, cache *PropertyCache) LigmaObject {
 	//obj.(*LigmaInstance).Set(se.Property.Value, val)
 	//obj.(*BaseObjectInstance).Set(se.Property.Value, val)
 
 	// is it LigmaInstance or BaseObjectInstance?
 	switch obj := obj.(type) {
 		case *LigmaInstance:
-			obj.Set(se.Property.Value, val)
+			if cache == nil {
+				cache = &PropertyCache{}
+			}
+			cache.lookup(obj.Class, name)
+
+			// a property is assigned through its setter, without one it is read-only
+			if cache.setter != nil {
+				result := ApplyFunction(i, obj.bind(cache.setter), []LigmaObject{val})
+				if isError(result) {
+					return result
+				}
+				return val
+			}
+
+			if cache.getter != nil {
+				return NewError("property %s of %s has no setter", name, obj.Class.Name)
+			}
+
+			if obj.Class.Record != nil {
+				return NewError("cannot assign to field %s of record %s, use with to make a changed copy", name, obj.Class.Name)
+			}
+
+			if obj.immutable {
+				return NewError("cannot assign to attribute %s of %s, it is immutable", name, obj.Class.Name)
+			}
+
+			obj.Set(name, val)
 		//case *BaseObjectInstance:
 		//	obj.Set(se.Property.Value, val)
 	}
@@ -549,8 +1310,14 @@ func isError(obj LigmaObject) bool {
 	return false
 }
 
+// IsFatal reports whether obj is an error that ends the program
+func IsFatal(obj LigmaObject) bool {
+	err, ok := obj.(*Error)
+	return ok && err.Fatal
+}
+
 func NewError(format string, a ...interface{}) *Error {
-	println(fmt.Sprintf(format, a...))
+	fmt.Fprintln(Output, fmt.Sprintf(format, a...))
 	//os.Exit(1)
 	return &Error{Message: fmt.Sprintf(format, a...)}
 }
@@ -623,26 +1390,102 @@ func ApplyFunction(i *Interpreter, fn LigmaObject, args []LigmaObject) LigmaObje
 		}
 		
 	}
+
+	if userFunction, ok := function.(*LigmaFunction); ok && i != nil && i.CheckTypes {
+		return applyCheckedFunction(i, userFunction, args)
+	}
+
 	return function.Call(i, args...)
 }
 
-func evalGetExpression(obj LigmaObject, property *Identifier) LigmaObject {
+// applyCheckedFunction calls a user function after checking its arguments
+// against the parameter annotations, and checks the result against the
+// return annotation. Unannotated parameters accept anything
+func applyCheckedFunction(i *Interpreter, fn *LigmaFunction, args []LigmaObject) LigmaObject {
+	if err := checkArguments(fn, args); err != nil {
+		return err
+	}
+
+	return checkResult(fn, fn.Call(i, args...))
+}
+
+// checkArguments returns an error for the first argument that doesn't
+// match the annotation of its parameter
+func checkArguments(fn *LigmaFunction, args []LigmaObject) LigmaObject {
+	for idx, param := range fn.Parameters {
+		if param.Type != nil && !matchesType(args[idx], param.Type) {
+			return NewError("type error: argument %s expected %s, got %s", param.Value, param.Type.String(), typeName(args[idx]))
+		}
+	}
+	return nil
+}
+
+// checkResult returns result, or an error if it doesn't match the return
+// annotation of fn
+func checkResult(fn *LigmaFunction, result LigmaObject) LigmaObject {
+	if isError(result) {
+		return result
+	}
+
+	if fn.ReturnType != nil && !matchesType(result, fn.ReturnType) {
+		return NewError("type error: return value expected %s, got %s", fn.ReturnType.String(), typeName(result))
+	}
+
+	return result
+}
+
+// typeName is the name an annotation has to use to accept obj
+func typeName(obj LigmaObject) string {
+	switch obj := obj.(type) {
+	case nil, *LigmaNull:
+		return "null"
+	case *LigmaBoolean:
+		return "bool"
+	case *LigmaFunction, *Builtin, *BuiltinClassMethod:
+		return "func"
+	case *LigmaClass:
+		return "type"
+	case *LigmaInstance:
+		return obj.Class.Name
+	}
+	return string(obj.Type())
+}
+
+// matchesType reports whether obj satisfies the annotation t. Instances match
+// their own class and every class they inherit from, only the outer type of
+// a parameterized annotation like list[int] is checked
+func matchesType(obj LigmaObject, t *TypeAnnotation) bool {
+	if t.Name == "any" {
+		return true
+	}
+
+	if instance, ok := obj.(*LigmaInstance); ok {
+		return instance.Class.IsSubclassOf(t.Name)
+	}
+
+	return typeName(obj) == t.Name
+}
+
+func evalGetExpression(obj LigmaObject, name string) LigmaObject {
 	switch obj := obj.(type) {
 		case *LigmaClass:
 			/* if method, ok := obj.Methods[property.Value]; ok {
 				return method */
-			if method := obj.GetMethod(property.Value); method != nil {
+			if member, ok := obj.Member(name); ok {
+				return member
+			}
+			if method := obj.GetMethod(name); method != nil {
 				if method.UserMethod != nil {
 					return method.UserMethod
 				}
 				return method.BuiltinMethod
 			}
 
-			return NewError("no method %s found for class %s", property.Value, obj.Name)
+			return NewError("no method %s found for class %s", name, obj.Name)
 		case *LigmaInstance:
 			//val, _ := obj.Get(property.Value)
 			//return val
-			val, _ := obj.Get(property.Value)
+			val, _ := obj.Get(name)
 			
 			switch val := val.(type) {
 				case *LigmaFunction:
@@ -654,7 +1497,7 @@ func evalGetExpression(obj LigmaObject, property *Identifier) LigmaObject {
 			return val
 			
 		case *ReturnValue:
-			return evalGetExpression(obj.Value, property)
+			return evalGetExpression(obj.Value, name)
 
 /* 			switch val := val.(type) {
 				case *LigmaFunction:
@@ -674,7 +1517,7 @@ func evalGetExpression(obj LigmaObject, property *Identifier) LigmaObject {
 }
 
 
-func isTruthy(obj LigmaObject) bool {
+func IsTruthy(obj LigmaObject) bool {
 	switch obj {
 		case NULL:
 			return false
@@ -0,0 +1,762 @@
+package runtime_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	goruntime "runtime"
+	"runtime/debug"
+	"testing"
+	"time"
+
+	"ligma/compiler"
+	"ligma/lexer"
+	"ligma/parser"
+	"ligma/runtime"
+	"ligma/vm"
+)
+
+// benchmark parses and resolves input once and interprets it b.N times
+func benchmark(b *testing.B, input string) {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		b.Fatalf("parser errors: %v", p.Errors())
+	}
+
+	previous := runtime.Output
+	runtime.Output = io.Discard
+	defer func() { runtime.Output = previous }()
+
+	i := runtime.NewInterpreter()
+	if diagnostics := runtime.NewResolver(i).Resolve(program.Statements); len(diagnostics) != 0 {
+		b.Fatalf("resolver diagnostics: %v", diagnostics)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		i.Interpret(program)
+	}
+}
+
+// interpret resolves input and runs it on a new interpreter, or compiles it
+// and runs it on the VM, setup can configure the interpreter first. It
+// returns what the program printed
+func interpret(t *testing.T, input string, setup func(*runtime.Interpreter), compiled bool) string {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+
+	var out bytes.Buffer
+	previous := runtime.Output
+	runtime.Output = &out
+	defer func() { runtime.Output = previous }()
+
+	i := runtime.NewInterpreter()
+	if setup != nil {
+		setup(i)
+	}
+	if diagnostics := runtime.NewResolver(i).Resolve(program.Statements); len(diagnostics) != 0 {
+		t.Fatalf("resolver diagnostics: %v", diagnostics)
+	}
+
+	if compiled {
+		c := compiler.New(i)
+		vm.New(i, c).Run(c.Compile(program))
+	} else {
+		i.Interpret(program)
+	}
+
+	return out.String()
+}
+
+// engines names the two ways interpret can run a program
+var engines = []struct {
+	name     string
+	compiled bool
+}{{"interpreter", false}, {"vm", true}}
+
+func TestPrograms(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"with runs __exit__ on every way out", `
+			class Lock {
+				def init = func(name) { self.name = name }
+				def __enter__ = func() { print("acquire " + self.name) return self }
+				def __exit__ = func(err) { print("release " + self.name) return false }
+				def run = func() { with (self) { return 5 } }
+			}
+			with (Lock("a") as l) { print("inside " + l.name) }
+			print(Lock("b").run())
+			with (Lock("c")) { def z = 1 + "s" }
+			print("after")
+		`, "acquire a\ninside a\nrelease a\nacquire b\nrelease b\n5\nacquire c\nunsupported operand type(s) for +: 'int' and 'str'\nrelease c\nafter\n"},
+		{"with lets __exit__ suppress errors", `
+			class Quiet {
+				def __enter__ = func() { return 1 }
+				def __exit__ = func(err) { print("suppressing", err) return true }
+			}
+			with (Quiet() as q) { def y = q + "s" print("not reached") }
+			with (3) { print("not reached") }
+			class Half { def __enter__ = func() { return 1 } }
+			with (Half()) { print("not reached") }
+			print("after")
+		`, "unsupported operand type(s) for +: 'int' and 'str'\nsuppressing\nunsupported operand type(s) for +: 'int' and 'str'\nobject of type int does not implement __enter__\nobject of type Half does not implement __exit__\nafter\n"},
+		{"comprehensions", `
+			def xs = [3, 0 - 1, 4, 0 - 5, 9]
+			def limit = 3
+			print([x * 2 for x in xs if x > 0], [x for x in xs if x >= limit])
+			def m = {"a": 1, "b": 2}
+			print({k: v * 10 for k, v in m}, [k for k in m], [c + "!" for c in "hey"])
+			print([[a, b] for a, b in [[1, 2], [3, 4]]], [x for x in [] if x > 0])
+			def k = "kept"
+			print([k for k in [1, 2]], k)
+			print([x + "s" for x in [1]])
+		`, "[6, 8, 18]\n[3, 4, 9]\n{a: 10, b: 20}\n[a, b]\n[h!, e!, y!]\n[[1, 2], [3, 4]]\n[]\n[1, 2]\nkept\nunsupported operand type(s) for +: 'int' and 'str'\n"},
+		{"comparisons between instances", `
+			class Money {
+				def init = func(cents) { self.cents = cents }
+				def __lt__ = func(other) { return self.cents < other.cents }
+			}
+			def cheap = Money(1)
+			def dear = Money(5)
+			def compare = func(a, b) {
+				def out = ""
+				if (a < b) { out = out + "<" }
+				if (a > b) { out = out + ">" }
+				if (a <= b) { out = out + "<=" }
+				if (a >= b) { out = out + ">=" }
+				return out
+			}
+			print(compare(cheap, dear), compare(dear, cheap), compare(cheap, Money(1)))
+			print([m.cents for m in [dear, cheap, Money(3)] if m >= Money(3)])
+		`, "<<=\n>>=\n<=>=\n[5, 3]\n"},
+		{"pipes", `
+			def double = func(x) { return x * 2 }
+			def add = func(a, b) { return a + b }
+			print(5 |> double)
+			print(5 |> add(3))
+			print(2 |> double |> add(1) |> double)
+			print(1 + 2 |> double)
+			def boom = func() { return "a" - 1 }
+			print(boom() |> double)
+			print(1 |> add(boom()))
+			print(1 |> 5)
+			print("after")
+		`, "10\n8\n10\n6\nNot implemented\nNot implemented\nnot a function: int\nafter\n"},
+		{"field defaults are per instance", `
+			class Counter { def n = 0 }
+			class Bag {
+				def counter = Counter()
+				def items = {1}
+				def bump = func() { self.counter.n = self.counter.n + 1 }
+			}
+			class Sub : Bag { def extra = 1 }
+			def a = Bag()
+			def b = Bag()
+			a.bump()
+			a.items.add(5)
+			print(a.counter.n, b.counter.n, a.items, b.items, Sub().extra)
+		`, "1\n0\n{1, 5}\n{1}\n1\n"},
+		{"enums", `
+			enum Color { Red, Green, Blue = 10, Cyan }
+			print(Color.Red, Color.Blue.value, Color.Cyan.value, Color.Green.name)
+			def c = Color.Green
+			if (c == Color.Green) { print("green") }
+			if (c != Color.Red) { print("not red") }
+			if (Color.Red < Color.Blue) { print("ordered") }
+			print([x.name for x in Color])
+			def m = {Color.Red: "r", Color.Blue: "b"}
+			print(m[Color.Blue], m, len({Color.Red, Color.Red, Color.Green}))
+			enum Status { Ok = "ok", Failed = "failed" }
+			print(Status.Failed.value)
+			Color()
+			print(Color.Purple)
+		`, "Color.Red\n10\n11\nGreen\ngreen\nnot red\nordered\n[Red, Green, Blue, Cyan]\nb\n{Color.Red: r, Color.Blue: b}\n2\nfailed\ncannot instantiate enum Color\nno method Purple found for class Color\n"},
+		{"failed assertions end the program", `
+			def check = func(n) { assert n < 3, "too big" return n }
+			print(check(1))
+			for (x in [1, 2, 3, 4]) { print(check(x)) }
+			print("never")
+		`, "1\n1\n2\nassertion failed at line 2, column 26: assert (n < 3) with left = 3, right = 3: too big\n"},
+		{"constants the resolver can't see", `
+			def early = func() { MAX = 2 }
+			const MAX = 1
+			early()
+			def shadow = func(MAX) { MAX = 3 return MAX }
+			print(MAX, shadow(0))
+		`, "cannot assign to constant MAX\n1\n3\n"},
+		{"__exit__ failing while a generator is closed", `
+			class Fails {
+				def __enter__ = func() { return 1 }
+				def __exit__ = func(error) { print("exit") return "a" - 1 }
+			}
+			def gen = func() { with (Fails()) { yield 1 yield 2 } }
+			def first = func() { for (x in gen()) { return x } }
+			print(first())
+			def g = gen()
+			g.next()
+			print(g.close())
+			print("after")
+		`, "exit\nNot implemented\nexit\nNot implemented\nafter\n"},
+		{"interfaces and abstract methods", `
+			interface Shape { area; perimeter }
+			class Square implements Shape {
+				def init = func(s) { self.s = s }
+				def area = func() { return self.s * self.s }
+				def perimeter = func() { return self.s * 4 }
+			}
+			def sq = Square(3)
+			print(sq.area())
+			if (sq implements Shape) { print("square is a shape") }
+			class Duck {
+				def area = func() { return 1 }
+				def perimeter = func() { return 2 }
+			}
+			if (Duck() implements Shape) { print("duck is a shape too") }
+			class Blob { }
+			if (Blob() implements Shape) { print("wrong") } else { print("blob is not") }
+			class Base {
+				abstract def name
+				def greet = func() { return "hi " + self.name() }
+			}
+			class Bob : Base {
+				def name = func() { return "bob" }
+			}
+			print(Bob().greet())
+			Base()
+			Shape()
+			def takes = func(s: Shape) -> int { return s.area() }
+			print(takes(sq))
+			class Broken : Base { }
+			class Half implements Shape { def area = func() { return 0 } }
+			print("after")
+		`, "9\nsquare is a shape\nduck is a shape too\nblob is not\nhi bob\ncannot instantiate abstract class Base, it doesn't implement name\ncannot instantiate interface Shape\n9\nclass Broken does not implement name\nclass Half does not implement perimeter\nafter\n"},
+		{"property accessors", `
+			class Circle {
+				def init = func(r) { self.radius = r }
+				get area = func() { return self._r * self._r * 3 }
+				get radius = func() { return self._r }
+				set radius = func(v) {
+					if (v < 0) { return print("radius must be positive") }
+					self._r = v
+				}
+			}
+			def c = Circle(2)
+			print(c.area)
+			c.radius = 5
+			print(c.radius)
+			print(c.area)
+			c.radius = 0 - 1
+			print(c.radius)
+			c.area = 3
+			class Ring : Circle {
+				def init = func(r) { self.radius = r }
+				get diameter = func() { return self.radius * 2 }
+			}
+			def r = Ring(4)
+			print(r.diameter)
+			print(r.area)
+		`, "12\n5\n75\nradius must be positive\n5\nproperty area of Circle has no setter\n8\n48\n"},
+		{"in and not in", `
+			def xs = [1, 2, 3]
+			if (2 in xs) { print("2 in xs") }
+			if (5 not in xs) { print("5 not in xs") }
+			if ("a" in ["a", 1]) { print("a found") }
+			if (1.0 in xs) { print("float eq int") }
+			def m = {"k": 1}
+			if ("k" in m) { print("k key") }
+			if (1 not in m) { print("1 not key") }
+			if ("ell" in "hello") { print("substr") }
+			class Range {
+				def init = func(lo, hi) { self.lo = lo; self.hi = hi }
+				def __contains__ = func(x) { return (x >= self.lo) and (x < self.hi) }
+			}
+			if (3 in Range(1, 5)) { print("in range") }
+			if (7 not in Range(1, 5)) { print("not in range") }
+			print([x for x in xs if x not in [2]])
+			if (1 in 5) { print("wrong") }
+			print("ell" in 3)
+		`, "2 in xs\n5 not in xs\na found\nfloat eq int\nk key\n1 not key\nsubstr\nin range\nnot in range\n[1, 3]\nargument of type int is not a container\nargument of type int is not a container\n"},
+		{"record with", `
+			record Point(x, y)
+			def p = Point(1, 2)
+			print(p.with({"y": 5}), p)
+			p.with({"z": 1})
+			p.with(x = 5)
+			p.with()
+			p.with(3)
+		`, "Point(x=1, y=5)\nPoint(x=1, y=2)\nPoint has no field z\nwith expects a map of changes\nwrong number of arguments. got=0, want=1\nwith expects a map of changes, got int\n"},
+		{"records", `
+			record Point(x, y)
+			def p = Point(1, 2)
+			print(p.x, p.y, p)
+			if (p == Point(1, 2)) { print("equal") }
+			if (p != Point(2, 1)) { print("different") }
+			def m = {Point(1, 2): "found"}
+			print(m[Point(1, 2)])
+			Point(1)
+		`, "1\n2\nPoint(x=1, y=2)\nequal\ndifferent\nfound\nwrong number of arguments. got=1, want=2\n"},
+		{"tuples", `
+			def t = (1, "a", 2.5)
+			print(t, t[0], len(t), (1,))
+			if ((1, 2) == (1, 2)) { print("equal") }
+			if ((1, 2) < (1, 3)) { print("less") }
+			if ((2,) > (1, 9)) { print("greater") }
+			def divmod = func(a, b) { return (a / b, a - b) }
+			def (q, r) = divmod(7, 2)
+			print(q, r)
+			def m = {(0, 1): "found"}
+			print(m[(0, 1)])
+			def (a, b) = (1, 2, 3)
+			def s = {(1, [2]): 1}
+		`, "(1, a, 2.500000)\n1\n3\n(1,)\nequal\nless\ngreater\n3.500000\n5\nfound\ncannot unpack tuple into 2 values\nunhashable type: list\n"},
+		{"floats hash by value", `
+			def s = {1.5, 2.5, 3.5, 2.5}
+			print(s, len(s), {(1, 2.5): "t"}[(1, 2.5)])
+			if (1.5 in {2.5}) { print("wrong") }
+			if (2.5 in s) { print("found") }
+		`, "{1.500000, 2.500000, 3.500000}\n3\nt\nfound\n"},
+		{"instances without __hash__ are unhashable", `
+			class P { def init = func(x) { self.x = x } }
+			def s = {1}
+			s.add(P(1))
+			print(P(2) in s)
+			def m = {P(3): 1}
+			print({P(1), P(2)})
+			print(len(s))
+		`, "unhashable type: P\nunhashable type: P\nunhashable type: P\nunhashable type: P\n1\n"},
+		{"instances hash through __hash__ and compare with __eq__", `
+			class H {
+				def init = func(x) { self.x = x }
+				def __hash__ = func() { return self.x % 2 }
+				def __eq__ = func(other) { return self.x == other.x }
+			}
+			print(len({H(1), H(3), H(1)}))
+			def m = {H(1): "one", H(3): "three"}
+			print(m[H(1)], m[H(3)])
+			if (H(3) in {H(1)}) { print("wrong") }
+			if (H(5) not in m) { print("no five") }
+			class Same { def __hash__ = func() { return 1 } }
+			def a = Same()
+			print(len({a, Same(), a}))
+		`, "2\none\nthree\nno five\n2\n"},
+		{"equal numbers are the same key", `
+			print({1, 1.0}, {1: "int"}[1.0], {2.5: "a"}[2.5])
+			if (1 in {1.0}) { print("1 in {1.0}") }
+			if ((1, 2) in {(1, 2.0)}) { print("(1, 2) in {(1, 2.0)}") }
+			print(len({(1, 2), (1, 2.0), (2, 1)}))
+		`, "{1}\nint\na\n1 in {1.0}\n(1, 2) in {(1, 2.0)}\n2\n"},
+		{"__hash__ has to return an int", `
+			class Bad { def __hash__ = func() { return "no" } }
+			class Worse { def __hash__ = func() { return "a" - 1 } }
+			def s = {1}
+			s.add(Bad())
+			s.add(Worse())
+			print(len(s))
+		`, "__hash__ of Bad must return int, got str\nNot implemented\n1\n"},
+		{"arithmetic", `
+			def a = 7
+			def b = 2.5
+			print(a + 3, a - 10, a * 2, a / 2, a % 4, b * 2, "x" + "y")
+			def yes = func(b) { if (b) { return "yes" } return "no" }
+			print(yes(a < 8), yes(a >= 7), yes(a == 7), yes(a != 7), yes(1 in [1, 2]), yes(3 not in [1, 2]))
+			print(yes(!true), yes(!null), yes(true and false), yes(true or false))
+		`, "10\n-3\n14\n3.500000\n3\n5.000000\nxy\nyes\nyes\nyes\nno\nyes\nyes\nno\nyes\nno\nyes\n"},
+		{"branches and loops", `
+			def i = 0
+			def total = 0
+			while (i < 10) {
+				def step = i * 2
+				if (step > 10) { total = total + step } else { total = total - 1 }
+				i = i + 1
+			}
+			print(total)
+			for (x in [1, 2, 3]) { for (y in ["a", "b"]) { print(x, y) } }
+			for (k, v in {"one": 1, "two": 2}) { print(k, v) }
+			if (false) { print("never") }
+		`, "54\n1\na\n1\nb\n2\na\n2\nb\n3\na\n3\nb\none\n1\ntwo\n2\n"},
+		{"functions and closures", `
+			def fib = func(n) { if (n < 2) { return n } return fib(n - 1) + fib(n - 2) }
+			print(fib(15))
+			def counter = func() {
+				def count = 0
+				return func() { count = count + 1 return count }
+			}
+			def next = counter()
+			next() next()
+			print(next())
+			def find = func(xs, want) {
+				def i = 0
+				while (i < 10) { if (xs[i] == want) { return i } i = i + 1 }
+				return -1
+			}
+			print(find([4, 5, 6], 6))
+			def adders = [func(x) { return x + n } for n in [1, 2]]
+			print(adders[1](10))
+		`, "610\n3\n2\n12\n"},
+		{"classes", `
+			class Animal {
+				def sound = "..."
+				def init = func(name) { self.name = name }
+				def speak = func() { return self.name + " says " + self.sound }
+				def __str__ = func() { return "<" + self.name + ">" }
+			}
+			class Dog : Animal {
+				def sound = "woof"
+				def init = func(name) { self.name = name }
+				def speak = func() { return super.speak() + "!" }
+				get loud = func() { return self.sound + self.sound }
+			}
+			def d = Dog("rex")
+			print(d.speak(), d.loud)
+			print(d)
+			def dogs = [Dog("a"), Dog("b")]
+			for (dog in dogs) { print(dog.speak()) }
+			record Point(x, y)
+			print(Point(1, 2))
+		`, "rex says woof!\nwoofwoof\n<rex>\na says woof!\nb says woof!\nPoint(x=1, y=2)\n"},
+		{"generators", `
+			def count = func(n) {
+				def i = 0
+				while (i < n) { yield i i = i + 1 }
+			}
+			for (x in count(3)) { print(x) }
+			def gen = count(10)
+			for (x in gen) { if (x == 2) { print("stop") } }
+		`, "0\n1\n2\nstop\n"},
+		{"errors", `
+			def f = func(x) { return x() }
+			print(f(1))
+			def len = 3
+			print("after")
+			def g = func(a) { return a }
+			g(1, 2)
+			def m = {"a": 1}
+			m.nope()
+			for (x in 5) { print(x) }
+			print("still running")
+			def l = [1, f(2), 3]
+		`, "not a function: int\nBuilt-in function len cannot be redefined\nafter\nwrong number of arguments. got=2, want=1\nnot a function: NULL\nobject of type int is not iterable\nstill running\nnot a function: int\n"},
+		{"statements the compiler doesn't lower", `
+			class Trace {
+				def init = func(name) { self.name = name }
+				def __enter__ = func() { print("enter", self.name) return self.name }
+				def __exit__ = func(error) { print("exit", self.name) }
+			}
+			def mixed = func(n) {
+				def total = 0
+				for (k in [1, 2, 3]) {
+					def (q, r) = (k * n, k)
+					assert q >= r, "q is smaller"
+					with (Trace("loop") as name) {
+						total = total + q + r
+						print(name, total)
+					}
+				}
+				record Pair(a, b)
+				enum Side { LEFT, RIGHT }
+				interface Shape { area }
+				class Square implements Shape {
+					def init = func(s) { self.s = s }
+					def area = func() { return self.s * self.s }
+				}
+				def p = Pair(total, Side.LEFT)
+				print(p, Square(n).area())
+				if (Square(n) implements Shape) { print("implements") }
+				def (x, y) = (p.a, n)
+				return x + y
+			}
+			print(mixed(2), mixed(3))
+			def (a, b) = (1, 2)
+			with (Trace("top") as t) { print(a + b, t) }
+		`, "enter\nloop\nloop\n3\nexit\nloop\nenter\nloop\nloop\n9\nexit\nloop\nenter\nloop\nloop\n18\nexit\nloop\nPair(a=18, b=Side.LEFT)\n4\nimplements\nenter\nloop\nloop\n4\nexit\nloop\nenter\nloop\nloop\n12\nexit\nloop\nenter\nloop\nloop\n24\nexit\nloop\nPair(a=24, b=Side.LEFT)\n9\nimplements\n20\n27\nenter\ntop\n3\ntop\nexit\ntop\n"},
+		{"property caches follow a class that is defined again", `
+			class A { def name = func() { return "first" } }
+			def call = func(o) { return o.name() }
+			print(call(A()))
+			class A { def name = func() { return "second" } }
+			print(call(A()))
+		`, "first\nsecond\n"},
+		{"property caches with two classes at one site", `
+			class A { def name = func() { return "a" } get size = func() { return 1 } }
+			class B { def name = func() { return "b" } def size = 2 }
+			for (o in [A(), B(), A(), B()]) { print(o.name(), o.size) }
+		`, "a\n1\nb\n2\na\n1\nb\n2\n"},
+		{"property caches let fields shadow methods", `
+			class C { def name = func() { return "method" } }
+			def call = func(o) { return o.name() }
+			def shadowed = C()
+			print(call(C()))
+			shadowed.name = func() { return "field" }
+			print(call(shadowed))
+			print(call(C()))
+		`, "method\nfield\nmethod\n"},
+		{"property caches with inherited accessors", `
+			class Base {
+				get size = func() { return self._s }
+				set size = func(v) { self._s = v * 2 }
+			}
+			class Sub : Base {}
+			def resize = func(o, v) { o.size = v return o.size }
+			print(resize(Base(), 1))
+			print(resize(Sub(), 2))
+			print(resize(Base(), 3))
+		`, "2\n4\n6\n"},
+		{"tail calls", `
+			def count = func(n, acc) { if (n == 0) { return acc } return count(n - 1, acc + 1) }
+			print(count(10, 0))
+			def show = func(x) { return print(x) }
+			show("builtin")
+			def wrong = func() { return count(1) }
+			wrong()
+		`, "10\nbuiltin\nwrong number of arguments. got=1, want=2\n"},
+	}
+
+	for _, tt := range tests {
+		for _, engine := range engines {
+			output := interpret(t, tt.input, nil, engine.compiled)
+			if output != tt.expected {
+				t.Errorf("%s (%s): wrong output.\nexpected:\n%s\ngot:\n%s", tt.name, engine.name, tt.expected, output)
+			}
+		}
+	}
+}
+
+func TestCheckTypes(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"arguments", `
+			def twice = func(x: int) { return x * 2 }
+			print(twice(2))
+			twice("s")
+			def any = func(x) { return x }
+			print(any("s"))
+		`, "4\ntype error: argument x expected int, got str\ns\n"},
+		{"return values", `
+			def name = func(x) -> str { return x }
+			print(name("ok"))
+			name(1)
+		`, "ok\ntype error: return value expected str, got int\n"},
+		{"constructors", `
+			class A { def init = func(x: int) { self.x = x } }
+			print(A(1).x)
+			A("s")
+			A()
+			print("after")
+		`, "1\ntype error: argument x expected int, got str\nwrong number of arguments. got=0, want=1\nafter\n"},
+		{"tail calls", `
+			def down = func(n: int) -> int { if (n == 0) { return 0 } return down(n - 1) }
+			print(down(100000))
+			def outer = func(n) -> str { return inner(n) }
+			def inner = func(n) -> int { return n }
+			outer(1)
+			def wrong = func(n: int) { return down("s") }
+			wrong(1)
+			def last = func(n) -> int { return name(n) }
+			def name = func(n) -> str { return n }
+			last(1)
+		`, "0\ntype error: return value expected str, got int\ntype error: argument n expected int, got str\ntype error: return value expected str, got int\n"},
+	}
+
+	for _, tt := range tests {
+		for _, engine := range engines {
+			output := interpret(t, tt.input, func(i *runtime.Interpreter) { i.CheckTypes = true }, engine.compiled)
+			if output != tt.expected {
+				t.Errorf("%s (%s): wrong output.\nexpected:\n%s\ngot:\n%s", tt.name, engine.name, tt.expected, output)
+			}
+		}
+	}
+}
+
+func TestTailCallsRunInConstantStack(t *testing.T) {
+	// without the trampoline every call below takes a few kilobytes of Go
+	// stack, far more than the limit allows
+	defer debug.SetMaxStack(debug.SetMaxStack(4 << 20))
+
+	for _, engine := range engines {
+		output := interpret(t, `
+			def count = func(n, acc) { if (n == 0) { return acc } return count(n - 1, acc + 1) }
+			print(count(100000, 0))
+			def even = func(n) { if (n == 0) { return "even" } return odd(n - 1) }
+			def odd = func(n) { if (n == 0) { return "odd" } return even(n - 1) }
+			print(even(100001))
+			class Walker { def walk = func(n) { if (n == 0) { return "done" } return self.walk(n - 1) } }
+			print(Walker().walk(100000))
+		`, nil, engine.compiled)
+
+		if expected := "100000\nodd\ndone\n"; output != expected {
+			t.Errorf("%s: wrong output.\nexpected:\n%s\ngot:\n%s", engine.name, expected, output)
+		}
+	}
+}
+
+func TestGeneratorsLeaveNoGoroutines(t *testing.T) {
+	previous := runtime.Output
+	runtime.Output = io.Discard
+	defer func() { runtime.Output = previous }()
+
+	before := goruntime.NumGoroutine()
+
+	// programs are fed one after the other, like the REPL does
+	i := runtime.NewInterpreter()
+	r := runtime.NewResolver(i)
+	interpret := func(input string) {
+		p := parser.New(lexer.New(input))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			t.Fatalf("parser errors: %v", p.Errors())
+		}
+		if diagnostics := r.Resolve(program.Statements); len(diagnostics) != 0 {
+			t.Fatalf("resolver diagnostics: %v", diagnostics)
+		}
+		i.Interpret(program)
+	}
+
+	interpret(`
+		def count = func() { def n = 0 while (true) { yield n n = n + 1 } }
+		def first = func() { for (x in count()) { return x } }
+		def fail = func() { for (x in count()) { if (x > 2) { x.missing() } } }
+		def peek = func() { def it = count() it.next() it.next() }
+		def release = func() { def done = count() done.next() done.close() }
+		fail()
+		def k = 0
+		while (k < 20) { first() peek() k = k + 1 }
+	`)
+
+	// generators dropped after a next are closed once they are collected.
+	// A builtin method holds on to the instance it was last bound to, so
+	// next is bound to a generator that finishes first
+	deadline := time.Now().Add(5 * time.Second)
+	for goruntime.NumGoroutine() > before && time.Now().Before(deadline) {
+		interpret(`release()`)
+		goruntime.GC()
+		time.Sleep(time.Millisecond)
+	}
+
+	if after := goruntime.NumGoroutine(); after > before {
+		t.Errorf("generators left %d goroutines behind", after-before)
+	}
+}
+
+func TestInternedStrings(t *testing.T) {
+	i := runtime.NewInterpreter()
+	if i.Intern("a") != i.Intern("a") {
+		t.Errorf("an interpreter should share the instance of a literal")
+	}
+	if runtime.NewInterpreter().Intern("a") == i.Intern("a") {
+		t.Errorf("interpreters should not share interned strings")
+	}
+
+	// the table is bounded, past it literals get instances of their own
+	for n := 0; n < 10000; n++ {
+		i.Intern(fmt.Sprint(n))
+	}
+	if i.Intern("late") == i.Intern("late") {
+		t.Errorf("a full table should not grow")
+	}
+}
+
+func BenchmarkLocalLoop(b *testing.B) {
+	benchmark(b, `
+		def count = func(n) {
+			def i = 0
+			def total = 0
+			while (i < n) {
+				def step = i * 2
+				total = total + step
+				i = i + 1
+			}
+			return total
+		}
+		count(1000)
+	`)
+}
+
+func BenchmarkNestedScopes(b *testing.B) {
+	benchmark(b, `
+		def digits = [0, 1, 2, 3, 4, 5, 6, 7, 8, 9]
+		def sum = func(n) {
+			def total = 0
+			def k = 0
+			while (k < n) {
+				for (x in digits) {
+					for (y in digits) {
+						if (y > 4) { total = total + x + y }
+					}
+				}
+				k = k + 1
+			}
+			return total
+		}
+		sum(5)
+	`)
+}
+
+func BenchmarkRecursion(b *testing.B) {
+	benchmark(b, `
+		def fib = func(n) {
+			if (n < 2) { return n }
+			return fib(n - 1) + fib(n - 2)
+		}
+		fib(15)
+	`)
+}
+
+func BenchmarkClosures(b *testing.B) {
+	benchmark(b, `
+		def counter = func() {
+			def count = 0
+			return func() { count = count + 1 return count }
+		}
+		def next = counter()
+		def i = 0
+		while (i < 1000) { next() i = i + 1 }
+	`)
+}
+
+func BenchmarkMethodCalls(b *testing.B) {
+	benchmark(b, `
+		class Counter {
+			def init = func() { self.count = 0 }
+			def add = func(n) { self.count = self.count + n }
+			get total = func() { return self.count }
+		}
+		class Loud : Counter {
+			def init = func() { self.count = 0 }
+		}
+		def c = Loud()
+		def i = 0
+		while (i < 1000) { c.add(i) c.total i = i + 1 }
+	`)
+}
+
+func BenchmarkLiterals(b *testing.B) {
+	benchmark(b, `
+		def i = 0
+		while (i < 1000) {
+			def words = ["alpha", "beta", "gamma"]
+			def ratio = 1.5
+			i = i + 1
+		}
+	`)
+}
+
+func BenchmarkSmallIntegers(b *testing.B) {
+	benchmark(b, `
+		def total = 0
+		for (x in [1, 2, 3, 4, 5, 6, 7, 8, 9, 10]) {
+			def k = 0
+			while (k < 20) { total = (total + x * k) % 200 k = k + 1 }
+		}
+	`)
+}
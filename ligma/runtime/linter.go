@@ -0,0 +1,687 @@
+package runtime
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"ligma/token"
+)
+
+// lint rules, every rule can be switched on and off on its own
+const (
+	LintUnusedVariable   = "unused-variable"
+	LintUnusedParameter  = "unused-parameter"
+	LintShadow           = "shadow"
+	LintUnreachable      = "unreachable"
+	LintUndeclaredGlobal = "undeclared-global"
+	LintAlwaysTrue       = "always-true"
+	LintFieldOutsideInit = "field-outside-init"
+)
+
+// LintRules lists every rule the Linter knows
+var LintRules = []string{
+	LintUnusedVariable,
+	LintUnusedParameter,
+	LintShadow,
+	LintUnreachable,
+	LintUndeclaredGlobal,
+	LintAlwaysTrue,
+	LintFieldOutsideInit,
+	LintUseBeforeAssignment,
+	LintMissingReturn,
+	LintInfiniteLoop,
+}
+
+// lintSuppression is the comment that silences warnings, on its own line it
+// covers the next line, after code it covers its own line. It can be
+// followed by the rules to silence, without any it silences all of them
+const lintSuppression = "# lint:ignore"
+
+// Binding kinds
+const (
+	_ int = iota
+	bind_GLOBAL
+	bind_LOCAL
+	bind_PARAMETER
+	bind_TARGET // loop, comprehension and with targets
+)
+
+type lintBinding struct {
+	name *Identifier
+	kind int
+	used bool
+}
+
+type lintScope map[string]*lintBinding
+
+// Linter reports suspicious but legal code. It walks the tree through the
+// same visitor interfaces as the Resolver and tracks scopes the same way
+type Linter struct {
+	enabled map[string]bool
+
+	globals lintScope
+	scopes  []lintScope
+
+	// classFields maps a class to the fields declared in its body, set
+	// through a setter or assigned in init, superclasses to its superclass
+	classFields  map[string]map[string]bool
+	superclasses map[string]string
+
+	currentClass string // class of the method being linted
+	inInit       bool
+
+	diagnostics []Diagnostic
+}
+
+// NewLinter returns a linter with all rules enabled
+func NewLinter() *Linter {
+	if builtinsClasses["int"] == nil {
+		DefineBuiltinTypes()
+	}
+
+	l := &Linter{enabled: map[string]bool{}}
+	l.Enable(LintRules...)
+	return l
+}
+
+// Enable switches rules on
+func (l *Linter) Enable(rules ...string) error {
+	return l.setRules(rules, true)
+}
+
+// Disable switches rules off
+func (l *Linter) Disable(rules ...string) error {
+	return l.setRules(rules, false)
+}
+
+func (l *Linter) setRules(rules []string, enabled bool) error {
+	for _, rule := range rules {
+		if _, ok := l.enabled[rule]; !ok && !isLintRule(rule) {
+			return fmt.Errorf("unknown lint rule %s", rule)
+		}
+		l.enabled[rule] = enabled
+	}
+	return nil
+}
+
+func isLintRule(rule string) bool {
+	for _, r := range LintRules {
+		if r == rule {
+			return true
+		}
+	}
+	return false
+}
+
+// Lint returns the warnings for a program sorted by position, source is the
+// text the program was parsed from and is searched for suppression comments
+func (l *Linter) Lint(program *Program, source string) []Diagnostic {
+	l.globals = lintScope{}
+	l.scopes = nil
+	l.classFields = map[string]map[string]bool{}
+	l.superclasses = map[string]string{}
+	l.diagnostics = nil
+
+	l.declareGlobals(program.Statements)
+	l.lintStatements(program.Statements)
+
+	for _, d := range AnalyzeFlow(program.Statements) {
+		if l.enabled[d.Rule] {
+			l.diagnostics = append(l.diagnostics, d)
+		}
+	}
+
+	suppressed := lintSuppressions(source)
+
+	diagnostics := []Diagnostic{}
+	for _, d := range l.diagnostics {
+		if rules, ok := suppressed[d.Line]; ok && (len(rules) == 0 || rules[d.Rule]) {
+			continue
+		}
+		diagnostics = append(diagnostics, d)
+	}
+
+	sort.SliceStable(diagnostics, func(a, b int) bool {
+		if diagnostics[a].Line != diagnostics[b].Line {
+			return diagnostics[a].Line < diagnostics[b].Line
+		}
+		return diagnostics[a].Column < diagnostics[b].Column
+	})
+
+	return diagnostics
+}
+
+// lintSuppressions maps line numbers to the rules silenced on them, an
+// empty set silences every rule
+func lintSuppressions(source string) map[int]map[string]bool {
+	suppressed := map[int]map[string]bool{}
+
+	for idx, line := range strings.Split(source, "\n") {
+		pos := strings.Index(line, lintSuppression)
+		if pos < 0 {
+			continue
+		}
+
+		rules := map[string]bool{}
+		for _, rule := range strings.FieldsFunc(line[pos+len(lintSuppression):], func(r rune) bool { return r == ',' || r == ' ' || r == '\t' }) {
+			rules[rule] = true
+		}
+
+		// lines are counted from 1
+		target := idx + 1
+		if strings.TrimSpace(line[:pos]) == "" {
+			target++
+		}
+		suppressed[target] = rules
+	}
+
+	return suppressed
+}
+
+func (l *Linter) report(rule string, tok token.Token, format string, a ...interface{}) {
+	if !l.enabled[rule] {
+		return
+	}
+
+	d := newDiagnostic(tok, format, a...)
+	d.Rule = rule
+	l.diagnostics = append(l.diagnostics, d)
+}
+
+// declareGlobals declares the names bound at the top level up front, a
+// function may assign a global that is defined further down
+func (l *Linter) declareGlobals(stmts []Statement) {
+	for _, stmt := range stmts {
+		switch stmt := stmt.(type) {
+		case *DefStatement:
+			l.globals[stmt.Name.Value] = &lintBinding{name: stmt.Name, kind: bind_GLOBAL}
+		case *UnpackStatement:
+			for _, target := range stmt.Targets {
+				l.globals[target.Value] = &lintBinding{name: target, kind: bind_GLOBAL}
+			}
+		case *Class:
+			l.globals[stmt.Name.Value] = &lintBinding{name: stmt.Name, kind: bind_GLOBAL}
+		case *EnumStatement:
+			l.globals[stmt.Name.Value] = &lintBinding{name: stmt.Name, kind: bind_GLOBAL}
+		case *RecordStatement:
+			l.globals[stmt.Name.Value] = &lintBinding{name: stmt.Name, kind: bind_GLOBAL}
+		case *InterfaceStatement:
+			l.globals[stmt.Name.Value] = &lintBinding{name: stmt.Name, kind: bind_GLOBAL}
+		}
+	}
+}
+
+func (l *Linter) lintStatements(stmts []Statement) {
+	for _, stmt := range stmts {
+		stmt.Accept(l)
+	}
+}
+
+func (l *Linter) lintExpression(expr Expression) {
+	if expr != nil {
+		expr.Accept(l)
+	}
+}
+
+func (l *Linter) beginScope() {
+	l.scopes = append(l.scopes, lintScope{})
+}
+
+// endScope closes the innermost scope and reports what was never read in it
+func (l *Linter) endScope() {
+	scope := l.scopes[len(l.scopes)-1]
+	l.scopes = l.scopes[:len(l.scopes)-1]
+
+	for name, binding := range scope {
+		if binding.used || strings.HasPrefix(name, "_") {
+			continue
+		}
+
+		switch binding.kind {
+		case bind_LOCAL:
+			l.report(LintUnusedVariable, binding.name.Token, "local variable %s is never used", name)
+		case bind_PARAMETER:
+			l.report(LintUnusedParameter, binding.name.Token, "parameter %s is never used", name)
+		}
+	}
+}
+
+// declare binds name in the innermost scope, at the top level the name is
+// already known from declareGlobals
+func (l *Linter) declare(name *Identifier, kind int) {
+	if len(l.scopes) == 0 {
+		return
+	}
+
+	if outer, ok := l.enclosing(name.Value); ok {
+		l.report(LintShadow, name.Token, "%s shadows the variable declared at line %d", name.Value, outer.name.Token.Line)
+	}
+
+	l.scopes[len(l.scopes)-1][name.Value] = &lintBinding{name: name, kind: kind}
+}
+
+// enclosing finds a binding of name outside the innermost scope
+func (l *Linter) enclosing(name string) (*lintBinding, bool) {
+	for idx := len(l.scopes) - 2; idx >= 0; idx-- {
+		if binding, ok := l.scopes[idx][name]; ok {
+			return binding, true
+		}
+	}
+
+	binding, ok := l.globals[name]
+	return binding, ok
+}
+
+// lookup finds the binding name refers to from the current scope
+func (l *Linter) lookup(name string) (*lintBinding, bool) {
+	for idx := len(l.scopes) - 1; idx >= 0; idx-- {
+		if binding, ok := l.scopes[idx][name]; ok {
+			return binding, true
+		}
+	}
+
+	binding, ok := l.globals[name]
+	return binding, ok
+}
+
+func (l *Linter) lintFunction(fn *FunctionLiteral) {
+	l.beginScope()
+	for _, param := range fn.Parameters {
+		l.declare(param, bind_PARAMETER)
+	}
+	l.lintStatements(fn.Body.Statements)
+	l.endScope()
+}
+
+// knowsField reports whether a field of class is declared in the class
+// body, set in init or has a setter, looking through the superclasses.
+// Fields of classes that aren't part of the program count as known
+func (l *Linter) knowsField(class, field string) bool {
+	for class != "" {
+		fields, ok := l.classFields[class]
+		if !ok || fields[field] {
+			return true
+		}
+		class = l.superclasses[class]
+	}
+	return false
+}
+
+func (l *Linter) VisitDefStatement(def *DefStatement) LigmaObject {
+	// declared first so the function can refer to itself
+	if _, ok := def.Value.(*FunctionLiteral); ok {
+		l.declare(def.Name, bind_LOCAL)
+		l.lintExpression(def.Value)
+		return nil
+	}
+
+	l.lintExpression(def.Value)
+	l.declare(def.Name, bind_LOCAL)
+	return nil
+}
+
+func (l *Linter) VisitUnpackStatement(us *UnpackStatement) LigmaObject {
+	l.lintExpression(us.Value)
+	for _, target := range us.Targets {
+		l.declare(target, bind_LOCAL)
+	}
+	return nil
+}
+
+func (l *Linter) VisitReturnStatement(rs *ReturnStatement) LigmaObject {
+	l.lintExpression(rs.ReturnValue)
+	return nil
+}
+
+func (l *Linter) VisitExpressionStatement(es *ExpressionStatement) LigmaObject {
+	l.lintExpression(es.Expression)
+	return nil
+}
+
+func (l *Linter) VisitBlockStatement(block *BlockStatement) LigmaObject {
+	l.beginScope()
+	l.lintStatements(block.Statements)
+	l.endScope()
+	return nil
+}
+
+func (l *Linter) VisitClassStatement(cs *Class) LigmaObject {
+	l.declare(cs.Name, bind_LOCAL)
+
+	if cs.Superclass != nil {
+		l.lintExpression(cs.Superclass)
+		l.superclasses[cs.Name.Value] = cs.Superclass.Value
+	}
+	for _, iface := range cs.Interfaces {
+		l.lintExpression(iface)
+	}
+
+	fields := map[string]bool{}
+	for _, field := range cs.Fields {
+		fields[field.Name.Value] = true
+		l.lintExpression(field.Value)
+	}
+	for _, setter := range cs.Setters {
+		fields[setter.Name.Value] = true
+	}
+	l.classFields[cs.Name.Value] = fields
+
+	enclosingClass, enclosingInit := l.currentClass, l.inInit
+	l.currentClass = cs.Name.Value
+
+	// init goes first, the fields it sets are known in the other methods
+	methods := []*DefStatement{}
+	for _, method := range cs.Methods {
+		if method.Name.Value == "init" {
+			methods = append([]*DefStatement{method}, methods...)
+		} else {
+			methods = append(methods, method)
+		}
+	}
+	methods = append(append(methods, cs.Getters...), cs.Setters...)
+
+	for _, method := range methods {
+		l.inInit = method.Name.Value == "init"
+		if fn, ok := method.Value.(*FunctionLiteral); ok {
+			l.lintFunction(fn)
+		}
+	}
+
+	l.currentClass, l.inInit = enclosingClass, enclosingInit
+	return nil
+}
+
+func (l *Linter) VisitEnumStatement(es *EnumStatement) LigmaObject {
+	l.declare(es.Name, bind_LOCAL)
+	for _, member := range es.Members {
+		l.lintExpression(member.Value)
+	}
+	return nil
+}
+
+func (l *Linter) VisitRecordStatement(rs *RecordStatement) LigmaObject {
+	l.declare(rs.Name, bind_LOCAL)
+	return nil
+}
+
+func (l *Linter) VisitInterfaceStatement(is *InterfaceStatement) LigmaObject {
+	l.declare(is.Name, bind_LOCAL)
+	return nil
+}
+
+func (l *Linter) VisitWhileStatement(ws *WhileStatement) LigmaObject {
+	l.lintExpression(ws.Condition)
+	ws.Body.Accept(l)
+	return nil
+}
+
+func (l *Linter) VisitForStatement(fs *ForStatement) LigmaObject {
+	l.lintExpression(fs.Iterable)
+
+	l.beginScope()
+	for _, target := range fs.Targets {
+		l.declare(target, bind_TARGET)
+	}
+	l.lintStatements(fs.Body.Statements)
+	l.endScope()
+	return nil
+}
+
+func (l *Linter) VisitWithStatement(ws *WithStatement) LigmaObject {
+	l.lintExpression(ws.Manager)
+
+	l.beginScope()
+	if ws.Name != nil {
+		l.declare(ws.Name, bind_TARGET)
+	}
+	l.lintStatements(ws.Body.Statements)
+	l.endScope()
+	return nil
+}
+
+func (l *Linter) VisitAssertStatement(as *AssertStatement) LigmaObject {
+	l.lintExpression(as.Condition)
+	l.lintExpression(as.Message)
+	return nil
+}
+
+func (l *Linter) VisitPrefixExpression(pe *PrefixExpression) LigmaObject {
+	l.lintExpression(pe.Right)
+	return nil
+}
+
+func (l *Linter) VisitInfixExpression(ie *InfixExpression) LigmaObject {
+	l.lintExpression(ie.Left)
+	l.lintExpression(ie.Right)
+
+	if isComparison(ie.Operator) && alwaysTrue(ie) {
+		l.report(LintAlwaysTrue, ie.Token, "comparison %s is always true", ie.String())
+	}
+	return nil
+}
+
+// alwaysTrue reports whether a comparison holds no matter what, because it
+// compares an expression with itself or literals that satisfy it
+func alwaysTrue(ie *InfixExpression) bool {
+	switch ie.Operator {
+	case "==", "<=", ">=":
+		if isPure(ie.Left) && ie.Left.String() == ie.Right.String() {
+			return true
+		}
+	}
+
+	left, leftKind := literalValue(ie.Left)
+	right, rightKind := literalValue(ie.Right)
+	if leftKind == "" || leftKind != rightKind {
+		return false
+	}
+
+	result := EvalInfixExpression(ie.Operator, left, right)
+	return !isError(result) && IsTruthy(result)
+}
+
+// isPure reports whether evaluating expr twice gives the same value
+func isPure(expr Expression) bool {
+	switch expr := expr.(type) {
+	case *Identifier, *Self, *IntegerLiteral, *FloatLiteral, *StringLiteral, *Boolean:
+		return true
+	case *GetExpression:
+		return isPure(expr.Object)
+	case *IndexExpression:
+		return isPure(expr.Left) && isPure(expr.Index)
+	case *PrefixExpression:
+		return isPure(expr.Right)
+	case *InfixExpression:
+		return isPure(expr.Left) && isPure(expr.Right)
+	}
+	return false
+}
+
+// literalValue builds the value of a number or string literal, the kind
+// tells which of the two it is and is empty for anything else
+func literalValue(expr Expression) (LigmaObject, string) {
+	switch expr := expr.(type) {
+	case *IntegerLiteral:
+		return NewInteger(expr.Value), "number"
+	case *FloatLiteral:
+		return NewFloat(expr.Value), "number"
+	case *StringLiteral:
+		return NewString(expr.Value), "str"
+	}
+	return nil, ""
+}
+
+func (l *Linter) VisitPipeExpression(pe *PipeExpression) LigmaObject {
+	l.lintExpression(pe.Left)
+	l.lintExpression(pe.Right)
+	return nil
+}
+
+func (l *Linter) VisitYieldExpression(ye *YieldExpression) LigmaObject {
+	l.lintExpression(ye.Value)
+	return nil
+}
+
+func (l *Linter) VisitIfExpression(ie *IfExpression) LigmaObject {
+	l.lintExpression(ie.Condition)
+	ie.Consequence.Accept(l)
+	if ie.Alternative != nil {
+		ie.Alternative.Accept(l)
+	}
+	return nil
+}
+
+func (l *Linter) VisitCallExpression(ce *CallExpression) LigmaObject {
+	l.lintExpression(ce.Function)
+	for _, arg := range ce.Arguments {
+		l.lintExpression(arg)
+	}
+	return nil
+}
+
+func (l *Linter) VisitIndexExpression(ie *IndexExpression) LigmaObject {
+	l.lintExpression(ie.Left)
+	l.lintExpression(ie.Index)
+	return nil
+}
+
+func (l *Linter) VisitAssignExpression(assign *AssignExpression) LigmaObject {
+	l.lintExpression(assign.Value)
+
+	if _, ok := l.lookup(assign.Name.Value); ok {
+		return nil
+	}
+	if _, ok := builtins[assign.Name.Value]; ok {
+		return nil
+	}
+	if _, ok := builtinsClasses[assign.Name.Value]; ok {
+		return nil
+	}
+
+	l.report(LintUndeclaredGlobal, assign.Name.Token, "assignment to undeclared variable %s creates a global, declare it with def", assign.Name.Value)
+	return nil
+}
+
+func (l *Linter) VisitIdentifier(ident *Identifier) LigmaObject {
+	if binding, ok := l.lookup(ident.Value); ok {
+		binding.used = true
+	}
+	return nil
+}
+
+func (l *Linter) VisitIntegerLiteral(il *IntegerLiteral) LigmaObject {
+	return nil
+}
+
+func (l *Linter) VisitFloatLiteral(fl *FloatLiteral) LigmaObject {
+	return nil
+}
+
+func (l *Linter) VisitBoolean(b *Boolean) LigmaObject {
+	return nil
+}
+
+func (l *Linter) VisitNull(n *Null) LigmaObject {
+	return nil
+}
+
+func (l *Linter) VisitStringLiteral(sl *StringLiteral) LigmaObject {
+	return nil
+}
+
+func (l *Linter) VisitFunctionLiteral(fl *FunctionLiteral) LigmaObject {
+	// a function nested in a method isn't part of the class
+	enclosingClass := l.currentClass
+	l.currentClass = ""
+	l.lintFunction(fl)
+	l.currentClass = enclosingClass
+	return nil
+}
+
+func (l *Linter) VisitListLiteral(ll *ListLiteral) LigmaObject {
+	for _, element := range ll.Elements {
+		l.lintExpression(element)
+	}
+	return nil
+}
+
+func (l *Linter) VisitTupleLiteral(tl *TupleLiteral) LigmaObject {
+	for _, element := range tl.Elements {
+		l.lintExpression(element)
+	}
+	return nil
+}
+
+func (l *Linter) VisitSetLiteral(sl *SetLiteral) LigmaObject {
+	for _, element := range sl.Elements {
+		l.lintExpression(element)
+	}
+	return nil
+}
+
+func (l *Linter) VisitMapLiteral(ml *MapLiteral) LigmaObject {
+	for key, value := range ml.Pairs {
+		l.lintExpression(key)
+		l.lintExpression(value)
+	}
+	return nil
+}
+
+func (l *Linter) VisitListComprehension(lc *ListComprehension) LigmaObject {
+	l.lintExpression(lc.Iterable)
+
+	l.beginScope()
+	for _, target := range lc.Targets {
+		l.declare(target, bind_TARGET)
+	}
+	l.lintExpression(lc.Condition)
+	l.lintExpression(lc.Element)
+	l.endScope()
+	return nil
+}
+
+func (l *Linter) VisitMapComprehension(mc *MapComprehension) LigmaObject {
+	l.lintExpression(mc.Iterable)
+
+	l.beginScope()
+	for _, target := range mc.Targets {
+		l.declare(target, bind_TARGET)
+	}
+	l.lintExpression(mc.Condition)
+	l.lintExpression(mc.Key)
+	l.lintExpression(mc.Value)
+	l.endScope()
+	return nil
+}
+
+func (l *Linter) VisitGetExpression(ge *GetExpression) LigmaObject {
+	l.lintExpression(ge.Object)
+	return nil
+}
+
+func (l *Linter) VisitSetExpression(se *SetExpression) LigmaObject {
+	l.lintExpression(se.Value)
+	l.lintExpression(se.Object)
+
+	if _, ok := se.Object.(*Self); !ok || l.currentClass == "" {
+		return nil
+	}
+
+	if l.inInit {
+		l.classFields[l.currentClass][se.Property.Value] = true
+		return nil
+	}
+
+	if !l.knowsField(l.currentClass, se.Property.Value) {
+		l.report(LintFieldOutsideInit, se.Property.Token, "field %s of %s is first assigned outside init", se.Property.Value, l.currentClass)
+	}
+	return nil
+}
+
+func (l *Linter) VisitSelfExpression(se *Self) LigmaObject {
+	return nil
+}
+
+func (l *Linter) VisitSuper(se *Super) LigmaObject {
+	return nil
+}
@@ -0,0 +1,99 @@
+package runtime_test
+
+import (
+	"reflect"
+	"testing"
+
+	"ligma/lexer"
+	"ligma/parser"
+	"ligma/runtime"
+)
+
+func TestLinter(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		disabled []string
+		expected []string
+	}{
+		{"clean code", `
+def total = 0
+def add = func(n) { total = total + n return total }
+class P {
+    def init = func(x) { self.x = x }
+    def move = func(dx) { self.x = self.x + dx }
+}
+`, nil, []string{}},
+		{"every rule", `
+def f = func(a, b) {
+    def unused = 1
+    def inner = func() { def b = 2 return b }
+    return inner()
+    print("dead")
+}
+def g = func() {
+    counter = 1
+    if (1 == 1) { return 1 }
+    return 0
+}
+class P {
+    def init = func() { self.x = 1 }
+    def move = func() { self.y = 2 self.x = 3 }
+}
+`, nil, []string{
+			"2:14: parameter a is never used [unused-parameter]",
+			"2:17: parameter b is never used [unused-parameter]",
+			"3:9: local variable unused is never used [unused-variable]",
+			"4:30: b shadows the variable declared at line 2 [shadow]",
+			"6:5: unreachable code [unreachable]",
+			"9:5: assignment to undeclared variable counter creates a global, declare it with def [undeclared-global]",
+			"10:11: comparison (1 == 1) is always true [always-true]",
+			"15:30: field y of P is first assigned outside init [field-outside-init]",
+		}},
+		{"disabled rules", `
+def f = func(a) {
+    def unused = 1
+    return 1
+}
+`, []string{runtime.LintUnusedParameter}, []string{
+			"3:9: local variable unused is never used [unused-variable]",
+		}},
+		{"suppression comments", `
+def h = func(n) {
+    def tmp = 1 # lint:ignore unused-variable
+    # lint:ignore
+    def other = 2
+    def kept = 3 # lint:ignore shadow
+    return n
+}
+`, nil, []string{
+			"6:9: local variable kept is never used [unused-variable]",
+		}},
+	}
+
+	for _, tt := range tests {
+		p := parser.New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			t.Fatalf("%s: parser errors: %v", tt.name, p.Errors())
+		}
+
+		linter := runtime.NewLinter()
+		if err := linter.Disable(tt.disabled...); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		diagnostics := []string{}
+		for _, d := range linter.Lint(program, tt.input) {
+			diagnostics = append(diagnostics, d.String())
+		}
+
+		if !reflect.DeepEqual(diagnostics, tt.expected) {
+			t.Errorf("%s: wrong diagnostics.\nexpected: %q\ngot:      %q", tt.name, tt.expected, diagnostics)
+		}
+	}
+
+	if err := runtime.NewLinter().Enable("nope"); err == nil {
+		t.Errorf("enabling an unknown rule should fail")
+	}
+}
@@ -0,0 +1,836 @@
+package runtime
+
+import (
+	"fmt"
+	"strconv"
+	"ligma/token"
+)
+
+// Optimizer rewrites a parsed program into one that does the same with less
+// work. It runs before the Resolver, the nodes it creates are resolved like
+// any other. It
+//   - folds arithmetic and comparisons on number and string literals
+//   - drops the branches of `if (true)`, `if (false)` and `while (false)`
+//     that can never run
+//   - inlines calls to top level functions whose body is a single simple
+//     return, when the arguments are literals or variables
+//   - builds the number and string literals used inside a loop once, in a
+//     variable declared right before the loop
+//
+// Assert conditions are left alone, their source text is part of the
+// failure message.
+type Optimizer struct {
+	// candidates holds the functions that can be inlined, inline those
+	// whose definition has already been passed. A call that comes earlier
+	// may run before the function exists
+	candidates map[string]*FunctionLiteral
+	inline     map[string]*FunctionLiteral
+
+	// literals counts the variables made for hoisted literals, their names
+	// start with $ so they can't clash with anything in the source
+	literals int
+}
+
+// NewOptimizer returns an optimizer
+func NewOptimizer() *Optimizer {
+	if builtinsClasses["int"] == nil {
+		DefineBuiltinTypes()
+	}
+
+	return &Optimizer{}
+}
+
+// Optimize rewrites program in place
+func (o *Optimizer) Optimize(program *Program) {
+	o.candidates = inlineCandidates(program.Statements)
+	o.inline = map[string]*FunctionLiteral{}
+	program.Statements = o.statements(program.Statements)
+}
+
+func (o *Optimizer) statements(stmts []Statement) []Statement {
+	optimized := []Statement{}
+
+	for _, stmt := range stmts {
+		stmt = o.statement(stmt)
+
+		switch loop := stmt.(type) {
+		case *WhileStatement:
+			optimized = append(optimized, o.hoistLiterals(loop.Body, &loop.Condition)...)
+		case *ForStatement:
+			optimized = append(optimized, o.hoistLiterals(loop.Body, nil)...)
+		}
+
+		optimized = append(optimized, stmt)
+
+		if def, ok := stmt.(*DefStatement); ok && o.candidates[def.Name.Value] == def.Value {
+			o.inline[def.Name.Value] = o.candidates[def.Name.Value]
+		}
+	}
+
+	return optimized
+}
+
+func (o *Optimizer) block(block *BlockStatement) {
+	if block != nil {
+		block.Statements = o.statements(block.Statements)
+	}
+}
+
+func (o *Optimizer) statement(stmt Statement) Statement {
+	switch stmt := stmt.(type) {
+	case *DefStatement:
+		stmt.Value = o.expression(stmt.Value)
+
+	case *UnpackStatement:
+		stmt.Value = o.expression(stmt.Value)
+
+	case *ReturnStatement:
+		stmt.ReturnValue = o.expression(stmt.ReturnValue)
+
+	case *ExpressionStatement:
+		stmt.Expression = o.expression(stmt.Expression)
+
+		ifExpr, ok := stmt.Expression.(*IfExpression)
+		if !ok {
+			break
+		}
+
+		condition, ok := ifExpr.Condition.(*Boolean)
+		if !ok {
+			break
+		}
+
+		// the block still gets a scope of its own, just like the branch did
+		if condition.Value {
+			return ifExpr.Consequence
+		}
+		if ifExpr.Alternative != nil {
+			return ifExpr.Alternative
+		}
+
+		// an if without a branch to run evaluates to null
+		tok := ifExpr.Token
+		tok.Type, tok.Literal = token.NULL, "null"
+		return &ExpressionStatement{Token: tok, Expression: &Null{Token: tok}}
+
+	case *BlockStatement:
+		o.block(stmt)
+
+	case *WhileStatement:
+		stmt.Condition = o.expression(stmt.Condition)
+		if condition, ok := stmt.Condition.(*Boolean); ok && !condition.Value {
+			return &BlockStatement{Token: stmt.Token}
+		}
+		o.block(stmt.Body)
+
+	case *ForStatement:
+		stmt.Iterable = o.expression(stmt.Iterable)
+		o.block(stmt.Body)
+
+	case *WithStatement:
+		stmt.Manager = o.expression(stmt.Manager)
+		o.block(stmt.Body)
+
+	case *Class:
+		for _, field := range stmt.Fields {
+			field.Value = o.expression(field.Value)
+		}
+		for _, method := range stmt.Methods {
+			o.expression(method.Value)
+		}
+		for _, accessor := range append(append([]*DefStatement{}, stmt.Getters...), stmt.Setters...) {
+			o.expression(accessor.Value)
+		}
+
+	case *EnumStatement:
+		for _, member := range stmt.Members {
+			member.Value = o.expression(member.Value)
+		}
+	}
+
+	return stmt
+}
+
+func (o *Optimizer) expressions(exprs []Expression) {
+	for idx, expr := range exprs {
+		exprs[idx] = o.expression(expr)
+	}
+}
+
+func (o *Optimizer) expression(expr Expression) Expression {
+	switch expr := expr.(type) {
+	case *PrefixExpression:
+		expr.Right = o.expression(expr.Right)
+		return foldPrefix(expr)
+
+	case *InfixExpression:
+		expr.Left = o.expression(expr.Left)
+		expr.Right = o.expression(expr.Right)
+		return foldInfix(expr)
+
+	case *PipeExpression:
+		expr.Left = o.expression(expr.Left)
+		expr.Right = o.expression(expr.Right)
+
+	case *YieldExpression:
+		expr.Value = o.expression(expr.Value)
+
+	case *IfExpression:
+		expr.Condition = o.expression(expr.Condition)
+		o.block(expr.Consequence)
+		o.block(expr.Alternative)
+
+	case *CallExpression:
+		expr.Function = o.expression(expr.Function)
+		o.expressions(expr.Arguments)
+		if inlined := o.inlineCall(expr); inlined != nil {
+			return fold(inlined)
+		}
+
+	case *IndexExpression:
+		expr.Left = o.expression(expr.Left)
+		expr.Index = o.expression(expr.Index)
+
+	case *AssignExpression:
+		expr.Value = o.expression(expr.Value)
+
+	case *GetExpression:
+		expr.Object = o.expression(expr.Object)
+
+	case *SetExpression:
+		expr.Object = o.expression(expr.Object)
+		expr.Value = o.expression(expr.Value)
+
+	case *FunctionLiteral:
+		o.block(expr.Body)
+
+	case *ListLiteral:
+		o.expressions(expr.Elements)
+	case *TupleLiteral:
+		o.expressions(expr.Elements)
+	case *SetLiteral:
+		o.expressions(expr.Elements)
+
+	case *MapLiteral:
+		pairs := map[Expression]Expression{}
+		for key, value := range expr.Pairs {
+			pairs[o.expression(key)] = o.expression(value)
+		}
+		expr.Pairs = pairs
+
+	case *ListComprehension:
+		expr.Iterable = o.expression(expr.Iterable)
+		expr.Condition = o.expression(expr.Condition)
+		expr.Element = o.expression(expr.Element)
+
+	case *MapComprehension:
+		expr.Iterable = o.expression(expr.Iterable)
+		expr.Condition = o.expression(expr.Condition)
+		expr.Key = o.expression(expr.Key)
+		expr.Value = o.expression(expr.Value)
+	}
+
+	return expr
+}
+
+// fold folds the operators at the top of an expression built by inlining
+func fold(expr Expression) Expression {
+	switch expr := expr.(type) {
+	case *PrefixExpression:
+		expr.Right = fold(expr.Right)
+		return foldPrefix(expr)
+	case *InfixExpression:
+		expr.Left = fold(expr.Left)
+		expr.Right = fold(expr.Right)
+		return foldInfix(expr)
+	}
+	return expr
+}
+
+// foldPrefix folds `!` on boolean and null literals. `-` is left alone,
+// the interpreter doesn't negate int and float instances
+func foldPrefix(pe *PrefixExpression) Expression {
+	if pe.Operator != "!" {
+		return pe
+	}
+
+	switch right := pe.Right.(type) {
+	case *Boolean:
+		return booleanLiteral(pe.Token, !right.Value)
+	case *Null:
+		return booleanLiteral(pe.Token, true)
+	}
+	return pe
+}
+
+// operators that are folded for each kind of literal, see literalValue
+var foldableOperators = map[string]map[string]bool{
+	"number": {"+": true, "-": true, "*": true, "/": true, "%": true, "<": true, ">": true, "<=": true, ">=": true, "==": true, "!=": true},
+	"str":    {"+": true, "==": true},
+}
+
+// foldInfix computes an operator on two literals the way the interpreter
+// would and replaces it with a literal of the result
+func foldInfix(ie *InfixExpression) Expression {
+	if left, ok := ie.Left.(*Boolean); ok {
+		if right, ok := ie.Right.(*Boolean); ok {
+			switch ie.Operator {
+			case "and":
+				return booleanLiteral(ie.Token, left.Value && right.Value)
+			case "or":
+				return booleanLiteral(ie.Token, left.Value || right.Value)
+			}
+		}
+		return ie
+	}
+
+	left, leftKind := literalValue(ie.Left)
+	right, rightKind := literalValue(ie.Right)
+	if leftKind == "" || leftKind != rightKind || !foldableOperators[leftKind][ie.Operator] {
+		return ie
+	}
+
+	// leave the runtime to report division by zero
+	if (ie.Operator == "/" || ie.Operator == "%") && isZeroLiteral(ie.Right) {
+		return ie
+	}
+
+	result := EvalInfixExpression(ie.Operator, left, right)
+
+	switch result := result.(type) {
+	case *LigmaBoolean:
+		return booleanLiteral(ie.Token, result.Value)
+	case *LigmaInstance:
+		tok := ie.Token
+		switch value := result.Fields["value"].(type) {
+		case *LigmaInteger:
+			tok.Type, tok.Literal = token.INT, strconv.FormatInt(value.Value, 10)
+			return &IntegerLiteral{Token: tok, Value: value.Value}
+		case *LigmaFloat:
+			tok.Type, tok.Literal = token.FLOAT, value.Inspect()
+			return &FloatLiteral{Token: tok, Value: value.Value}
+		case *LigmaString:
+			tok.Type, tok.Literal = token.STRING, value.Value
+			return &StringLiteral{Token: tok, Value: value.Value}
+		}
+	}
+	return ie
+}
+
+// isZeroLiteral reports whether expr is a number literal that truncates to zero,
+// % on floats works on the truncated values
+func isZeroLiteral(expr Expression) bool {
+	switch expr := expr.(type) {
+	case *IntegerLiteral:
+		return expr.Value == 0
+	case *FloatLiteral:
+		return int64(expr.Value) == 0
+	}
+	return false
+}
+
+func booleanLiteral(tok token.Token, value bool) *Boolean {
+	tok.Type, tok.Literal = token.FALSE, "false"
+	if value {
+		tok.Type, tok.Literal = token.TRUE, "true"
+	}
+	return &Boolean{Token: tok, Value: value}
+}
+
+// hoistLiterals replaces the number and string literals in a loop with
+// variables and returns their declarations, to go right before the loop.
+// condition is the loop condition for while loops
+func (o *Optimizer) hoistLiterals(body *BlockStatement, condition *Expression) []Statement {
+	h := &literalHoister{optimizer: o, names: map[string]*Identifier{}}
+
+	if condition != nil {
+		*condition = h.expression(*condition)
+	}
+	for _, stmt := range body.Statements {
+		h.statement(stmt)
+	}
+
+	return h.defs
+}
+
+type literalHoister struct {
+	optimizer *Optimizer
+
+	// names maps the source text of a literal to the variable holding it
+	names map[string]*Identifier
+	defs  []Statement
+}
+
+// variable returns a fresh identifier for the hoisted literal, declaring it on first use
+func (h *literalHoister) variable(literal Expression, tok token.Token) Expression {
+	key := fmt.Sprintf("%T %s", literal, literal.String())
+
+	name, ok := h.names[key]
+	if !ok {
+		tok.Type, tok.Literal = token.IDENT, fmt.Sprintf("$lit%d", h.optimizer.literals)
+		h.optimizer.literals++
+
+		name = &Identifier{Token: tok, Value: tok.Literal}
+		h.names[key] = name
+
+		def := tok
+		def.Type, def.Literal = token.DEF, "def"
+		h.defs = append(h.defs, &DefStatement{Token: def, Name: name, Value: literal})
+	}
+
+	// every reference needs an identifier of its own for the resolver
+	return &Identifier{Token: name.Token, Value: name.Value}
+}
+
+// statement hoists the literals of a statement in the loop body. Nested
+// functions and classes aren't part of the loop, assert conditions have to
+// keep their source text
+func (h *literalHoister) statement(stmt Statement) {
+	switch stmt := stmt.(type) {
+	case *DefStatement:
+		if _, ok := stmt.Value.(*FunctionLiteral); !ok {
+			stmt.Value = h.expression(stmt.Value)
+		}
+	case *UnpackStatement:
+		stmt.Value = h.expression(stmt.Value)
+	case *ReturnStatement:
+		stmt.ReturnValue = h.expression(stmt.ReturnValue)
+	case *ExpressionStatement:
+		stmt.Expression = h.expression(stmt.Expression)
+	case *BlockStatement:
+		for _, s := range stmt.Statements {
+			h.statement(s)
+		}
+	case *WhileStatement:
+		stmt.Condition = h.expression(stmt.Condition)
+		h.statement(stmt.Body)
+	case *ForStatement:
+		stmt.Iterable = h.expression(stmt.Iterable)
+		h.statement(stmt.Body)
+	case *WithStatement:
+		stmt.Manager = h.expression(stmt.Manager)
+		h.statement(stmt.Body)
+	}
+}
+
+func (h *literalHoister) expressions(exprs []Expression) {
+	for idx, expr := range exprs {
+		exprs[idx] = h.expression(expr)
+	}
+}
+
+func (h *literalHoister) expression(expr Expression) Expression {
+	switch expr := expr.(type) {
+	case *IntegerLiteral:
+		return h.variable(expr, expr.Token)
+	case *FloatLiteral:
+		return h.variable(expr, expr.Token)
+	case *StringLiteral:
+		return h.variable(expr, expr.Token)
+
+	case *PrefixExpression:
+		expr.Right = h.expression(expr.Right)
+	case *InfixExpression:
+		expr.Left = h.expression(expr.Left)
+		expr.Right = h.expression(expr.Right)
+	case *PipeExpression:
+		expr.Left = h.expression(expr.Left)
+		expr.Right = h.expression(expr.Right)
+	case *YieldExpression:
+		expr.Value = h.expression(expr.Value)
+	case *IfExpression:
+		expr.Condition = h.expression(expr.Condition)
+		h.statement(expr.Consequence)
+		if expr.Alternative != nil {
+			h.statement(expr.Alternative)
+		}
+	case *CallExpression:
+		expr.Function = h.expression(expr.Function)
+		h.expressions(expr.Arguments)
+	case *IndexExpression:
+		expr.Left = h.expression(expr.Left)
+		expr.Index = h.expression(expr.Index)
+	case *AssignExpression:
+		expr.Value = h.expression(expr.Value)
+	case *GetExpression:
+		expr.Object = h.expression(expr.Object)
+	case *SetExpression:
+		expr.Object = h.expression(expr.Object)
+		expr.Value = h.expression(expr.Value)
+	case *ListLiteral:
+		h.expressions(expr.Elements)
+	case *TupleLiteral:
+		h.expressions(expr.Elements)
+	case *SetLiteral:
+		h.expressions(expr.Elements)
+	case *MapLiteral:
+		pairs := map[Expression]Expression{}
+		for key, value := range expr.Pairs {
+			pairs[h.expression(key)] = h.expression(value)
+		}
+		expr.Pairs = pairs
+	case *ListComprehension:
+		expr.Iterable = h.expression(expr.Iterable)
+		expr.Condition = h.expression(expr.Condition)
+		expr.Element = h.expression(expr.Element)
+	case *MapComprehension:
+		expr.Iterable = h.expression(expr.Iterable)
+		expr.Condition = h.expression(expr.Condition)
+		expr.Key = h.expression(expr.Key)
+		expr.Value = h.expression(expr.Value)
+	}
+
+	return expr
+}
+
+// inlineCall returns the body of the function a call goes to with the
+// arguments put in for the parameters, or nil when the call can't be inlined.
+// The arguments are evaluated before the body runs, so they have to be
+// literals, or variables when the body makes no calls that could change
+// them. A simple expression stops at its first error, so a variable that
+// can't be looked up is reported once however often the body uses it, but
+// it has to be used at all
+func (o *Optimizer) inlineCall(call *CallExpression) Expression {
+	name, ok := call.Function.(*Identifier)
+	if !ok {
+		return nil
+	}
+
+	fn, ok := o.inline[name.Value]
+	if !ok || len(call.Arguments) != len(fn.Parameters) {
+		return nil
+	}
+
+	body := fn.Body.Statements[0].(*ReturnStatement).ReturnValue
+	uses := map[string]int{}
+	hasCall := false
+	inspectSimple(body, func(expr Expression) {
+		switch expr := expr.(type) {
+		case *Identifier:
+			uses[expr.Value]++
+		case *CallExpression:
+			hasCall = true
+		}
+	})
+
+	args := map[string]Expression{}
+	for idx, param := range fn.Parameters {
+		switch call.Arguments[idx].(type) {
+		case *IntegerLiteral, *FloatLiteral, *StringLiteral, *Boolean, *Null:
+		case *Identifier:
+			if hasCall || uses[param.Value] == 0 {
+				return nil
+			}
+		default:
+			return nil
+		}
+		args[param.Value] = call.Arguments[idx]
+	}
+
+	return substitute(body, args)
+}
+
+// simple expressions are the ones allowed in the body of an inlined function
+func isSimple(expr Expression) bool {
+	simple := true
+	inspectSimple(expr, func(e Expression) {
+		if e == nil {
+			simple = false
+		}
+	})
+	return simple
+}
+
+// inspectSimple calls fn for every node of a simple expression, and with nil
+// for anything that isn't simple
+func inspectSimple(expr Expression, fn func(Expression)) {
+	switch e := expr.(type) {
+	case *Identifier, *IntegerLiteral, *FloatLiteral, *StringLiteral, *Boolean, *Null:
+		fn(e)
+	case *PrefixExpression:
+		fn(e)
+		inspectSimple(e.Right, fn)
+	case *InfixExpression:
+		fn(e)
+		inspectSimple(e.Left, fn)
+		inspectSimple(e.Right, fn)
+	case *GetExpression:
+		fn(e)
+		inspectSimple(e.Object, fn)
+	case *IndexExpression:
+		fn(e)
+		inspectSimple(e.Left, fn)
+		inspectSimple(e.Index, fn)
+	case *CallExpression:
+		fn(e)
+		inspectSimple(e.Function, fn)
+		for _, arg := range e.Arguments {
+			inspectSimple(arg, fn)
+		}
+	default:
+		fn(nil)
+	}
+}
+
+// substitute copies a simple expression, replacing the identifiers in args
+// with copies of their values. Every node is new so the resolver can tell
+// the copies apart
+func substitute(expr Expression, args map[string]Expression) Expression {
+	switch e := expr.(type) {
+	case *Identifier:
+		if arg, ok := args[e.Value]; ok {
+			return substitute(arg, nil)
+		}
+		copied := *e
+		return &copied
+	case *IntegerLiteral:
+		copied := *e
+		return &copied
+	case *FloatLiteral:
+		copied := *e
+		return &copied
+	case *StringLiteral:
+		copied := *e
+		return &copied
+	case *Boolean:
+		copied := *e
+		return &copied
+	case *Null:
+		copied := *e
+		return &copied
+	case *PrefixExpression:
+		return &PrefixExpression{Token: e.Token, Operator: e.Operator, Right: substitute(e.Right, args)}
+	case *InfixExpression:
+		return &InfixExpression{Token: e.Token, Left: substitute(e.Left, args), Operator: e.Operator, Right: substitute(e.Right, args)}
+	case *GetExpression:
+		return &GetExpression{Token: e.Token, Object: substitute(e.Object, args), Property: e.Property}
+	case *IndexExpression:
+		return &IndexExpression{Token: e.Token, Left: substitute(e.Left, args), Index: substitute(e.Index, args)}
+	case *CallExpression:
+		arguments := []Expression{}
+		for _, arg := range e.Arguments {
+			arguments = append(arguments, substitute(arg, args))
+		}
+		return &CallExpression{Token: e.Token, Function: substitute(e.Function, args), Arguments: arguments}
+	}
+	return expr
+}
+
+// inlineCandidates finds the top level functions that can be inlined: their
+// body is a single return of a simple expression, they aren't generators or
+// annotated (the annotations are checked on calls) and neither the function
+// nor the globals its body uses are ever bound to anything else
+func inlineCandidates(stmts []Statement) map[string]*FunctionLiteral {
+	bindings := &bindingCounter{top: map[string]int{}, nested: map[string]bool{}}
+	for _, stmt := range stmts {
+		bindings.topLevel(stmt)
+	}
+
+	candidates := map[string]*FunctionLiteral{}
+
+	for _, stmt := range stmts {
+		def, ok := stmt.(*DefStatement)
+		if !ok || bindings.top[def.Name.Value] != 1 || bindings.nested[def.Name.Value] {
+			continue
+		}
+
+		fn, ok := def.Value.(*FunctionLiteral)
+		if !ok || fn.IsGenerator || fn.ReturnType != nil || len(fn.Body.Statements) != 1 {
+			continue
+		}
+
+		ret, ok := fn.Body.Statements[0].(*ReturnStatement)
+		if !ok || !isSimple(ret.ReturnValue) {
+			continue
+		}
+
+		params := map[string]bool{}
+		for _, param := range fn.Parameters {
+			if param.Type != nil || params[param.Value] {
+				params = nil
+				break
+			}
+			params[param.Value] = true
+		}
+		if params == nil {
+			continue
+		}
+
+		// the globals the body uses must mean the same at every call site
+		usable := true
+		inspectSimple(ret.ReturnValue, func(expr Expression) {
+			if ident, ok := expr.(*Identifier); ok && !params[ident.Value] {
+				if ident.Value == def.Name.Value || bindings.nested[ident.Value] {
+					usable = false
+				}
+			}
+		})
+
+		if usable {
+			candidates[def.Name.Value] = fn
+		}
+	}
+
+	return candidates
+}
+
+// bindingCounter counts how often each name is bound at the top level and
+// remembers the names bound anywhere else or assigned to
+type bindingCounter struct {
+	top    map[string]int
+	nested map[string]bool
+}
+
+func (b *bindingCounter) topLevel(stmt Statement) {
+	switch stmt := stmt.(type) {
+	case *DefStatement:
+		b.top[stmt.Name.Value]++
+		b.expression(stmt.Value)
+	case *UnpackStatement:
+		for _, target := range stmt.Targets {
+			b.top[target.Value]++
+		}
+		b.expression(stmt.Value)
+	case *Class:
+		b.top[stmt.Name.Value]++
+		b.statement(stmt)
+	case *EnumStatement:
+		b.top[stmt.Name.Value]++
+		b.statement(stmt)
+	case *RecordStatement:
+		b.top[stmt.Name.Value]++
+	case *InterfaceStatement:
+		b.top[stmt.Name.Value]++
+	default:
+		b.statement(stmt)
+	}
+}
+
+func (b *bindingCounter) bind(names ...*Identifier) {
+	for _, name := range names {
+		if name != nil {
+			b.nested[name.Value] = true
+		}
+	}
+}
+
+func (b *bindingCounter) block(block *BlockStatement) {
+	if block == nil {
+		return
+	}
+	for _, stmt := range block.Statements {
+		b.statement(stmt)
+	}
+}
+
+func (b *bindingCounter) statement(stmt Statement) {
+	switch stmt := stmt.(type) {
+	case *DefStatement:
+		b.bind(stmt.Name)
+		b.expression(stmt.Value)
+	case *UnpackStatement:
+		b.bind(stmt.Targets...)
+		b.expression(stmt.Value)
+	case *ReturnStatement:
+		b.expression(stmt.ReturnValue)
+	case *ExpressionStatement:
+		b.expression(stmt.Expression)
+	case *AssertStatement:
+		b.expression(stmt.Condition)
+		b.expression(stmt.Message)
+	case *BlockStatement:
+		b.block(stmt)
+	case *WhileStatement:
+		b.expression(stmt.Condition)
+		b.block(stmt.Body)
+	case *ForStatement:
+		b.bind(stmt.Targets...)
+		b.expression(stmt.Iterable)
+		b.block(stmt.Body)
+	case *WithStatement:
+		b.bind(stmt.Name)
+		b.expression(stmt.Manager)
+		b.block(stmt.Body)
+	case *Class:
+		b.bind(stmt.Name)
+		for _, field := range stmt.Fields {
+			b.expression(field.Value)
+		}
+		for _, method := range append(append(append([]*DefStatement{}, stmt.Methods...), stmt.Getters...), stmt.Setters...) {
+			b.expression(method.Value)
+		}
+	case *EnumStatement:
+		b.bind(stmt.Name)
+		for _, member := range stmt.Members {
+			b.expression(member.Value)
+		}
+	case *RecordStatement:
+		b.bind(stmt.Name)
+	case *InterfaceStatement:
+		b.bind(stmt.Name)
+	}
+}
+
+func (b *bindingCounter) expressions(exprs []Expression) {
+	for _, expr := range exprs {
+		b.expression(expr)
+	}
+}
+
+func (b *bindingCounter) expression(expr Expression) {
+	switch expr := expr.(type) {
+	case *AssignExpression:
+		b.bind(expr.Name)
+		b.expression(expr.Value)
+	case *FunctionLiteral:
+		b.bind(expr.Parameters...)
+		b.block(expr.Body)
+	case *PrefixExpression:
+		b.expression(expr.Right)
+	case *InfixExpression:
+		b.expression(expr.Left)
+		b.expression(expr.Right)
+	case *PipeExpression:
+		b.expression(expr.Left)
+		b.expression(expr.Right)
+	case *YieldExpression:
+		b.expression(expr.Value)
+	case *IfExpression:
+		b.expression(expr.Condition)
+		b.block(expr.Consequence)
+		b.block(expr.Alternative)
+	case *CallExpression:
+		b.expression(expr.Function)
+		b.expressions(expr.Arguments)
+	case *IndexExpression:
+		b.expression(expr.Left)
+		b.expression(expr.Index)
+	case *GetExpression:
+		b.expression(expr.Object)
+	case *SetExpression:
+		b.expression(expr.Object)
+		b.expression(expr.Value)
+	case *ListLiteral:
+		b.expressions(expr.Elements)
+	case *TupleLiteral:
+		b.expressions(expr.Elements)
+	case *SetLiteral:
+		b.expressions(expr.Elements)
+	case *MapLiteral:
+		for key, value := range expr.Pairs {
+			b.expression(key)
+			b.expression(value)
+		}
+	case *ListComprehension:
+		b.bind(expr.Targets...)
+		b.expression(expr.Iterable)
+		b.expression(expr.Condition)
+		b.expression(expr.Element)
+	case *MapComprehension:
+		b.bind(expr.Targets...)
+		b.expression(expr.Iterable)
+		b.expression(expr.Condition)
+		b.expression(expr.Key)
+		b.expression(expr.Value)
+	}
+}
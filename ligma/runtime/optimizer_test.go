@@ -0,0 +1,102 @@
+package runtime_test
+
+import (
+	"bytes"
+	"testing"
+
+	"ligma/lexer"
+	"ligma/parser"
+	"ligma/runtime"
+)
+
+// run interprets input and returns what it printed along with the program
+// that was run
+func run(t *testing.T, input string, optimize bool) (string, string) {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+
+	if optimize {
+		runtime.NewOptimizer().Optimize(program)
+	}
+
+	var out bytes.Buffer
+	previous := runtime.Output
+	runtime.Output = &out
+	defer func() { runtime.Output = previous }()
+
+	i := runtime.NewInterpreter()
+	if diagnostics := runtime.NewResolver(i).Resolve(program.Statements); len(diagnostics) != 0 {
+		t.Fatalf("resolver diagnostics: %v", diagnostics)
+	}
+	i.Interpret(program)
+
+	return out.String(), program.String()
+}
+
+func TestOptimizerKeepsOutput(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"folding", `
+			print(2 * 3 + 4, 7 / 2, 7 % 3, 1.5 * 2, "a" + "b")
+			if (1 < 2) { print("lt") }
+			if ("a" == "b") { print("eq") } else { print("ne") }
+			print(1 / 0)
+		`},
+		{"dead branches", `
+			def x = 1
+			if (true) { def x = 2 print(x) } else { print("never") }
+			if (false) { print("never") }
+			while (false) { print("never") }
+			if (!false) { print(x) }
+		`},
+		{"inlining", `
+			def K = 10
+			def sq = func(x) { return x * x }
+			def scale = func(x) { return x * K }
+			def both = func(a, b) { return sq(a) + b }
+			def n = 4
+			print(sq(3), sq(n), scale(2.5), both(2, 3))
+			def f = func(sq) { return sq }
+			print(f(1))
+			print(sq("a"))
+		`},
+		{"too early to inline", `
+			def early = func() { return twice(2) }
+			def twice = func(x) { return x * 2 }
+			print(early(), twice(5))
+		`},
+		{"hoisting", `
+			def i = 0
+			def total = 0
+			while (i < 5) {
+				total = total + i * 100
+				i = i + 1
+				for (s in ["a", "b"]) { print(s + "!", 1.5) }
+			}
+			print(total)
+			def repeat = func(n) {
+				def acc = ""
+				while (n > 0) { acc = acc + "ab" n = n - 1 }
+				return acc
+			}
+			print(repeat(3))
+		`},
+	}
+
+	for _, tt := range tests {
+		plain, before := run(t, tt.input, false)
+		optimized, after := run(t, tt.input, true)
+
+		if before == after {
+			t.Errorf("%s: program was not optimized", tt.name)
+		}
+		if plain != optimized {
+			t.Errorf("%s: output differs.\nwithout optimization:\n%s\nwith optimization:\n%s", tt.name, plain, optimized)
+		}
+	}
+}
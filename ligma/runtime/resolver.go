@@ -1,6 +1,8 @@
 package runtime
 
-import "os"
+import (
+	"ligma/token"
+)
 
 // Function types
 const (
@@ -19,37 +21,141 @@ const (
 	cls_SUBCLASS
 )
 
-const ( // condition types
-	_ int = iota
-	con_NONE
-	con_WHILE
-	con_IF
-)
-
 
 type Resolver struct {
 	interpreter *Interpreter
 	// scopes is a stack of maps, where each map represents a scope
 	scopes []map[string]bool
+	// slots numbers the names of each scope in the order they are declared,
+	// the interpreter keeps the locals of a scope in an array in that order
+	slots []map[string]int
+	// constants marks the names of each scope bound with const,
+	// globalConstants those of the global scope
+	constants []map[string]bool
+	globalConstants map[string]bool
 
 	currentFunction int
 	currentClass int
-	currentCon int
+
+	// tailCalls tells whether a returned call can be made after the current
+	// function returned: not in a generator, and not in a for or with body
+	// that has to clean up after the return
+	tailCalls bool
+
+	// globals holds the names bound at the top level by the code resolved so
+	// far, builtins are looked up separately
+	globals map[string]bool
+
+	// diagnostics collects the problems found by the current call to Resolve
+	diagnostics []Diagnostic
 }
 
 func NewResolver(interpreter *Interpreter) *Resolver {
 	currentFunction := ft_NONE
 	currentClass := cls_NONE
-	currentCon := con_NONE
-	return &Resolver{interpreter: interpreter, scopes: []map[string]bool{}, currentFunction: currentFunction, currentClass: currentClass, currentCon: currentCon}
+	return &Resolver{interpreter: interpreter, scopes: []map[string]bool{}, globalConstants: map[string]bool{}, globals: map[string]bool{}, currentFunction: currentFunction, currentClass: currentClass}
 }
 
-func (r *Resolver) Resolve(stmts []Statement) {
+// Resolve resolves the variables of a program and returns the problems it
+// found, the program should not be interpreted unless there are none.
+// The resolver keeps its state between calls so a REPL can feed it line by line
+func (r *Resolver) Resolve(stmts []Statement) []Diagnostic {
+	r.diagnostics = nil
+
+	// code that is rejected never runs, so it doesn't define anything
+	globals, constants := copyNames(r.globals), copyNames(r.globalConstants)
+
+	r.declareGlobals(stmts)
+	r.resolveStatements(stmts)
+
+	if len(r.diagnostics) != 0 {
+		r.globals, r.globalConstants = globals, constants
+	}
+
+	return r.diagnostics
+}
+
+func copyNames(names map[string]bool) map[string]bool {
+	copied := make(map[string]bool, len(names))
+	for name, value := range names {
+		copied[name] = value
+	}
+	return copied
+}
+
+// declareGlobals records the names the top level statements bind before
+// resolving them, functions can refer to globals defined further down
+func (r *Resolver) declareGlobals(stmts []Statement) {
+	names := []*Identifier{}
+	for _, stmt := range stmts {
+		switch stmt := stmt.(type) {
+		case *DefStatement:
+			names = append(names, stmt.Name)
+		case *UnpackStatement:
+			names = append(names, stmt.Targets...)
+		case *Class:
+			names = append(names, stmt.Name)
+		case *EnumStatement:
+			names = append(names, stmt.Name)
+		case *RecordStatement:
+			names = append(names, stmt.Name)
+		case *InterfaceStatement:
+			names = append(names, stmt.Name)
+		}
+	}
+
+	for _, name := range names {
+		r.globals[name.Value] = true
+	}
+}
+
+// isGlobal reports whether name is a builtin or bound at the top level
+func (r *Resolver) isGlobal(name string) bool {
+	if _, ok := builtins[name]; ok {
+		return true
+	}
+	if _, ok := builtinsClasses[name]; ok {
+		return true
+	}
+	return r.globals[name]
+}
+
+// undefined reports a name that is neither local nor global, suggesting
+// the closest visible name
+func (r *Resolver) undefined(ident *Identifier) {
+	candidates := []string{}
+	for _, scope := range r.scopes {
+		for name := range scope {
+			candidates = append(candidates, name)
+		}
+	}
+	for name := range r.globals {
+		candidates = append(candidates, name)
+	}
+	for name := range builtins {
+		candidates = append(candidates, name)
+	}
+	for name := range builtinsClasses {
+		candidates = append(candidates, name)
+	}
+
+	if suggestion := suggestName(ident.Value, candidates); suggestion != "" {
+		r.errorAt(ident.Token, "Undefined variable %s, did you mean %s?", ident.Value, suggestion)
+		return
+	}
+	r.errorAt(ident.Token, "Undefined variable %s.", ident.Value)
+}
+
+func (r *Resolver) resolveStatements(stmts []Statement) {
 	for _, stmt := range stmts {
 		r.resolveStatement(stmt)
 	}
 }
 
+func (r *Resolver) errorAt(tok token.Token, format string, a ...interface{}) {
+	r.diagnostics = append(r.diagnostics, newDiagnostic(tok, format, a...))
+}
+
 func (r *Resolver) resolveStatement(stmt Statement) {
 	stmt.Accept(r)
 }
@@ -60,10 +166,14 @@ func (r *Resolver) resolveExpression(expr Expression) {
 
 func (r *Resolver) beginScope() {
 	r.scopes = append(r.scopes, make(map[string]bool))
+	r.slots = append(r.slots, make(map[string]int))
+	r.constants = append(r.constants, make(map[string]bool))
 }
 
 func (r *Resolver) endScope() {
 	r.scopes = r.scopes[:len(r.scopes)-1]
+	r.slots = r.slots[:len(r.slots)-1]
+	r.constants = r.constants[:len(r.constants)-1]
 }
 
 func (r *Resolver) declare(name *Identifier) {
@@ -72,10 +182,7 @@ func (r *Resolver) declare(name *Identifier) {
 	}
 
 	if _, ok := r.scopes[len(r.scopes)-1][name.Value]; ok {
-		NewError("Variable with this name already declared in this scope.")
-		println("Variable with this name already declared in this scope.")
-		println("Please come up with a better error handling mechanism.")
-		os.Exit(1)
+		r.errorAt(name.Token, "Variable %s already declared in this scope.", name.Value)
 	}
 
 	// print scope
@@ -84,6 +191,19 @@ func (r *Resolver) declare(name *Identifier) {
 	 } */
 
 	r.scopes[len(r.scopes)-1][name.Value] = false
+	r.interpreter.Resolve(name, 0, r.slot(name.Value))
+}
+
+// slot returns the slot of name in the innermost scope, giving it the next
+// free one if it has none yet
+func (r *Resolver) slot(name string) int {
+	slots := r.slots[len(r.slots)-1]
+	if slot, ok := slots[name]; ok {
+		return slot
+	}
+
+	slots[name] = len(slots)
+	return slots[name]
 }
 
 func (r *Resolver) define(name *Identifier) {
@@ -94,25 +214,60 @@ func (r *Resolver) define(name *Identifier) {
 	r.scopes[len(r.scopes)-1][name.Value] = true
 }
 
-func (r *Resolver) resolveLocal(expr Expression, name string) {
+// isConstant reports whether name, as seen from the current scope, is bound with const
+func (r *Resolver) isConstant(name string) bool {
+	for i := len(r.scopes) - 1; i >= 0; i-- {
+		if _, ok := r.scopes[i][name]; ok {
+			return r.constants[i][name]
+		}
+	}
+	return r.globalConstants[name]
+}
+
+// checkRedefinition refuses to bind name again in the scope where it is a constant
+func (r *Resolver) checkRedefinition(name *Identifier) {
+	constant := r.globalConstants[name.Value]
+	if len(r.scopes) > 0 {
+		constant = r.constants[len(r.constants)-1][name.Value]
+	}
+
+	if constant {
+		r.errorAt(name.Token, "Can't redefine constant %s.", name.Value)
+	}
+}
+
+// markConstant records that name is bound with const in the current scope
+func (r *Resolver) markConstant(name *Identifier) {
+	if len(r.scopes) == 0 {
+		r.globalConstants[name.Value] = true
+		return
+	}
+	r.constants[len(r.constants)-1][name.Value] = true
+}
+
+// resolveLocal records the depth of the scope declaring name, it reports
+// whether there is one. Names that aren't found are global
+func (r *Resolver) resolveLocal(expr Expression, name string) bool {
 
 	for i := len(r.scopes) - 1; i >= 0; i-- {
 		if _, ok := r.scopes[i][name]; ok {
-			r.interpreter.Resolve(expr, len(r.scopes)-1-i)
-			return 
+			r.interpreter.Resolve(expr, len(r.scopes)-1-i, r.slots[i][name])
+			return true
 		}
 	}
 
+	return false
 }
 
 func (r *Resolver) VisitBlockStatement(block *BlockStatement) LigmaObject {
 	r.beginScope()
-	r.Resolve(block.Statements)
+	r.resolveStatements(block.Statements)
 	r.endScope()
 	return nil
 }
 
 func (r *Resolver) VisitDefStatement(def *DefStatement) LigmaObject {
+	r.checkRedefinition(def.Name)
 	r.declare(def.Name)
 
 	if def.Value != nil {
@@ -120,9 +275,28 @@ func (r *Resolver) VisitDefStatement(def *DefStatement) LigmaObject {
 	}
 
 	r.define(def.Name)
+	if def.Constant {
+		r.markConstant(def.Name)
+	}
 	return nil
 }
 
+func (r *Resolver) VisitUnpackStatement(us *UnpackStatement) LigmaObject {
+	for _, target := range us.Targets {
+		r.checkRedefinition(target)
+		r.declare(target)
+	}
+
+	r.resolveExpression(us.Value)
+
+	for _, target := range us.Targets {
+		r.define(target)
+		if us.Constant {
+			r.markConstant(target)
+		}
+	}
+	return nil
+}
 
 func (r *Resolver) VisitExpressionStatement(exprStmt *ExpressionStatement) LigmaObject {
 	r.resolveExpression(exprStmt.Expression)
@@ -131,7 +305,15 @@ func (r *Resolver) VisitExpressionStatement(exprStmt *ExpressionStatement) Ligma
 
 func (r *Resolver) VisitAssignExpression(assign *AssignExpression) LigmaObject {
 	r.resolveExpression(assign.Value)
-	r.resolveLocal(assign, assign.Name.Value)
+
+	if r.isConstant(assign.Name.Value) {
+		r.errorAt(assign.Name.Token, "Can't assign to constant %s.", assign.Name.Value)
+	}
+
+	// assigning a name that isn't declared anywhere creates a global
+	if !r.resolveLocal(assign, assign.Name.Value) {
+		r.globals[assign.Name.Value] = true
+	}
 	return nil
 }
 
@@ -142,8 +324,9 @@ func (r *Resolver) VisitFunctionLiteral(funcLit *FunctionLiteral) LigmaObject {
 }
 
 func (r *Resolver) resolveFunction(funcLit *FunctionLiteral, functionType int) {
-	enclosingFunction := r.currentFunction
+	enclosingFunction, enclosingTailCalls := r.currentFunction, r.tailCalls
 	r.currentFunction = functionType
+	r.tailCalls = !funcLit.IsGenerator
 
 	r.beginScope()
 	for _, param := range funcLit.Parameters {
@@ -151,16 +334,23 @@ func (r *Resolver) resolveFunction(funcLit *FunctionLiteral, functionType int) {
 		r.define(param)
 	}
 
-	r.Resolve(funcLit.Body.Statements)
+	r.resolveStatements(funcLit.Body.Statements)
 	r.endScope()
 
-	r.currentFunction = enclosingFunction
+	r.currentFunction, r.tailCalls = enclosingFunction, enclosingTailCalls
 }
 
 
 func (r *Resolver) VisitIdentifier(ident *Identifier) LigmaObject {
 
-	if (len(r.scopes) > 0 && !r.scopes[len(r.scopes)-1][ident.Value]) {
+	// only a name that is declared in the innermost scope but not yet defined
+	// is being read in its own initializer
+	defined, declared := false, false
+	if len(r.scopes) > 0 {
+		defined, declared = r.scopes[len(r.scopes)-1][ident.Value]
+	}
+
+	if declared && !defined {
 		// if its a built-in function, don't resolve it
 		if _, ok := builtins[ident.Value]; ok {
 			return nil
@@ -176,28 +366,18 @@ func (r *Resolver) VisitIdentifier(ident *Identifier) LigmaObject {
 			return nil
 		}
 
-		if r.currentCon == con_WHILE {
-			r.resolveLocal(ident, ident.Value)
-			return nil
-		}
-
-		if r.currentCon == con_IF {
-			r.resolveLocal(ident, ident.Value)
-			return nil
-		}
-		NewError("Can't read local variable in its own initializer.")
-		println("Can't read local variable in its own initializer.")
-		println("Please come up with a better error handling mechanism.")
-		os.Exit(1)
+		r.errorAt(ident.Token, "Can't read local variable %s in its own initializer.", ident.Value)
+		return nil
 	}
 
-	r.resolveLocal(ident, ident.Value)
+	if !r.resolveLocal(ident, ident.Value) && !r.isGlobal(ident.Value) {
+		r.undefined(ident)
+	}
 
 	return nil
 }
 
 func (r *Resolver) VisitIfExpression(ifExpr *IfExpression) LigmaObject {
-	r.currentCon = con_IF
 	r.resolveExpression(ifExpr.Condition)
 	r.resolveStatement(ifExpr.Consequence)
 
@@ -211,39 +391,100 @@ func (r *Resolver) VisitIfExpression(ifExpr *IfExpression) LigmaObject {
 func (r *Resolver) VisitReturnStatement(rs *ReturnStatement) LigmaObject {
 	
 	if r.currentFunction == ft_NONE {
-		NewError("Can't return from top-level code.")
-		println("Can't return from top-level code.")
-		println("Please come up with a better error handling mechanism.")
-		os.Exit(1)
+		r.errorAt(rs.Token, "Can't return from top-level code.")
 	}
 
 	if r.currentFunction == ft_INITIALIZER {
-		NewError("Can't return a value from an initializer.")
-		println("Can't return a value from an initializer.")
-		println("Please come up with a better error handling mechanism.")
-		os.Exit(1)
+		r.errorAt(rs.Token, "Can't return a value from an initializer.")
 	}
 	
 	if rs.ReturnValue != nil {
 		r.resolveExpression(rs.ReturnValue)
 	}
 
+	_, call := rs.ReturnValue.(*CallExpression)
+	rs.Tail = call && r.tailCalls
+
 	return nil
 }
 
 func (r *Resolver) VisitWhileStatement(ws *WhileStatement) LigmaObject {
-	r.currentCon = con_WHILE
 	r.resolveExpression(ws.Condition)
 	r.resolveStatement(ws.Body)
 	return nil
 }
 
+func (r *Resolver) VisitForStatement(fs *ForStatement) LigmaObject {
+	r.resolveExpression(fs.Iterable)
+
+	// the targets live in the same scope as the body
+	r.beginScope()
+	for _, target := range fs.Targets {
+		r.declare(target)
+		r.define(target)
+	}
+	tailCalls := r.tailCalls
+	r.tailCalls = false
+	r.resolveStatements(fs.Body.Statements)
+	r.tailCalls = tailCalls
+	r.endScope()
+
+	return nil
+}
+
+func (r *Resolver) VisitAssertStatement(as *AssertStatement) LigmaObject {
+	r.resolveExpression(as.Condition)
+	if as.Message != nil {
+		r.resolveExpression(as.Message)
+	}
+	return nil
+}
+
+func (r *Resolver) VisitWithStatement(ws *WithStatement) LigmaObject {
+	r.resolveExpression(ws.Manager)
+
+	// the 'as' binding lives in the same scope as the body
+	r.beginScope()
+	if ws.Name != nil {
+		r.declare(ws.Name)
+		r.define(ws.Name)
+	}
+	tailCalls := r.tailCalls
+	r.tailCalls = false
+	r.resolveStatements(ws.Body.Statements)
+	r.tailCalls = tailCalls
+	r.endScope()
+
+	return nil
+}
+
 func (r *Resolver) VisitInfixExpression(ie *InfixExpression) LigmaObject {
 	r.resolveExpression(ie.Left)
 	r.resolveExpression(ie.Right)
 	return nil
 }
 
+func (r *Resolver) VisitYieldExpression(ye *YieldExpression) LigmaObject {
+	if r.currentFunction == ft_NONE {
+		r.errorAt(ye.Token, "Can't yield from top-level code.")
+	}
+
+	if r.currentFunction == ft_INITIALIZER {
+		r.errorAt(ye.Token, "Can't yield from an initializer.")
+	}
+
+	if ye.Value != nil {
+		r.resolveExpression(ye.Value)
+	}
+	return nil
+}
+
+func (r *Resolver) VisitPipeExpression(pe *PipeExpression) LigmaObject {
+	r.resolveExpression(pe.Left)
+	r.resolveExpression(pe.Right)
+	return nil
+}
+
 func (r *Resolver) VisitPrefixExpression(pe *PrefixExpression) LigmaObject {
 	r.resolveExpression(pe.Right)
 	return nil
@@ -258,10 +499,12 @@ func (r *Resolver) VisitCallExpression(ce *CallExpression) LigmaObject {
 }
 
 func (r *Resolver) VisitIntegerLiteral(il *IntegerLiteral) LigmaObject {
+	il.instance = NewInteger(il.Value)
 	return nil
 }
 
 func (r *Resolver) VisitFloatLiteral(fl *FloatLiteral) LigmaObject {
+	fl.instance = NewFloat(fl.Value)
 	return nil
 }
 
@@ -280,7 +523,46 @@ func (r *Resolver) VisitListLiteral(ll *ListLiteral) LigmaObject {
 	return nil
 }
 
+func (r *Resolver) VisitListComprehension(lc *ListComprehension) LigmaObject {
+	r.resolveExpression(lc.Iterable)
+
+	// the loop variables don't leak out of the comprehension
+	r.beginScope()
+	for _, target := range lc.Targets {
+		r.declare(target)
+		r.define(target)
+	}
+
+	if lc.Condition != nil {
+		r.resolveExpression(lc.Condition)
+	}
+	r.resolveExpression(lc.Element)
+	r.endScope()
+
+	return nil
+}
+
+func (r *Resolver) VisitMapComprehension(mc *MapComprehension) LigmaObject {
+	r.resolveExpression(mc.Iterable)
+
+	r.beginScope()
+	for _, target := range mc.Targets {
+		r.declare(target)
+		r.define(target)
+	}
+
+	if mc.Condition != nil {
+		r.resolveExpression(mc.Condition)
+	}
+	r.resolveExpression(mc.Key)
+	r.resolveExpression(mc.Value)
+	r.endScope()
+
+	return nil
+}
+
 func (r *Resolver) VisitStringLiteral(sl *StringLiteral) LigmaObject {
+	sl.instance = r.interpreter.Intern(sl.Value)
 	return nil
 }
 
@@ -304,10 +586,7 @@ func (r *Resolver) VisitSetExpression(se *SetExpression) LigmaObject {
 func (r *Resolver) VisitSelfExpression(se *Self) LigmaObject {
 
 	if r.currentClass == cls_NONE {
-		NewError("Can't use 'self' outside of a class.")
-		println("Can't use 'self' outside of a class.")
-		println("Please come up with a better error handling mechanism.")
-		os.Exit(1)
+		r.errorAt(se.Token, "Can't use 'self' outside of a class.")
 	}
 
 	r.resolveLocal(se, se.Token.Literal)
@@ -319,27 +598,35 @@ func (r *Resolver) VisitClassStatement(cs *Class) LigmaObject {
 	enclosingClass := r.currentClass
 	r.currentClass	= cls_CLASS
 
+	r.checkRedefinition(cs.Name)
 	r.declare(cs.Name)
 	r.define(cs.Name)
 
 	if (cs.Superclass != nil ){
 		if cs.Name.Value == cs.Superclass.Value {
-			NewError("A class can't inherit from itself.")
-			println("A class can't inherit from itself.")
-			println("Please come up with a better error handling mechanism.")
-			os.Exit(1)
+			r.errorAt(cs.Superclass.Token, "A class can't inherit from itself.")
 		}
 		r.currentClass = cls_SUBCLASS
 		r.resolveExpression(cs.Superclass)
 	}
 
+	for _, iface := range cs.Interfaces {
+		r.resolveExpression(iface)
+	}
+
 	if cs.Superclass != nil {
 		r.beginScope()
 		r.scopes[len(r.scopes)-1]["super"] = true
+		r.slot("super")
+	}
+
+	for _, field := range cs.Fields {
+		r.resolveExpression(field.Value)
 	}
 
 	r.beginScope()
 	r.scopes[len(r.scopes)-1]["self"] = true
+	r.slot("self")
 	for _, method := range cs.Methods {
 		method_func := method.Value.(*FunctionLiteral)
 		declarition := ft_METHOD
@@ -348,6 +635,9 @@ func (r *Resolver) VisitClassStatement(cs *Class) LigmaObject {
 		}
 		r.resolveFunction(method_func, declarition)
 	}
+	for _, accessor := range append(append([]*DefStatement{}, cs.Getters...), cs.Setters...) {
+		r.resolveFunction(accessor.Value.(*FunctionLiteral), ft_METHOD)
+	}
 	r.endScope()
 
 
@@ -360,24 +650,60 @@ func (r *Resolver) VisitClassStatement(cs *Class) LigmaObject {
 	return nil
 }
 
+func (r *Resolver) VisitRecordStatement(rs *RecordStatement) LigmaObject {
+	r.checkRedefinition(rs.Name)
+	r.declare(rs.Name)
+	r.define(rs.Name)
+	return nil
+}
+
+func (r *Resolver) VisitInterfaceStatement(is *InterfaceStatement) LigmaObject {
+	r.checkRedefinition(is.Name)
+	r.declare(is.Name)
+	r.define(is.Name)
+	return nil
+}
+
+func (r *Resolver) VisitEnumStatement(es *EnumStatement) LigmaObject {
+	r.checkRedefinition(es.Name)
+	r.declare(es.Name)
+	r.define(es.Name)
+
+	for _, member := range es.Members {
+		if member.Value != nil {
+			r.resolveExpression(member.Value)
+		}
+	}
+
+	return nil
+}
+
 func (r *Resolver) VisitSuper(se *Super) LigmaObject {
 
 	if r.currentClass == cls_NONE {
-		NewError("Can't use 'super' outside of a class.")
-		println("Can't use 'super' outside of a class.")
-		println("Please come up with a better error handling mechanism.")
-		os.Exit(1)
+		r.errorAt(se.Token, "Can't use 'super' outside of a class.")
 	} else if r.currentClass != cls_SUBCLASS {
-		NewError("Can't use 'super' in a class with no superclass.")
-		println("Can't use 'super' in a class with no superclass.")
-		println("Please come up with a better error handling mechanism.")
-		os.Exit(1)
+		r.errorAt(se.Token, "Can't use 'super' in a class with no superclass.")
 	}
 
 	r.resolveLocal(se, se.Token.Literal)
 	return nil
 }
 
+func (r *Resolver) VisitTupleLiteral(tl *TupleLiteral) LigmaObject {
+	for _, element := range tl.Elements {
+		r.resolveExpression(element)
+	}
+	return nil
+}
+
+func (r *Resolver) VisitSetLiteral(sl *SetLiteral) LigmaObject {
+	for _, element := range sl.Elements {
+		r.resolveExpression(element)
+	}
+	return nil
+}
+
 func (r *Resolver) VisitMapLiteral(ml *MapLiteral) LigmaObject {
 	for key, value := range ml.Pairs {
 		r.resolveExpression(key)
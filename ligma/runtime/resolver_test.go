@@ -0,0 +1,199 @@
+package runtime_test
+
+import (
+	"reflect"
+	"testing"
+
+	"ligma/lexer"
+	"ligma/parser"
+	"ligma/runtime"
+)
+
+func TestResolverDiagnostics(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []string
+	}{
+		{"constants", `
+const A = 1
+A = 2
+def A = 3
+const (q, r) = (1, 2)
+q = 5
+def h = func() { A = 4 }
+def shadow = func(A) { A = 5 }
+def local = func() { def A = 6 A = 7 }
+`, []string{
+			"3:1: Can't assign to constant A.",
+			"4:5: Can't redefine constant A.",
+			"6:1: Can't assign to constant q.",
+			"7:18: Can't assign to constant A.",
+		}},
+		{"misplaced statements", `
+return 1
+print(self)
+class A : A {}
+class B {
+    def init = func() { return 1 }
+    def m = func() { return super.m() }
+}
+def f = func() {
+    def x = 1
+    def x = 2
+    def y = y
+}
+yield 3
+`, []string{
+			"2:1: Can't return from top-level code.",
+			"3:7: Can't use 'self' outside of a class.",
+			"4:11: A class can't inherit from itself.",
+			"6:25: Can't return a value from an initializer.",
+			"7:29: Can't use 'super' in a class with no superclass.",
+			"11:9: Variable x already declared in this scope.",
+			"12:13: Can't read local variable y in its own initializer.",
+			"14:1: Can't yield from top-level code.",
+		}},
+		{"comprehension variables stay inside", `
+def xs = [1, 2]
+def doubled = [x * 2 for x in xs]
+def pairs = {k: v for k, v in {"a": 1}}
+print(x, k)
+`, []string{
+			"5:7: Undefined variable x.",
+			"5:10: Undefined variable k.",
+		}},
+		{"undefined names", `
+def count = 1
+print(cuont)
+print(lenn([1]))
+print(zzzzzz)
+class Animal {}
+def a = Animal()
+def b = Anmal()
+def later = func() { return helper() }
+def helper = func() { return count }
+`, []string{
+			"3:7: Undefined variable cuont, did you mean count?",
+			"4:7: Undefined variable lenn, did you mean len?",
+			"5:7: Undefined variable zzzzzz.",
+			"8:9: Undefined variable Anmal, did you mean Animal?",
+		}},
+	}
+
+	for _, tt := range tests {
+		p := parser.New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			t.Fatalf("%s: parser errors: %v", tt.name, p.Errors())
+		}
+
+		diagnostics := []string{}
+		for _, d := range runtime.NewResolver(runtime.NewInterpreter()).Resolve(program.Statements) {
+			diagnostics = append(diagnostics, d.String())
+		}
+
+		if !reflect.DeepEqual(diagnostics, tt.expected) {
+			t.Errorf("%s: wrong diagnostics.\nexpected: %q\ngot:      %q", tt.name, tt.expected, diagnostics)
+		}
+	}
+}
+
+func TestResolverKeepsGlobalsAcrossLines(t *testing.T) {
+	r := runtime.NewResolver(runtime.NewInterpreter())
+
+	for _, line := range []string{`def count = 1`, `print(count)`} {
+		program := parser.New(lexer.New(line)).ParseProgram()
+		if diagnostics := r.Resolve(program.Statements); len(diagnostics) != 0 {
+			t.Errorf("%s: unexpected diagnostics %v", line, diagnostics)
+		}
+	}
+}
+
+// returns lists the return statements in stmts in source order, it looks
+// into the blocks the tail call tests use
+func returns(stmts []runtime.Statement) []*runtime.ReturnStatement {
+	found := []*runtime.ReturnStatement{}
+	block := func(b *runtime.BlockStatement) {
+		if b != nil {
+			found = append(found, returns(b.Statements)...)
+		}
+	}
+
+	for _, stmt := range stmts {
+		switch stmt := stmt.(type) {
+		case *runtime.ReturnStatement:
+			found = append(found, stmt)
+		case *runtime.DefStatement:
+			if fn, ok := stmt.Value.(*runtime.FunctionLiteral); ok {
+				block(fn.Body)
+			}
+		case *runtime.ExpressionStatement:
+			if ie, ok := stmt.Expression.(*runtime.IfExpression); ok {
+				block(ie.Consequence)
+				block(ie.Alternative)
+			}
+		case *runtime.WhileStatement:
+			block(stmt.Body)
+		case *runtime.ForStatement:
+			block(stmt.Body)
+		case *runtime.WithStatement:
+			block(stmt.Body)
+		}
+	}
+	return found
+}
+
+func TestResolverMarksTailCalls(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []bool
+	}{
+		{"plain functions", `
+def f = func(n) {
+    if (n == 0) { return 0 }
+    if (n == 1) { return n + f(0) }
+    while (n > 5) { return f(n - 1) }
+    return f(n - 1)
+}
+`, []bool{false, false, true, true}},
+		{"generators", `
+def g = func(n) {
+    yield n
+    return g(n)
+}
+`, []bool{false}},
+		{"for and with bodies", `
+def f = func(xs) {
+    for (x in xs) {
+        return f(x)
+        def inner = func() { return f(x) }
+    }
+    with (xs) { return f(xs) }
+    return f(xs)
+}
+`, []bool{false, true, false, true}},
+	}
+
+	for _, tt := range tests {
+		p := parser.New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			t.Fatalf("%s: parser errors: %v", tt.name, p.Errors())
+		}
+
+		if diagnostics := runtime.NewResolver(runtime.NewInterpreter()).Resolve(program.Statements); len(diagnostics) != 0 {
+			t.Fatalf("%s: resolver diagnostics: %v", tt.name, diagnostics)
+		}
+
+		tails := []bool{}
+		for _, rs := range returns(program.Statements) {
+			tails = append(tails, rs.Tail)
+		}
+
+		if !reflect.DeepEqual(tails, tt.expected) {
+			t.Errorf("%s: wrong tail calls.\nexpected: %v\ngot:      %v", tt.name, tt.expected, tails)
+		}
+	}
+}
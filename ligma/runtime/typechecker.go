@@ -0,0 +1,1320 @@
+package runtime
+
+import (
+	"fmt"
+	"ligma/token"
+	"strings"
+)
+
+// StaticType is the type the TypeChecker infers for an expression. The
+// checker walks the tree through the same visitor interfaces as the
+// interpreter, so types are handed around as LigmaObjects
+type StaticType struct {
+	Name   string        // int, float, str, bool, null, list, map, func, type, any or a class name
+	Params []*StaticType // element types of list, tuple, set and map
+
+	Signature *FunctionSignature // set for func types
+	Class     *classInfo         // set for instances of a class and for class objects
+}
+
+func (t *StaticType) Type() ObjectType { return STATIC_TYPE_OBJ }
+func (t *StaticType) Inspect() string  { return t.String() }
+func (t *StaticType) String() string {
+	if len(t.Params) == 0 {
+		return t.Name
+	}
+
+	params := []string{}
+	for _, p := range t.Params {
+		params = append(params, p.String())
+	}
+	return t.Name + "[" + strings.Join(params, ", ") + "]"
+}
+
+// FunctionSignature describes a callable, Params is nil for builtins that
+// take any number of arguments
+type FunctionSignature struct {
+	Params     []*StaticType
+	ParamNames []string
+	Return     *StaticType
+}
+
+var (
+	anyType   = &StaticType{Name: "any"}
+	nullType  = &StaticType{Name: "null"}
+	boolType  = &StaticType{Name: "bool"}
+	intType   = &StaticType{Name: "int"}
+	floatType = &StaticType{Name: "float"}
+	strType   = &StaticType{Name: "str"}
+)
+
+func listOf(element *StaticType) *StaticType {
+	return &StaticType{Name: "list", Params: []*StaticType{element}}
+}
+
+// tupleOf is the type of a tuple with the given element types
+func tupleOf(elements ...*StaticType) *StaticType {
+	return &StaticType{Name: "tuple", Params: elements}
+}
+
+func setOf(element *StaticType) *StaticType {
+	return &StaticType{Name: "set", Params: []*StaticType{element}}
+}
+
+func mapOf(key, value *StaticType) *StaticType {
+	return &StaticType{Name: "map", Params: []*StaticType{key, value}}
+}
+
+func funcOf(ret *StaticType, params ...*StaticType) *StaticType {
+	return &StaticType{Name: "func", Signature: &FunctionSignature{Params: params, Return: ret}}
+}
+
+// signatures of the builtin functions
+var builtinSignatures = map[string]*StaticType{
+	"len":   funcOf(intType, anyType),
+	"print": {Name: "func", Signature: &FunctionSignature{Return: nullType}},
+	"time":  funcOf(intType),
+	"input": funcOf(strType, strType),
+}
+
+// return types of builtin methods that don't just return any, keyed by class
+var builtinMethodReturns = map[string]map[string]*StaticType{
+	"str": {
+		"slice":    strType,
+		"replace":  strType,
+		"split":    listOf(strType),
+		"__len__":  intType,
+		"__repr__": strType,
+		"__str__":  strType,
+	},
+	"object": {
+		"__repr__": strType,
+		"__str__":  strType,
+	},
+	"set": {
+		"contains": boolType,
+		"__len__":  intType,
+		"__repr__": strType,
+		"__str__":  strType,
+	},
+	"tuple": {
+		"__len__":  intType,
+		"__lt__":   boolType,
+		"__hash__": intType,
+		"__repr__": strType,
+		"__str__":  strType,
+	},
+	"enum": {
+		"__lt__":   boolType,
+		"__hash__": intType,
+	},
+}
+
+// classInfo is what the checker knows about a class, user classes are
+// collected from their declaration, builtin ones wrap the runtime class
+type classInfo struct {
+	name       string
+	superclass *classInfo
+	builtin    *LigmaClass
+	methods    map[string]*StaticType
+	fields     map[string]*StaticType
+	annotated  map[string]bool // fields declared with a type
+	enum       bool            // members are fields holding instances of the class
+	iface      bool            // declared with interface, it can't be instantiated
+	interfaces []*classInfo
+}
+
+func (c *classInfo) instance() *StaticType {
+	return &StaticType{Name: c.name, Class: c}
+}
+
+// lookup finds a method or field on the class or one of its ancestors
+func (c *classInfo) lookup(name string) (*StaticType, bool) {
+	if c.builtin != nil {
+		if c.builtin.GetMethod(name) == nil {
+			return nil, false
+		}
+
+		for class := c.builtin; class != nil; class = firstSuperclass(class) {
+			if ret, ok := builtinMethodReturns[class.Name][name]; ok {
+				return &StaticType{Name: "func", Signature: &FunctionSignature{Return: ret}}, true
+			}
+		}
+		return &StaticType{Name: "func", Signature: &FunctionSignature{Return: anyType}}, true
+	}
+
+	if t, ok := c.methods[name]; ok {
+		return t, true
+	}
+	if t, ok := c.fields[name]; ok {
+		return t, true
+	}
+
+	if c.superclass != nil {
+		if t, ok := c.superclass.lookup(name); ok {
+			return t, true
+		}
+	}
+
+	for _, iface := range c.interfaces {
+		if t, ok := iface.lookup(name); ok {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+// isSubclassOf reports whether the class is name or inherits from it
+func (c *classInfo) isSubclassOf(name string) bool {
+	if c.name == name {
+		return true
+	}
+	if c.builtin != nil {
+		return c.builtin.IsSubclassOf(name)
+	}
+	for _, iface := range c.interfaces {
+		if iface.isSubclassOf(name) {
+			return true
+		}
+	}
+	if c.superclass != nil {
+		return c.superclass.isSubclassOf(name)
+	}
+	return false
+}
+
+func firstSuperclass(c *LigmaClass) *LigmaClass {
+	if len(c.Superclasses) == 0 {
+		return nil
+	}
+	return c.Superclasses[len(c.Superclasses)-1]
+}
+
+// functionContext tracks the function whose body is being checked
+type functionContext struct {
+	declared  *StaticType // declared return type, nil if not annotated
+	returns   []*StaticType
+	generator bool // calls return a generator, whatever the body returns
+}
+
+// typeVariable is a name in scope, annotated variables keep their type,
+// the type of unannotated ones widens to any when assigned something else
+type typeVariable struct {
+	t         *StaticType
+	annotated bool
+}
+
+// TypeChecker is a static pass that runs alongside the Resolver. It infers
+// the types of literals, propagates them through defs, calls and method
+// lookups and reports mismatches with the annotations, without running
+// anything. Unannotated code is typed as any and never reported
+type TypeChecker struct {
+	scopes  []map[string]*typeVariable
+	classes map[string]*classInfo
+	errors  []Diagnostic
+
+	currentFunction *functionContext
+	currentClass    *classInfo
+
+	// silent is set while collecting the fields of a class, errors found
+	// then are reported again on the real pass
+	silent bool
+}
+
+func NewTypeChecker() *TypeChecker {
+	if builtinsClasses["int"] == nil {
+		DefineBuiltinTypes()
+	}
+
+	tc := &TypeChecker{classes: make(map[string]*classInfo)}
+	tc.beginScope()
+
+	for name, signature := range builtinSignatures {
+		tc.declare(name, signature, true)
+	}
+
+	for name, class := range builtinsClasses {
+		info := &classInfo{name: name, builtin: class}
+		tc.classes[name] = info
+		tc.declare(name, &StaticType{Name: "type", Class: info}, true)
+	}
+
+	return tc
+}
+
+// Errors returns the type errors found so far
+func (tc *TypeChecker) Errors() []Diagnostic {
+	return tc.errors
+}
+
+// Check type checks a list of statements, classes and functions defined
+// at this level can be referenced before their definition
+func (tc *TypeChecker) Check(stmts []Statement) {
+	tc.declareAhead(stmts)
+
+	for _, stmt := range stmts {
+		stmt.Accept(tc)
+	}
+}
+
+func (tc *TypeChecker) errorAt(tok token.Token, format string, a ...interface{}) {
+	if tc.silent {
+		return
+	}
+
+	// signatures are looked at more than once, report each problem once
+	diagnostic := newDiagnostic(tok, format, a...)
+	for _, err := range tc.errors {
+		if err == diagnostic {
+			return
+		}
+	}
+	tc.errors = append(tc.errors, diagnostic)
+}
+
+func (tc *TypeChecker) beginScope() {
+	tc.scopes = append(tc.scopes, make(map[string]*typeVariable))
+}
+
+func (tc *TypeChecker) endScope() {
+	tc.scopes = tc.scopes[:len(tc.scopes)-1]
+}
+
+func (tc *TypeChecker) declare(name string, t *StaticType, annotated bool) {
+	tc.scopes[len(tc.scopes)-1][name] = &typeVariable{t: t, annotated: annotated}
+}
+
+func (tc *TypeChecker) lookupVariable(name string) *typeVariable {
+	for i := len(tc.scopes) - 1; i >= 0; i-- {
+		if v, ok := tc.scopes[i][name]; ok {
+			return v
+		}
+	}
+	return nil
+}
+
+// typeOf infers the type of an expression
+func (tc *TypeChecker) typeOf(expr Expression) *StaticType {
+	if expr == nil {
+		return nullType
+	}
+
+	t, ok := expr.Accept(tc).(*StaticType)
+	if !ok || t == nil {
+		return anyType
+	}
+	return t
+}
+
+// declareAhead declares the classes and functions of a statement list
+// before any of them is checked, so they can refer to each other
+func (tc *TypeChecker) declareAhead(stmts []Statement) {
+	for _, stmt := range stmts {
+		switch stmt := stmt.(type) {
+		case *Class:
+			info := &classInfo{name: stmt.Name.Value, methods: map[string]*StaticType{}, fields: map[string]*StaticType{}, annotated: map[string]bool{}}
+			tc.classes[info.name] = info
+			tc.declare(info.name, &StaticType{Name: "type", Class: info}, true)
+
+		case *EnumStatement:
+			tc.declareEnum(stmt)
+
+		case *InterfaceStatement:
+			tc.declareInterface(stmt)
+
+		case *RecordStatement:
+			tc.declareRecord(stmt)
+
+		case *DefStatement:
+			if fn, ok := stmt.Value.(*FunctionLiteral); ok {
+				tc.declare(stmt.Name.Value, tc.signatureOf(fn), true)
+			}
+		}
+	}
+}
+
+// annotationType turns an annotation into a type, unknown names are reported
+func (tc *TypeChecker) annotationType(ann *TypeAnnotation) *StaticType {
+	if ann == nil {
+		return anyType
+	}
+
+	params := []*StaticType{}
+	for _, p := range ann.Params {
+		params = append(params, tc.annotationType(p))
+	}
+
+	switch ann.Name {
+	case "any", "null", "bool", "func", "type":
+		return &StaticType{Name: ann.Name, Params: params}
+	}
+
+	info, ok := tc.classes[ann.Name]
+	if !ok {
+		tc.errorAt(ann.Token, "unknown type %s", ann.Name)
+		return anyType
+	}
+
+	return &StaticType{Name: info.name, Params: params, Class: info}
+}
+
+// signatureOf builds the type of a function literal from its annotations
+func (tc *TypeChecker) signatureOf(fn *FunctionLiteral) *StaticType {
+	signature := &FunctionSignature{Params: []*StaticType{}, ParamNames: []string{}, Return: anyType}
+
+	for _, param := range fn.Parameters {
+		signature.Params = append(signature.Params, tc.annotationType(param.Type))
+		signature.ParamNames = append(signature.ParamNames, param.Value)
+	}
+
+	if fn.ReturnType != nil {
+		signature.Return = tc.annotationType(fn.ReturnType)
+	} else if fn.IsGenerator {
+		signature.Return = tc.classes["generator"].instance()
+	}
+
+	return &StaticType{Name: "func", Signature: signature}
+}
+
+// assignable reports whether a value of type from can be used where to is expected
+func assignable(from, to *StaticType) bool {
+	if from.Name == "any" || to.Name == "any" {
+		return true
+	}
+
+	if from.Name == "int" && to.Name == "float" {
+		return true
+	}
+
+	if from.Name != to.Name {
+		if from.Class != nil && from.Name != "type" {
+			return from.Class.isSubclassOf(to.Name)
+		}
+		return false
+	}
+
+	// tuples of known element types have to agree on their length
+	if from.Name == "tuple" && len(from.Params) > 0 && len(to.Params) > 0 && len(from.Params) != len(to.Params) {
+		return false
+	}
+
+	// parameters that are missing on either side are unknown
+	for idx := 0; idx < len(from.Params) && idx < len(to.Params); idx++ {
+		if !assignable(from.Params[idx], to.Params[idx]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// join is the type of a value that is either a or b
+func join(a, b *StaticType) *StaticType {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+
+	if a.Name == b.Name && len(a.Params) == len(b.Params) {
+		if len(a.Params) == 0 {
+			return a
+		}
+
+		params := []*StaticType{}
+		for idx := range a.Params {
+			params = append(params, join(a.Params[idx], b.Params[idx]))
+		}
+		return &StaticType{Name: a.Name, Params: params, Class: a.Class}
+	}
+
+	if isNumeric(a) && isNumeric(b) {
+		return floatType
+	}
+
+	return anyType
+}
+
+func isNumeric(t *StaticType) bool {
+	return t.Name == "int" || t.Name == "float"
+}
+
+// classOf returns the class of an instance type, builtin types included
+func (tc *TypeChecker) classOf(t *StaticType) *classInfo {
+	if t.Name == "type" || t.Name == "func" {
+		return nil
+	}
+	if t.Class != nil {
+		return t.Class
+	}
+	return tc.classes[t.Name]
+}
+
+// checkCall checks the arguments of a call against the callee and returns the result type
+func (tc *TypeChecker) checkCall(tok token.Token, callee *StaticType, args []*StaticType, name string) *StaticType {
+	switch {
+	case callee.Name == "any":
+		return anyType
+
+	case callee.Name == "type" && callee.Class != nil:
+		info := callee.Class
+		if info.builtin != nil {
+			return info.instance()
+		}
+		if info.enum {
+			tc.errorAt(tok, "cannot instantiate enum %s", info.name)
+			return info.instance()
+		}
+		if info.iface {
+			tc.errorAt(tok, "cannot instantiate interface %s", info.name)
+			return info.instance()
+		}
+
+		if init, ok := info.lookup("init"); ok && init.Signature != nil {
+			tc.checkArguments(tok, init.Signature, args, name)
+		} else if len(args) != 0 {
+			tc.errorAt(tok, "%s takes no arguments, got %d", name, len(args))
+		}
+		return info.instance()
+
+	case callee.Signature != nil:
+		tc.checkArguments(tok, callee.Signature, args, name)
+		return callee.Signature.Return
+	}
+
+	tc.errorAt(tok, "%s is not callable, it is %s", name, callee.String())
+	return anyType
+}
+
+func (tc *TypeChecker) checkArguments(tok token.Token, signature *FunctionSignature, args []*StaticType, name string) {
+	if signature.Params == nil {
+		return
+	}
+
+	if len(args) != len(signature.Params) {
+		tc.errorAt(tok, "wrong number of arguments to %s. got=%d, want=%d", name, len(args), len(signature.Params))
+		return
+	}
+
+	for idx, arg := range args {
+		if !assignable(arg, signature.Params[idx]) {
+			param := fmt.Sprintf("%d", idx+1)
+			if idx < len(signature.ParamNames) {
+				param = signature.ParamNames[idx]
+			}
+			tc.errorAt(tok, "argument %s of %s expects %s, got %s", param, name, signature.Params[idx].String(), arg.String())
+		}
+	}
+}
+
+// checkFunction checks the body of a function literal and returns its type,
+// unannotated return types are inferred from the return statements
+func (tc *TypeChecker) checkFunction(fn *FunctionLiteral, self *StaticType) *StaticType {
+	t := tc.signatureOf(fn)
+
+	enclosing := tc.currentFunction
+	tc.currentFunction = &functionContext{generator: fn.IsGenerator}
+	if fn.ReturnType != nil && !fn.IsGenerator {
+		tc.currentFunction.declared = t.Signature.Return
+	}
+
+	tc.beginScope()
+	if self != nil {
+		tc.declare("self", self, true)
+	}
+	for idx, param := range fn.Parameters {
+		tc.declare(param.Value, t.Signature.Params[idx], param.Type != nil)
+	}
+	tc.Check(fn.Body.Statements)
+	tc.endScope()
+
+	if fn.ReturnType == nil && !fn.IsGenerator {
+		var inferred *StaticType
+		for _, ret := range tc.currentFunction.returns {
+			inferred = join(inferred, ret)
+		}
+		if inferred == nil {
+			inferred = nullType
+		}
+		t.Signature.Return = inferred
+	}
+
+	tc.currentFunction = enclosing
+	return t
+}
+
+func (tc *TypeChecker) VisitDefStatement(def *DefStatement) LigmaObject {
+	if fn, ok := def.Value.(*FunctionLiteral); ok {
+		// declared first so the function can call itself
+		tc.declare(def.Name.Value, tc.signatureOf(fn), true)
+		tc.declare(def.Name.Value, tc.checkFunction(fn, nil), def.Type != nil)
+		return nil
+	}
+
+	valueType := tc.typeOf(def.Value)
+
+	if def.Type == nil {
+		tc.declare(def.Name.Value, valueType, false)
+		return nil
+	}
+
+	declared := tc.annotationType(def.Type)
+
+	// `def x: int;` starts out as null
+	if null, ok := def.Value.(*Null); !ok || null.Token.Literal != "" {
+		if !assignable(valueType, declared) {
+			tc.errorAt(def.Name.Token, "cannot assign %s to %s of type %s", valueType.String(), def.Name.Value, declared.String())
+		}
+	}
+
+	tc.declare(def.Name.Value, declared, true)
+	return nil
+}
+
+// VisitUnpackStatement binds the element types of a tuple to the targets
+func (tc *TypeChecker) VisitUnpackStatement(us *UnpackStatement) LigmaObject {
+	valueType := tc.typeOf(us.Value)
+
+	types := make([]*StaticType, len(us.Targets))
+	for idx := range types {
+		types[idx] = anyType
+	}
+
+	switch valueType.Name {
+	case "tuple":
+		if len(valueType.Params) > 0 {
+			if len(valueType.Params) != len(us.Targets) {
+				tc.errorAt(us.Token, "cannot unpack %s into %d values", valueType.String(), len(us.Targets))
+			} else {
+				copy(types, valueType.Params)
+			}
+		}
+	case "list":
+		if len(valueType.Params) == 1 {
+			for idx := range types {
+				types[idx] = valueType.Params[0]
+			}
+		}
+	case "any":
+	default:
+		tc.errorAt(us.Token, "cannot unpack %s", valueType.String())
+	}
+
+	for idx, target := range us.Targets {
+		tc.declare(target.Value, types[idx], false)
+	}
+	return nil
+}
+
+func (tc *TypeChecker) VisitReturnStatement(rs *ReturnStatement) LigmaObject {
+	t := tc.typeOf(rs.ReturnValue)
+
+	if tc.currentFunction == nil {
+		return nil
+	}
+
+	if declared := tc.currentFunction.declared; declared != nil && !assignable(t, declared) {
+		tc.errorAt(rs.Token, "cannot return %s from a function declared to return %s", t.String(), declared.String())
+	}
+
+	tc.currentFunction.returns = append(tc.currentFunction.returns, t)
+	return nil
+}
+
+func (tc *TypeChecker) VisitExpressionStatement(es *ExpressionStatement) LigmaObject {
+	tc.typeOf(es.Expression)
+	return nil
+}
+
+func (tc *TypeChecker) VisitBlockStatement(block *BlockStatement) LigmaObject {
+	tc.beginScope()
+	tc.Check(block.Statements)
+	tc.endScope()
+	return nil
+}
+
+func (tc *TypeChecker) VisitClassStatement(class *Class) LigmaObject {
+	info, ok := tc.classes[class.Name.Value]
+	if !ok || info.builtin != nil {
+		info = &classInfo{name: class.Name.Value}
+		tc.classes[info.name] = info
+	}
+	info.methods = map[string]*StaticType{}
+	info.fields = map[string]*StaticType{}
+	info.annotated = map[string]bool{}
+	tc.declare(info.name, &StaticType{Name: "type", Class: info}, true)
+
+	info.superclass = tc.classes["object"]
+	if class.Superclass != nil {
+		superclass := tc.typeOf(class.Superclass)
+		if superclass.Name == "type" && superclass.Class != nil {
+			info.superclass = superclass.Class
+		} else if superclass.Name != "any" {
+			tc.errorAt(class.Superclass.Token, "superclass of %s must be a class, got %s", info.name, superclass.String())
+		}
+	}
+
+	for _, field := range class.Fields {
+		if field.Type != nil {
+			info.fields[field.Name.Value] = tc.annotationType(field.Type)
+			info.annotated[field.Name.Value] = true
+		} else {
+			info.fields[field.Name.Value] = tc.typeOf(field.Value)
+		}
+	}
+
+	info.interfaces = nil
+	for _, name := range class.Interfaces {
+		iface := tc.typeOf(name)
+		if iface.Name == "type" && iface.Class != nil && iface.Class.iface {
+			info.interfaces = append(info.interfaces, iface.Class)
+		} else if iface.Name != "any" {
+			tc.errorAt(name.Token, "%s is not an interface", name.Value)
+		}
+	}
+
+	// abstract methods take any arguments, subclasses provide the signature
+	for _, name := range class.Abstract {
+		info.methods[name.Value] = &StaticType{Name: "func", Signature: &FunctionSignature{Return: anyType}}
+	}
+
+	for _, method := range class.Methods {
+		info.methods[method.Name.Value] = tc.signatureOf(method.Value.(*FunctionLiteral))
+	}
+
+	enclosing := tc.currentClass
+	tc.currentClass = info
+
+	// the first pass only collects the fields assigned through self
+	wasSilent := tc.silent
+	tc.silent = true
+	for _, method := range class.Methods {
+		tc.checkFunction(method.Value.(*FunctionLiteral), info.instance())
+	}
+	for _, accessor := range append(append([]*DefStatement{}, class.Getters...), class.Setters...) {
+		tc.checkFunction(accessor.Value.(*FunctionLiteral), info.instance())
+	}
+	tc.silent = wasSilent
+
+	for _, method := range class.Methods {
+		info.methods[method.Name.Value] = tc.checkFunction(method.Value.(*FunctionLiteral), info.instance())
+	}
+
+	// properties look like fields, typed by the getter's result unless a
+	// setter says what can be assigned
+	for _, getter := range class.Getters {
+		getterType := tc.checkFunction(getter.Value.(*FunctionLiteral), info.instance())
+		info.fields[getter.Name.Value] = getterType.Signature.Return
+		info.annotated[getter.Name.Value] = true
+	}
+	for _, setter := range class.Setters {
+		setterType := tc.checkFunction(setter.Value.(*FunctionLiteral), info.instance())
+		info.fields[setter.Name.Value] = setterType.Signature.Params[0]
+		info.annotated[setter.Name.Value] = true
+	}
+
+	tc.currentClass = enclosing
+	return nil
+}
+
+// declareRecord declares a record, the constructor takes the fields in order
+func (tc *TypeChecker) declareRecord(rs *RecordStatement) *classInfo {
+	info := &classInfo{name: rs.Name.Value, superclass: tc.classes["record"], methods: map[string]*StaticType{}, fields: map[string]*StaticType{}, annotated: map[string]bool{}}
+
+	init := &FunctionSignature{Params: []*StaticType{}, ParamNames: []string{}, Return: nullType}
+	for _, field := range rs.Fields {
+		t := tc.annotationType(field.Type)
+		info.fields[field.Value] = t
+		info.annotated[field.Value] = true
+		init.Params = append(init.Params, t)
+		init.ParamNames = append(init.ParamNames, field.Value)
+	}
+
+	info.methods["init"] = &StaticType{Name: "func", Signature: init}
+	info.methods["with"] = funcOf(info.instance(), mapOf(strType, anyType))
+
+	tc.classes[info.name] = info
+	tc.declare(info.name, &StaticType{Name: "type", Class: info}, true)
+	return info
+}
+
+func (tc *TypeChecker) VisitRecordStatement(rs *RecordStatement) LigmaObject {
+	tc.declareRecord(rs)
+	return nil
+}
+
+// declareInterface declares an interface, its methods take any arguments
+func (tc *TypeChecker) declareInterface(is *InterfaceStatement) *classInfo {
+	info := &classInfo{name: is.Name.Value, superclass: tc.classes["object"], iface: true, methods: map[string]*StaticType{}, fields: map[string]*StaticType{}, annotated: map[string]bool{}}
+	for _, method := range is.Methods {
+		info.methods[method.Value] = &StaticType{Name: "func", Signature: &FunctionSignature{Return: anyType}}
+	}
+
+	tc.classes[info.name] = info
+	tc.declare(info.name, &StaticType{Name: "type", Class: info}, true)
+	return info
+}
+
+func (tc *TypeChecker) VisitInterfaceStatement(is *InterfaceStatement) LigmaObject {
+	tc.declareInterface(is)
+	return nil
+}
+
+// declareEnum declares an enum class whose members are instances of it
+func (tc *TypeChecker) declareEnum(es *EnumStatement) *classInfo {
+	info := &classInfo{name: es.Name.Value, superclass: tc.classes["enum"], enum: true, methods: map[string]*StaticType{}, fields: map[string]*StaticType{}, annotated: map[string]bool{}}
+	tc.classes[info.name] = info
+	tc.declare(info.name, &StaticType{Name: "type", Class: info}, true)
+	return info
+}
+
+func (tc *TypeChecker) VisitEnumStatement(es *EnumStatement) LigmaObject {
+	info := tc.declareEnum(es)
+
+	var value *StaticType
+	for _, member := range es.Members {
+		if member.Value != nil {
+			value = join(value, tc.typeOf(member.Value))
+		} else {
+			value = join(value, intType)
+		}
+		info.fields[member.Name.Value] = info.instance()
+	}
+	if value == nil {
+		value = anyType
+	}
+
+	info.fields["name"] = strType
+	info.fields["value"] = value
+	return nil
+}
+
+func (tc *TypeChecker) VisitWhileStatement(ws *WhileStatement) LigmaObject {
+	tc.typeOf(ws.Condition)
+	ws.Body.Accept(tc)
+	return nil
+}
+
+func (tc *TypeChecker) VisitForStatement(fs *ForStatement) LigmaObject {
+	iterable := tc.typeOf(fs.Iterable)
+
+	tc.beginScope()
+	for idx, t := range tc.elementTypes(fs.Token, iterable, len(fs.Targets)) {
+		tc.declare(fs.Targets[idx].Value, t, false)
+	}
+	tc.Check(fs.Body.Statements)
+	tc.endScope()
+
+	return nil
+}
+
+func (tc *TypeChecker) VisitAssertStatement(as *AssertStatement) LigmaObject {
+	tc.typeOf(as.Condition)
+	if as.Message != nil {
+		tc.typeOf(as.Message)
+	}
+	return nil
+}
+
+func (tc *TypeChecker) VisitWithStatement(ws *WithStatement) LigmaObject {
+	manager := tc.typeOf(ws.Manager)
+
+	value := anyType
+	if class := tc.classOf(manager); class != nil {
+		enter, ok := class.lookup("__enter__")
+		if !ok {
+			tc.errorAt(ws.Token, "%s is not a context manager, it has no __enter__", manager.String())
+		} else if enter.Signature != nil {
+			value = enter.Signature.Return
+		}
+	}
+
+	tc.beginScope()
+	if ws.Name != nil {
+		tc.declare(ws.Name.Value, value, false)
+	}
+	tc.Check(ws.Body.Statements)
+	tc.endScope()
+
+	return nil
+}
+
+func (tc *TypeChecker) VisitPrefixExpression(pe *PrefixExpression) LigmaObject {
+	right := tc.typeOf(pe.Right)
+
+	switch pe.Operator {
+	case "!":
+		return boolType
+	case "-":
+		if isNumeric(right) || right.Name == "any" {
+			return right
+		}
+		tc.errorAt(pe.Token, "unsupported operand type for -: %s", right.String())
+	}
+
+	return anyType
+}
+
+// operatorMethods maps infix operators to the methods implementing them
+var operatorMethods = map[string]string{
+	"+":  "__add__",
+	"-":  "__sub__",
+	"*":  "__mul__",
+	"/":  "__div__",
+	"%":  "__mod__",
+	"|":  "__or__",
+	"&":  "__and__",
+	"<":  "__lt__",
+	">":  "__lt__",
+	"<=": "__lt__",
+	">=": "__lt__",
+}
+
+func (tc *TypeChecker) VisitInfixExpression(ie *InfixExpression) LigmaObject {
+	left := tc.typeOf(ie.Left)
+	right := tc.typeOf(ie.Right)
+
+	return tc.infixType(ie.Token, ie.Operator, left, right)
+}
+
+func (tc *TypeChecker) infixType(tok token.Token, operator string, left, right *StaticType) *StaticType {
+	switch operator {
+	case "==", "!=", "and", "or", "implements":
+		return boolType
+	case "in", "not in":
+		if right.Name == "str" && left.Name != "str" && left.Name != "any" {
+			tc.errorAt(tok, "'in <str>' requires str as left operand, not %s", left.String())
+		} else if class := tc.classOf(right); right.Name != "any" && (class == nil || class.builtin == nil) {
+			if class == nil {
+				tc.errorAt(tok, "%s is not a container", right.String())
+			} else if _, ok := class.lookup("__contains__"); !ok {
+				tc.errorAt(tok, "%s is not a container, it has no __contains__", right.String())
+			}
+		}
+		return boolType
+	}
+
+	if left.Name == "any" || right.Name == "any" {
+		switch operator {
+		case "<", ">", "<=", ">=":
+			return boolType
+		}
+		return anyType
+	}
+
+	if isNumeric(left) && isNumeric(right) {
+		switch operator {
+		case "<", ">", "<=", ">=":
+			return boolType
+		case "/":
+			return floatType
+		case "+", "-", "*", "%":
+			if left.Name == "int" && right.Name == "int" {
+				return intType
+			}
+			return floatType
+		}
+	}
+
+	if left.Name == "str" && right.Name == "str" && operator == "+" {
+		return strType
+	}
+
+	if left.Name == "set" && right.Name == "set" {
+		switch operator {
+		case "|", "&", "-":
+			var element *StaticType
+			if len(left.Params) == 1 && len(right.Params) == 1 {
+				element = join(left.Params[0], right.Params[0])
+			}
+			if element == nil || operator == "-" {
+				return left
+			}
+			return setOf(element)
+		}
+	}
+
+	if left.Name == "tuple" && right.Name == "tuple" {
+		switch operator {
+		case "<", ">", "<=", ">=":
+			return boolType
+		}
+	}
+
+	method, ok := operatorMethods[operator]
+	if class := tc.classOf(left); ok && class != nil && class.builtin == nil {
+		if fn, found := class.lookup(method); found && fn.Signature != nil {
+			return fn.Signature.Return
+		}
+	}
+
+	tc.errorAt(tok, "unsupported operand types for %s: %s and %s", operator, left.String(), right.String())
+	return anyType
+}
+
+func (tc *TypeChecker) VisitYieldExpression(ye *YieldExpression) LigmaObject {
+	if ye.Value != nil {
+		tc.typeOf(ye.Value)
+	}
+
+	// whatever is sent in
+	return anyType
+}
+
+func (tc *TypeChecker) VisitPipeExpression(pe *PipeExpression) LigmaObject {
+	args := []*StaticType{tc.typeOf(pe.Left)}
+	target := pe.Right
+
+	if call, ok := pe.Right.(*CallExpression); ok {
+		target = call.Function
+		for _, arg := range call.Arguments {
+			args = append(args, tc.typeOf(arg))
+		}
+	}
+
+	return tc.checkCall(pe.Token, tc.typeOf(target), args, target.String())
+}
+
+func (tc *TypeChecker) VisitIfExpression(ie *IfExpression) LigmaObject {
+	tc.typeOf(ie.Condition)
+	ie.Consequence.Accept(tc)
+
+	if ie.Alternative != nil {
+		ie.Alternative.Accept(tc)
+	}
+
+	return anyType
+}
+
+func (tc *TypeChecker) VisitCallExpression(ce *CallExpression) LigmaObject {
+	callee := tc.typeOf(ce.Function)
+
+	args := []*StaticType{}
+	for _, arg := range ce.Arguments {
+		args = append(args, tc.typeOf(arg))
+	}
+
+	return tc.checkCall(ce.Token, callee, args, ce.Function.String())
+}
+
+func (tc *TypeChecker) VisitIndexExpression(ie *IndexExpression) LigmaObject {
+	left := tc.typeOf(ie.Left)
+	index := tc.typeOf(ie.Index)
+
+	switch left.Name {
+	case "list", "str":
+		if !assignable(index, intType) {
+			tc.errorAt(ie.Token, "%s indices must be int, got %s", left.Name, index.String())
+		}
+		if left.Name == "str" {
+			return strType
+		}
+		if len(left.Params) == 1 {
+			return left.Params[0]
+		}
+
+	case "tuple":
+		if !assignable(index, intType) {
+			tc.errorAt(ie.Token, "tuple indices must be int, got %s", index.String())
+		}
+
+		// a literal index picks the type of that element
+		if literal, ok := ie.Index.(*IntegerLiteral); ok && len(left.Params) > 0 {
+			if literal.Value < 0 || literal.Value >= int64(len(left.Params)) {
+				tc.errorAt(ie.Token, "tuple index %d out of range for %s", literal.Value, left.String())
+				return anyType
+			}
+			return left.Params[literal.Value]
+		}
+
+	case "map":
+		if len(left.Params) == 2 {
+			if !assignable(index, left.Params[0]) {
+				tc.errorAt(ie.Token, "map keys are %s, got %s", left.Params[0].String(), index.String())
+			}
+			return left.Params[1]
+		}
+
+	case "any":
+
+	default:
+		class := tc.classOf(left)
+		if class == nil {
+			tc.errorAt(ie.Token, "%s does not support indexing", left.String())
+			break
+		}
+		get, ok := class.lookup("__get__")
+		if !ok {
+			tc.errorAt(ie.Token, "%s does not support indexing", left.String())
+		} else if get.Signature != nil && get.Signature.Params != nil {
+			return get.Signature.Return
+		}
+	}
+
+	return anyType
+}
+
+func (tc *TypeChecker) VisitAssignExpression(ae *AssignExpression) LigmaObject {
+	value := tc.typeOf(ae.Value)
+
+	variable := tc.lookupVariable(ae.Name.Value)
+	if variable == nil {
+		// assigning an unknown name creates a global
+		tc.scopes[0][ae.Name.Value] = &typeVariable{t: value}
+		return nullType
+	}
+
+	if variable.annotated {
+		if !assignable(value, variable.t) {
+			tc.errorAt(ae.Name.Token, "cannot assign %s to %s of type %s", value.String(), ae.Name.Value, variable.t.String())
+		}
+	} else if !assignable(value, variable.t) || !assignable(variable.t, value) {
+		variable.t = anyType
+	}
+
+	return nullType
+}
+
+func (tc *TypeChecker) VisitIdentifier(ident *Identifier) LigmaObject {
+	if variable := tc.lookupVariable(ident.Value); variable != nil {
+		return variable.t
+	}
+	return anyType
+}
+
+func (tc *TypeChecker) VisitIntegerLiteral(il *IntegerLiteral) LigmaObject {
+	return intType
+}
+
+func (tc *TypeChecker) VisitFloatLiteral(fl *FloatLiteral) LigmaObject {
+	return floatType
+}
+
+func (tc *TypeChecker) VisitBoolean(b *Boolean) LigmaObject {
+	return boolType
+}
+
+func (tc *TypeChecker) VisitNull(n *Null) LigmaObject {
+	return nullType
+}
+
+func (tc *TypeChecker) VisitListLiteral(ll *ListLiteral) LigmaObject {
+	var element *StaticType
+	for _, el := range ll.Elements {
+		element = join(element, tc.typeOf(el))
+	}
+
+	if element == nil {
+		element = anyType
+	}
+	return listOf(element)
+}
+
+func (tc *TypeChecker) VisitTupleLiteral(tl *TupleLiteral) LigmaObject {
+	elements := []*StaticType{}
+	for _, el := range tl.Elements {
+		elements = append(elements, tc.typeOf(el))
+	}
+	return tupleOf(elements...)
+}
+
+func (tc *TypeChecker) VisitSetLiteral(sl *SetLiteral) LigmaObject {
+	var element *StaticType
+	for _, el := range sl.Elements {
+		element = join(element, tc.typeOf(el))
+	}
+
+	if element == nil {
+		element = anyType
+	}
+	return setOf(element)
+}
+
+func (tc *TypeChecker) VisitStringLiteral(sl *StringLiteral) LigmaObject {
+	return strType
+}
+
+func (tc *TypeChecker) VisitFunctionLiteral(fl *FunctionLiteral) LigmaObject {
+	return tc.checkFunction(fl, nil)
+}
+
+func (tc *TypeChecker) VisitMapLiteral(ml *MapLiteral) LigmaObject {
+	var key, value *StaticType
+	for k, v := range ml.Pairs {
+		key = join(key, tc.typeOf(k))
+		value = join(value, tc.typeOf(v))
+	}
+
+	if key == nil {
+		return mapOf(anyType, anyType)
+	}
+	return mapOf(key, value)
+}
+
+// elementTypes returns the types bound to the targets when iterating over t
+func (tc *TypeChecker) elementTypes(tok token.Token, t *StaticType, targets int) []*StaticType {
+	types := make([]*StaticType, targets)
+	for idx := range types {
+		types[idx] = anyType
+	}
+
+	switch t.Name {
+	case "list":
+		if targets == 1 && len(t.Params) == 1 {
+			types[0] = t.Params[0]
+		}
+	case "set":
+		if targets == 1 && len(t.Params) == 1 {
+			types[0] = t.Params[0]
+		}
+	case "tuple":
+		if targets == 1 {
+			var element *StaticType
+			for _, p := range t.Params {
+				element = join(element, p)
+			}
+			if element != nil {
+				types[0] = element
+			}
+		}
+	case "map":
+		if len(t.Params) == 2 {
+			types[0] = t.Params[0]
+			if targets == 2 {
+				types[1] = t.Params[1]
+			}
+		}
+	case "str":
+		if targets == 1 {
+			types[0] = strType
+		}
+	case "any":
+	case "type":
+		if t.Class != nil && t.Class.enum {
+			if targets == 1 {
+				types[0] = t.Class.instance()
+			}
+		} else {
+			tc.errorAt(tok, "%s is not iterable", t.String())
+		}
+	default:
+		if class := tc.classOf(t); class == nil {
+			tc.errorAt(tok, "%s is not iterable", t.String())
+		} else if _, ok := class.lookup("__iter__"); !ok {
+			tc.errorAt(tok, "%s is not iterable", t.String())
+		}
+	}
+
+	return types
+}
+
+func (tc *TypeChecker) VisitListComprehension(lc *ListComprehension) LigmaObject {
+	iterable := tc.typeOf(lc.Iterable)
+
+	tc.beginScope()
+	for idx, t := range tc.elementTypes(lc.Token, iterable, len(lc.Targets)) {
+		tc.declare(lc.Targets[idx].Value, t, false)
+	}
+
+	if lc.Condition != nil {
+		tc.typeOf(lc.Condition)
+	}
+	element := tc.typeOf(lc.Element)
+	tc.endScope()
+
+	return listOf(element)
+}
+
+func (tc *TypeChecker) VisitMapComprehension(mc *MapComprehension) LigmaObject {
+	iterable := tc.typeOf(mc.Iterable)
+
+	tc.beginScope()
+	for idx, t := range tc.elementTypes(mc.Token, iterable, len(mc.Targets)) {
+		tc.declare(mc.Targets[idx].Value, t, false)
+	}
+
+	if mc.Condition != nil {
+		tc.typeOf(mc.Condition)
+	}
+	key := tc.typeOf(mc.Key)
+	value := tc.typeOf(mc.Value)
+	tc.endScope()
+
+	return mapOf(key, value)
+}
+
+func (tc *TypeChecker) VisitGetExpression(ge *GetExpression) LigmaObject {
+	object := tc.typeOf(ge.Object)
+	if object.Name == "any" {
+		return anyType
+	}
+
+	class := tc.classOf(object)
+	if object.Name == "type" {
+		class = object.Class
+	}
+
+	if class == nil {
+		tc.errorAt(ge.Property.Token, "%s has no attribute %s", object.String(), ge.Property.Value)
+		return anyType
+	}
+
+	t, ok := class.lookup(ge.Property.Value)
+	if !ok {
+		tc.errorAt(ge.Property.Token, "undefined method or attribute %s for %s", ge.Property.Value, class.name)
+		return anyType
+	}
+
+	return t
+}
+
+func (tc *TypeChecker) VisitSetExpression(se *SetExpression) LigmaObject {
+	object := tc.typeOf(se.Object)
+	value := tc.typeOf(se.Value)
+
+	class := tc.classOf(object)
+	if class == nil || class.builtin != nil {
+		return value
+	}
+
+	field, ok := class.lookup(se.Property.Value)
+	if !ok {
+		// fields come to life when they are first assigned through self
+		if _, isSelf := se.Object.(*Self); isSelf {
+			class.fields[se.Property.Value] = value
+		}
+		return value
+	}
+
+	if field.Signature == nil && !assignable(value, field) {
+		// unannotated fields take whatever their methods assign to them
+		if _, isSelf := se.Object.(*Self); isSelf && tc.silent && !class.annotated[se.Property.Value] {
+			class.fields[se.Property.Value] = join(field, value)
+			return value
+		}
+		tc.errorAt(se.Property.Token, "cannot assign %s to field %s of type %s", value.String(), se.Property.Value, field.String())
+	}
+
+	return value
+}
+
+func (tc *TypeChecker) VisitSelfExpression(se *Self) LigmaObject {
+	if variable := tc.lookupVariable("self"); variable != nil {
+		return variable.t
+	}
+	return anyType
+}
+
+func (tc *TypeChecker) VisitSuper(s *Super) LigmaObject {
+	if tc.currentClass == nil || tc.currentClass.superclass == nil {
+		return anyType
+	}
+
+	t, ok := tc.currentClass.superclass.lookup(s.Method.Value)
+	if !ok {
+		tc.errorAt(s.Method.Token, "undefined method %s for %s", s.Method.Value, tc.currentClass.superclass.name)
+		return anyType
+	}
+	return t
+}
@@ -0,0 +1,106 @@
+package runtime_test
+
+import (
+	"reflect"
+	"testing"
+
+	"ligma/lexer"
+	"ligma/parser"
+	"ligma/runtime"
+)
+
+// typecheck runs the TypeChecker over input and returns its errors as
+// "line:col: message" strings
+func typecheck(t *testing.T, input string) []string {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+
+	tc := runtime.NewTypeChecker()
+	tc.Check(program.Statements)
+
+	errors := []string{}
+	for _, d := range tc.Errors() {
+		errors = append(errors, d.String())
+	}
+	return errors
+}
+
+func TestTypeChecker(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []string
+	}{
+		{"annotated defs", `
+def x: int = 5;
+def f: float = 1;
+def names: list[str] = ["a", "b"];
+def later: str;
+later = "set";
+`, []string{}},
+		{"functions and classes", `
+def greet = func(name: str, times: int) -> str { return name + "!"; };
+greet("bob", 2);
+class Counter {
+    def count: int = 0;
+    def bump = func() -> int { self.count = self.count + 1; return self.count; }
+}
+def c = Counter();
+def n: int = c.bump();
+`, []string{}},
+		{"unannotated code is never reported", `
+def anything = func(a, b) { return a + b; };
+anything(1, "a");
+def v = 1;
+v = "now a string";
+`, []string{}},
+		{"mismatched defs", `
+def x: int = "five";
+def y: str = 5;
+`, []string{
+			"2:5: cannot assign str to x of type int",
+			"3:5: cannot assign int to y of type str",
+		}},
+		{"calls", `
+def greet = func(name: str, times: int) -> str { return name + "!"; };
+greet(3, 2);
+greet("a");
+`, []string{
+			"3:6: argument name of greet expects str, got int",
+			"4:6: wrong number of arguments to greet. got=1, want=2",
+		}},
+		{"returns, attributes and operators", `
+def bad = func(n: int) -> int { return "nope"; };
+class Counter { def count: int = 0; }
+def c = Counter();
+c.missing;
+c.count = "s";
+print(1 + "a");
+def w: Widget = 3;
+`, []string{
+			"2:33: cannot return str from a function declared to return int",
+			"5:3: undefined method or attribute missing for Counter",
+			"6:3: cannot assign str to field count of type int",
+			"7:9: unsupported operand types for +: int and str",
+			"8:8: unknown type Widget",
+		}},
+		{"the same error in two places is reported twice", `
+def f = func(n: int) { return n; };
+f("a");
+f("a");
+`, []string{
+			"3:2: argument n of f expects int, got str",
+			"4:2: argument n of f expects int, got str",
+		}},
+	}
+
+	for _, tt := range tests {
+		errors := typecheck(t, tt.input)
+		if !reflect.DeepEqual(errors, tt.expected) {
+			t.Errorf("%s: wrong errors.\nexpected: %q\ngot:      %q", tt.name, tt.expected, errors)
+		}
+	}
+}
@@ -6,6 +6,10 @@ type TokenType string;
 type Token struct {
 	Type   TokenType
 	Literal string
+
+	// position of the first character, both start at 1
+	Line   int
+	Column int
 }
 
 const (
@@ -28,6 +32,10 @@ const (
 	BANG     = "!"
 	MOD	  	 = "%"
 	POW		 = "**"
+	PIPE	 = "|>"
+	BAR		 = "|"
+	AMPERSAND = "&"
+	ARROW	 = "->"
 
 	LT = "<"
 	GT = ">"
@@ -57,41 +65,63 @@ const (
 	// Keywords
 	FUNCTION = "FUNCTION"
 	DEF     = "DEF"
+	CONST   = "CONST"
 	TRUE     = "TRUE"
 	FALSE    = "FALSE"
 	IF       = "IF"
 	ELSE     = "ELSE"
 	RETURN   = "RETURN"
+	YIELD    = "YIELD"
 	NULL	 = "NULL"
 	CLASS = "CLASS"
+	ENUM = "ENUM"
+	RECORD = "RECORD"
+	INTERFACE = "INTERFACE"
+	IMPLEMENTS = "IMPLEMENTS"
+	ABSTRACT = "ABSTRACT"
 	SELF = "SELF"
 	SUPER = "SUPER"
+	ASSERT = "ASSERT"
 	IMPORT = "IMPORT"
+	WITH = "WITH"
+	AS = "AS"
 
 	// Control Flow
 	FOR = "FOR"
 	WHILE = "WHILE"
+	IN = "IN"
 )
 
 
 var keywords = map[string]TokenType{
 	"def": DEF,
+	"const": CONST,
 	"func":  FUNCTION,
 	"true": TRUE,
 	"false": FALSE,
 	"if": IF,
 	"else": ELSE,
 	"return": RETURN,
+	"yield": YIELD,
 	"for": FOR,
 	"while": WHILE,
+	"in": IN,
 	"and": AND,
 	"or": OR,
 	"not": NOT,
 	"null": NULL,
 	"class": CLASS,
+	"enum": ENUM,
+	"record": RECORD,
+	"interface": INTERFACE,
+	"implements": IMPLEMENTS,
+	"abstract": ABSTRACT,
 	"self": SELF,
 	"super": SUPER,
+	"assert": ASSERT,
 	"import": IMPORT,
+	"with": WITH,
+	"as": AS,
 }
 
 // LookupIdent checks if a given identifier is a keyword
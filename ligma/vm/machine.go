@@ -0,0 +1,455 @@
+package vm
+
+import (
+	"ligma/compiler"
+	"ligma/runtime"
+)
+
+// operators are the infix operators by opcode
+var operators = map[compiler.Opcode]string{}
+
+func init() {
+	for operator, op := range compiler.Operators {
+		operators[op] = operator
+	}
+}
+
+// frame is a call in progress
+type frame struct {
+	code *code
+	ip   int
+	env  *runtime.Environment
+	base int // height of the stack when the call started
+}
+
+// machine is a stack of calls and the operand stack they share. Calls
+// between compiled functions push a frame, a call coming from the runtime
+// gets a machine of its own
+type machine struct {
+	vm          *VM
+	interpreter *runtime.Interpreter
+
+	stack  []runtime.LigmaObject
+	frames []frame
+
+	root   *runtime.Environment // scope of a program, nil for a function
+	result runtime.LigmaObject  // of the last top level statement
+}
+
+func (m *machine) push(obj runtime.LigmaObject) {
+	m.stack = append(m.stack, obj)
+}
+
+func (m *machine) pop() runtime.LigmaObject {
+	obj := m.stack[len(m.stack)-1]
+	m.stack = m.stack[:len(m.stack)-1]
+	return obj
+}
+
+// value pushes the result of an operation, an error is handed back to be
+// raised instead
+func (m *machine) value(obj runtime.LigmaObject) runtime.LigmaObject {
+	if isError(obj) {
+		return obj
+	}
+	m.push(obj)
+	return nil
+}
+
+// popN removes the top n values and returns a copy of them, the runtime
+// may keep the slice it is given
+func (m *machine) popN(n int) []runtime.LigmaObject {
+	values := make([]runtime.LigmaObject, n)
+	copy(values, m.stack[len(m.stack)-n:])
+	m.stack = m.stack[:len(m.stack)-n]
+	return values
+}
+
+func (m *machine) run(c *code, env *runtime.Environment) runtime.LigmaObject {
+	m.frames = append(m.frames, frame{code: c, env: env})
+	i := m.interpreter
+
+	for {
+		f := &m.frames[len(m.frames)-1]
+		ins := f.code.fn.Instructions
+
+		// only a program runs off its end, functions return
+		if f.ip >= len(ins) {
+			return m.result
+		}
+
+		op := compiler.Opcode(ins[f.ip])
+		f.ip++
+
+		var err runtime.LigmaObject
+
+		switch op {
+		case compiler.OpConstant:
+			m.push(m.vm.constants[m.operand(f)])
+
+		case compiler.OpNull:
+			m.push(runtime.NULL)
+
+		case compiler.OpTrue:
+			m.push(runtime.TRUE)
+
+		case compiler.OpFalse:
+			m.push(runtime.FALSE)
+
+		case compiler.OpNil:
+			m.push(nil)
+
+		case compiler.OpPop:
+			m.pop()
+
+		case compiler.OpGetLocal:
+			depth := int(ins[f.ip])
+			f.ip++
+			local, _ := f.env.GetAt(depth, m.operand(f))
+			m.push(local)
+
+		case compiler.OpSetLocal:
+			depth := int(ins[f.ip])
+			f.ip++
+			err = failed(f.env.SetAt(depth, m.operand(f), m.pop()))
+
+		case compiler.OpDefineLocal:
+			f.env.Define(m.operand(f), m.pop())
+
+		case compiler.OpDefineConstLocal:
+			slot := m.operand(f)
+			f.env.DefineConstant(slot, m.name(f), m.pop())
+
+		case compiler.OpGetGlobal:
+			name := m.name(f)
+			if global, ok := i.Globals().Get(name); ok {
+				m.push(global)
+			} else {
+				err = runtime.NewError("undefined variable %s", name)
+			}
+
+		case compiler.OpSetGlobal:
+			name := m.name(f)
+			err = failed(i.Globals().Set(name, m.pop()))
+
+		case compiler.OpDefine:
+			name := m.name(f)
+			err = failed(f.env.Set(name, m.pop()))
+
+		case compiler.OpDefineConst:
+			name := m.name(f)
+			err = failed(f.env.SetConstant(name, m.pop()))
+
+		case compiler.OpPushScope:
+			f.env = runtime.NewEnclosedEnvironment(f.env)
+
+		case compiler.OpPopScope:
+			f.env = f.env.Parent()
+
+		case compiler.OpJump:
+			f.ip = int(compiler.ReadUint16(ins[f.ip:]))
+
+		case compiler.OpJumpFalse:
+			target := m.operand(f)
+			if !runtime.IsTruthy(m.pop()) {
+				f.ip = target
+			}
+
+		case compiler.OpAdd, compiler.OpSub, compiler.OpMul, compiler.OpDiv, compiler.OpMod,
+			compiler.OpBitOr, compiler.OpBitAnd, compiler.OpLess, compiler.OpGreater,
+			compiler.OpLessEqual, compiler.OpGreaterEqual, compiler.OpEqual, compiler.OpNotEqual,
+			compiler.OpAnd, compiler.OpOr, compiler.OpIn, compiler.OpNotIn, compiler.OpImplements:
+			right := m.pop()
+			left := m.pop()
+			err = m.value(runtime.EvalInfixExpression(operators[op], left, right))
+
+		case compiler.OpMinus:
+			err = m.value(runtime.EvalPrefixExpression("-", m.pop()))
+
+		case compiler.OpBang:
+			err = m.value(runtime.EvalPrefixExpression("!", m.pop()))
+
+		case compiler.OpCall:
+			argc := int(ins[f.ip])
+			f.ip++
+			err = m.call(argc)
+
+		case compiler.OpTailCall:
+			argc := int(ins[f.ip])
+			f.ip++
+			if result, done := m.tailCall(argc); done {
+				return result
+			}
+
+		case compiler.OpPipe:
+			argc := int(ins[f.ip])
+			f.ip++
+			function := m.pop()
+			args := m.popN(argc)
+			err = m.value(runtime.ApplyFunction(i, function, args))
+
+		case compiler.OpReturn:
+			if result, done := m.ret(m.pop()); done {
+				return result
+			}
+
+		case compiler.OpClosure:
+			fn := m.vm.constants[m.operand(f)].(*compiler.Function)
+			m.push(&runtime.LigmaFunction{
+				Parameters:  fn.Literal.Parameters,
+				ReturnType:  fn.Literal.ReturnType,
+				Body:        fn.Literal.Body,
+				Env:         f.env,
+				IsGenerator: fn.Literal.IsGenerator,
+				Code:        m.vm.code(fn),
+			})
+
+		case compiler.OpYield:
+			err = m.value(i.Yield(m.pop()))
+
+		case compiler.OpList:
+			elements := m.popN(m.operand(f))
+			err = m.value(runtime.ApplyFunction(i, m.vm.list, []runtime.LigmaObject{&runtime.LigmaList{Elements: elements}}))
+
+		case compiler.OpTuple:
+			elements := m.popN(m.operand(f))
+			err = m.value(runtime.ApplyFunction(i, m.vm.tuple, []runtime.LigmaObject{&runtime.LigmaTuple{Elements: elements}}))
+
+		case compiler.OpMap:
+			err = m.buildMap(m.operand(f))
+
+		case compiler.OpIndex:
+			index := m.pop()
+			left := m.pop()
+			err = m.value(i.Index(left, index))
+
+		case compiler.OpGetProperty:
+			name := m.name(f)
+			cache := &f.code.caches[m.operand(f)]
+			err = m.value(i.GetProperty(m.pop(), name, cache))
+
+		case compiler.OpSetProperty:
+			name := m.name(f)
+			cache := &f.code.caches[m.operand(f)]
+			val := m.pop()
+			err = m.value(i.SetProperty(m.pop(), name, val, cache))
+
+		case compiler.OpLoop:
+			targets := int(ins[f.ip])
+			f.ip++
+			loop, failure := runtime.NewLoop(i, m.pop(), targets)
+			if failure != nil {
+				err = failure
+			} else {
+				m.push(loop)
+			}
+
+		case compiler.OpNext:
+			end := m.operand(f)
+			loop := m.stack[len(m.stack)-1].(*runtime.Loop)
+			values, failure := loop.Next()
+			if failure != nil || values == nil {
+				m.pop()
+				err = failure
+				f.ip = end
+				break
+			}
+
+			// every round gets a scope of its own, the targets are its first locals
+			f.env = runtime.NewEnclosedEnvironment(f.env)
+			for idx, value := range values {
+				f.env.Define(idx, value)
+			}
+
+		case compiler.OpEvaluate:
+			node := m.vm.constants[m.operand(f)].(*compiler.Node)
+			previous := i.Env
+			i.Env = f.env
+			result := node.Expression.Accept(i)
+			i.Env = previous
+			err = m.value(result)
+
+		case compiler.OpExecute:
+			node := m.vm.constants[m.operand(f)].(*compiler.Node)
+			previous := i.Env
+			i.Env = f.env
+			result := node.Statement.Accept(i)
+			i.Env = previous
+
+			if returned, ok := result.(*runtime.ReturnValue); ok {
+				if result, done := m.ret(returned.Value); done {
+					return result
+				}
+				break
+			}
+			err = m.value(result)
+
+		case compiler.OpFail:
+			err = runtime.NewError("%s", m.name(f))
+
+		case compiler.OpResult:
+			m.result = m.pop()
+		}
+
+		if err != nil {
+			if result, done := m.raise(err); done {
+				return result
+			}
+		}
+	}
+}
+
+// operand reads a two byte operand
+func (m *machine) operand(f *frame) int {
+	operand := int(compiler.ReadUint16(f.code.fn.Instructions[f.ip:]))
+	f.ip += 2
+	return operand
+}
+
+// name reads the operand of a name constant
+func (m *machine) name(f *frame) string {
+	return m.vm.constants[m.operand(f)].(*runtime.LigmaString).Value
+}
+
+// call calls the function below argc arguments. Compiled functions of this
+// VM run in a new frame, everything else is applied by the runtime
+func (m *machine) call(argc int) runtime.LigmaObject {
+	callee := m.stack[len(m.stack)-1-argc]
+
+	if fn, ok := callee.(*runtime.LigmaFunction); ok && !fn.IsGenerator && !m.interpreter.CheckTypes {
+		if c, ok := fn.Code.(*code); ok && c.vm == m.vm {
+			if argc != len(fn.Parameters) {
+				return runtime.NewError("wrong number of arguments. got=%d, want=%d", argc, len(fn.Parameters))
+			}
+
+			env := fn.Environment(m.stack[len(m.stack)-argc:])
+			m.stack = m.stack[:len(m.stack)-1-argc]
+			m.frames = append(m.frames, frame{code: c, env: env, base: len(m.stack)})
+			return nil
+		}
+	}
+
+	args := m.popN(argc)
+	m.pop()
+	return m.value(runtime.ApplyFunction(m.interpreter, callee, args))
+}
+
+// tailCall makes a call in tail position. A compiled function of this VM
+// runs in the frame of the caller, the last frame of the machine hands the
+// call to the runtime as a TailCall. Anything else is called like OpCall and
+// returned by the OpReturn that follows
+func (m *machine) tailCall(argc int) (runtime.LigmaObject, bool) {
+	callee := m.stack[len(m.stack)-1-argc]
+	f := &m.frames[len(m.frames)-1]
+
+	if fn, ok := callee.(*runtime.LigmaFunction); ok && !fn.IsGenerator && !m.interpreter.CheckTypes {
+		if c, ok := fn.Code.(*code); ok && c.vm == m.vm {
+			if argc != len(fn.Parameters) {
+				return m.raise(runtime.NewError("wrong number of arguments. got=%d, want=%d", argc, len(fn.Parameters)))
+			}
+
+			env := fn.Environment(m.stack[len(m.stack)-argc:])
+			m.stack = m.stack[:f.base]
+			*f = frame{code: c, env: env, base: f.base}
+			return nil, false
+		}
+	}
+
+	if len(m.frames) == 1 && f.code.fn.Literal != nil {
+		args := m.popN(argc)
+		m.pop()
+		return m.ret(&runtime.TailCall{Function: callee, Args: args})
+	}
+
+	if err := m.call(argc); err != nil {
+		return m.raise(err)
+	}
+	return nil, false
+}
+
+// ret returns result from the current frame, it reports whether that was
+// the last frame of the machine
+func (m *machine) ret(result runtime.LigmaObject) (runtime.LigmaObject, bool) {
+	f := m.frames[len(m.frames)-1]
+	if err := m.closeLoops(f.base); err != nil && !isError(result) {
+		return m.raise(err)
+	}
+	m.stack = m.stack[:f.base]
+	m.frames = m.frames[:len(m.frames)-1]
+
+	if len(m.frames) == 0 {
+		return result, true
+	}
+
+	m.push(result)
+	return nil, false
+}
+
+// raise unwinds every frame of the machine with err, like an error is
+// passed up through the tree walker. A program goes on with its next
+// statement unless err is fatal, a function returns err to its caller
+func (m *machine) raise(err runtime.LigmaObject) (runtime.LigmaObject, bool) {
+	m.closeLoops(0)
+	m.stack = m.stack[:0]
+	m.frames = m.frames[:1]
+
+	f := &m.frames[0]
+	if f.code.fn.Literal != nil || runtime.IsFatal(err) {
+		m.frames = m.frames[:0]
+		return err, true
+	}
+
+	m.result = err
+	f.env = m.root
+	next := len(f.code.fn.Instructions)
+	for _, start := range f.code.fn.Statements {
+		if start >= f.ip {
+			next = start
+			break
+		}
+	}
+	f.ip = next
+
+	return nil, false
+}
+
+// closeLoops releases the loops left on the stack above base, it returns
+// the first error releasing one failed with
+func (m *machine) closeLoops(base int) runtime.LigmaObject {
+	var first runtime.LigmaObject
+	for idx := len(m.stack) - 1; idx >= base; idx-- {
+		if loop, ok := m.stack[idx].(*runtime.Loop); ok {
+			if err := loop.Close(); err != nil && first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
+
+// buildMap collects n key/value pairs into a map
+func (m *machine) buildMap(n int) runtime.LigmaObject {
+	values := m.popN(2 * n)
+	pairs := runtime.NewMap()
+
+	for idx := 0; idx < len(values); idx += 2 {
+		if err := pairs.Set(values[idx], values[idx+1]); err != nil {
+			return err
+		}
+	}
+
+	return m.value(runtime.ApplyFunction(m.interpreter, m.vm.hash, []runtime.LigmaObject{pairs}))
+}
+
+// failed returns result if it is an error
+func failed(result runtime.LigmaObject) runtime.LigmaObject {
+	if isError(result) {
+		return result
+	}
+	return nil
+}
+
+func isError(obj runtime.LigmaObject) bool {
+	_, ok := obj.(*runtime.Error)
+	return ok
+}
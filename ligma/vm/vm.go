@@ -0,0 +1,74 @@
+package vm
+
+import (
+	"ligma/compiler"
+	"ligma/runtime"
+)
+
+// VM runs the bytecode of the compiler. Values are the objects of the
+// runtime and scopes are its Environments, so compiled code and the tree
+// walker share classes, builtins and closures and can call each other:
+// constructs the compiler doesn't lower are run by the interpreter in the
+// scope they are in, and functions created there get compiled bodies
+type VM struct {
+	interpreter *runtime.Interpreter
+	compiler    *compiler.Compiler
+	constants   []runtime.LigmaObject
+
+	codes map[*compiler.Function]*code
+
+	// classes that literals are made of
+	list, tuple, hash runtime.LigmaObject
+}
+
+// New returns a VM that runs code compiled by c with the interpreter c
+// resolves against
+func New(i *runtime.Interpreter, c *compiler.Compiler) *VM {
+	vm := &VM{interpreter: i, compiler: c, codes: make(map[*compiler.Function]*code)}
+
+	globals := i.Globals()
+	vm.list, _ = globals.Get("list")
+	vm.tuple, _ = globals.Get("tuple")
+	vm.hash, _ = globals.Get("map")
+
+	i.Compile = func(fl *runtime.FunctionLiteral) runtime.Code {
+		fn := c.Function(fl)
+		vm.constants = c.Constants()
+		return vm.code(fn)
+	}
+
+	return vm
+}
+
+// Run executes a compiled program and returns what its last statement
+// evaluated to, like Interpret
+func (vm *VM) Run(bytecode *compiler.Bytecode) runtime.LigmaObject {
+	vm.constants = vm.compiler.Constants()
+
+	m := &machine{vm: vm, interpreter: vm.interpreter, root: vm.interpreter.Env}
+	return m.run(vm.code(bytecode.Main), vm.interpreter.Env)
+}
+
+// code is a compiled function body with the inline caches of its property
+// access sites, the runtime calls it through Run
+type code struct {
+	vm     *VM
+	fn     *compiler.Function
+	caches []runtime.PropertyCache
+}
+
+func (vm *VM) code(fn *compiler.Function) *code {
+	c, ok := vm.codes[fn]
+	if !ok {
+		c = &code{vm: vm, fn: fn, caches: make([]runtime.PropertyCache, fn.Caches)}
+		vm.codes[fn] = c
+	}
+	return c
+}
+
+// Run runs the body on a machine of its own, calls from the runtime like
+// constructors and generators come in here
+func (c *code) Run(i *runtime.Interpreter, env *runtime.Environment) runtime.LigmaObject {
+	m := &machine{vm: c.vm, interpreter: i}
+	return m.run(c, env)
+}